@@ -2,19 +2,33 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/ultron/daemon/internal/computer"
 	"github.com/ultron/daemon/internal/config"
+	"github.com/ultron/daemon/internal/crash"
 	"github.com/ultron/daemon/internal/emitters"
+	"github.com/ultron/daemon/internal/executor"
 	"github.com/ultron/daemon/internal/handlers"
+	"github.com/ultron/daemon/internal/logging"
 	"github.com/ultron/daemon/internal/primeclient"
+	"github.com/ultron/daemon/internal/redact"
+	"github.com/ultron/daemon/internal/session"
 )
 
 func main() {
+	defer crash.Recover("main")
+
 	// Parse flags
 	configPath := flag.String("config", "", "Path to config file")
 	flag.Parse()
@@ -25,6 +39,14 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Route logs through the ring-buffered handler so get_logs can serve them
+	logging.Setup(cfg.LogBufferLines)
+	if level, err := logging.ParseLevel(cfg.LogLevel); err == nil {
+		logging.SetLevel(level)
+	} else {
+		slog.Warn("Ignoring DAEMON_LOG_LEVEL", "error", err)
+	}
+
 	log.Printf("🤖 Ultron Daemon starting...")
 	log.Printf("   Name: %s", cfg.Name)
 	log.Printf("   Hostname: %s", cfg.Hostname)
@@ -35,11 +57,91 @@ func main() {
 		log.Printf("   Ultron root: %s", cfg.UltronRoot)
 	}
 
+	// Secrets to mask in command output
+	patterns := cfg.RedactPatterns
+	if cfg.RedactDefaults {
+		patterns = append(append([]string{}, redact.DefaultPatterns...), patterns...)
+	}
+	if err := redact.SetPatterns(patterns); err != nil {
+		log.Fatalf("Failed to configure redaction: %v", err)
+	}
+
 	// Register built-in command handlers
 	handlers.RegisterBuiltins()
+	if cfg.Debug {
+		handlers.RegisterDebug()
+		log.Printf("   Debug handlers enabled")
+	}
+	handlers.SetStreamBatching(cfg.StreamBatchBytes, cfg.StreamFlushInterval)
+	handlers.SetKVPath(cfg.KVPath)
+	handlers.SetBackupConfig(cfg.BackupDir, cfg.BackupRetention)
+	handlers.SetTrashDir(cfg.TrashDir)
+	handlers.SetPrimeAddress(cfg.PrimeAddress)
+	protected := cfg.ProtectedPaths
+	if cfg.UltronRoot != "" {
+		protected = append(protected, cfg.UltronRoot)
+	}
+	handlers.SetProtectedPaths(protected)
+	handlers.SetDeletablePaths(cfg.DeletablePaths)
+	handlers.SetDeleteConfirmThreshold(cfg.DeleteConfirm)
+	handlers.SetCapabilities(cfg.Capabilities)
+	handlers.SetMaxShellTimeout(cfg.MaxCommandTimeout)
+	handlers.SetHandlerTimeout(cfg.HandlerTimeout)
+	handlers.SetReadOnly(cfg.ReadOnly)
+	handlers.SetScreenshotDefaults(cfg.ScreenshotMaxDimension, cfg.ScreenshotJPEGQuality)
+	computer.DefaultManager.SetScreenshotCacheTTL(cfg.ScreenshotCacheTTL)
+	if cfg.ReadOnly {
+		log.Printf("   Read-only mode: commands that could change the host are refused")
+	}
+	session.DefaultManager.SetLimits(cfg.MaxSessions, cfg.SessionEvictIdle)
+	if cfg.IsSoulDaemon {
+		if cfg.UltronRoot != "" {
+			handlers.EnableSelfModify(cfg.UltronRoot)
+		} else {
+			log.Printf("   ULTRON_ROOT not set; self_modify disabled")
+		}
+	}
 	log.Printf("   Registered handlers: %v", handlers.DefaultRegistry.ListHandlers())
 
 	// Create Prime client
+	var primeTLS *tls.Config
+	if cfg.PrimeTLS {
+		primeTLS, err = primeclient.LoadTLSConfig(primeclient.TLSOptions{
+			CAFile:     cfg.PrimeTLSCA,
+			ServerName: cfg.PrimeTLSName,
+			CertFile:   cfg.TLSCertPath,
+			KeyFile:    cfg.TLSKeyPath,
+		})
+		if err != nil {
+			log.Fatalf("Failed to configure TLS to Prime: %v", err)
+		}
+	}
+
+	var wsURL string
+	switch cfg.PrimeTransport {
+	case primeclient.TransportTCP:
+	case primeclient.TransportWebSocket:
+		if cfg.PrimeWSURL == "" {
+			log.Fatalf("PRIME_TRANSPORT=websocket needs PRIME_WS_URL (e.g. wss://prime.example.com/api/daemon/ws)")
+		}
+		wsURL = cfg.PrimeWSURL
+	default:
+		log.Fatalf("Unknown PRIME_TRANSPORT %q (use tcp or websocket)", cfg.PrimeTransport)
+	}
+
+	var sourceAddr *net.TCPAddr
+	if cfg.SourceAddr != "" {
+		if sourceAddr, err = primeclient.ResolveSourceAddr(cfg.SourceAddr); err != nil {
+			log.Fatalf("Invalid DAEMON_SOURCE_ADDR: %v", err)
+		}
+		log.Printf("   Connecting to Prime from %s", sourceAddr)
+	}
+
+	proxy, err := primeclient.LoadProxy(cfg.Proxy)
+	if err != nil {
+		log.Fatalf("Invalid proxy configuration: %v", err)
+	}
+
 	client := primeclient.NewClient(primeclient.Config{
 		PrimeAddress:    cfg.PrimeAddress,
 		RegistrationKey: cfg.RegistrationKey,
@@ -48,20 +150,45 @@ func main() {
 		Capabilities:    cfg.Capabilities,
 		IsSoulDaemon:    cfg.IsSoulDaemon,
 		UltronRoot:      cfg.UltronRoot,
+		ReadTimeout:     cfg.ReadTimeout,
+		WriteTimeout:    cfg.WriteTimeout,
+		KeepAlive:       cfg.KeepAlive,
+		MaxMissedAcks:   cfg.MaxMissedAcks,
+		MaxRecvBytes:    cfg.MaxRecvBytes,
+		MaxSendBytes:    cfg.MaxSendBytes,
+		MaxConcurrent:   cfg.MaxConcurrent,
+		TLS:             primeTLS,
+		MessageMAC:      cfg.MessageMAC,
+		SourceAddr:      sourceAddr,
+		WebSocketURL:    wsURL,
+		Proxy:           proxy,
+	})
+	if proxyURL := client.ProxyURL(); proxyURL != nil {
+		log.Printf("   Connecting to Prime through proxy %s", proxyURL.Redacted())
+	}
+
+	// Report crashes to Prime before exiting
+	crash.SetReporter(func(where, message string, stack []byte) {
+		err := client.SendAlert("daemon_crash", fmt.Sprintf("Daemon %s panicked in %s: %s", cfg.Name, where, message), "critical", map[string]string{
+			"where": where,
+			"stack": string(stack),
+		})
+		if err != nil {
+			slog.Error("Failed to report crash to Prime", "error", err)
+		}
 	})
 
 	// Set up emitters for proactive events
 	emitterManager := emitters.NewManager()
+	for _, e := range buildEmitters(cfg, emitterManager) {
+		emitterManager.AddEmitter(e)
+	}
 
-	// Add resource monitor
-	resourceMonitor := emitters.NewResourceMonitor(emitterManager, cfg.Name)
-	emitterManager.AddEmitter(resourceMonitor)
-
-	// Route emitter events to Prime
-	emitterManager.OnEvent(func(event emitters.Event) {
-		log.Printf("Emitting event: %s/%s", event.Source, event.Type)
+	// Route emitter events to Prime in order, so e.g. a create never arrives after its delete
+	emitterManager.OnEventOrdered(func(event emitters.Event) {
+		slog.Debug("Emitting event", "source", event.Source, "type", event.Type)
 		if err := client.SendEvent(event.Source, event.Type, event.Payload); err != nil {
-			log.Printf("Failed to send event: %v", err)
+			slog.Error("Failed to send event", "source", event.Source, "type", event.Type, "error", err)
 		}
 	})
 
@@ -73,17 +200,44 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// SIGHUP reloads config and restarts emitters without dropping events
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		defer crash.Recover("reload")
+		for range hupChan {
+			newCfg, err := config.Load(*configPath)
+			if err != nil {
+				slog.Error("Reload failed", "error", err)
+				continue
+			}
+			log.Printf("Received SIGHUP, reloading emitters...")
+			emitterManager.Reload(buildEmitters(newCfg, emitterManager))
+		}
+	}()
+
+	// Sweep stale in-flight command entries
+	go executor.DefaultExecutor.RunSweeper(ctx, time.Minute)
+
 	// Start emitters
 	if err := emitterManager.Start(); err != nil {
-		log.Printf("Failed to start emitters: %v", err)
+		slog.Error("Failed to start emitters", "error", err)
+	}
+
+	// Pre-flight check so misconfiguration shows up clearly in the logs
+	if err := client.Probe(ctx); err != nil {
+		slog.Warn("⚠️  Prime is not reachable; will keep retrying in the background", "error", err)
+	} else {
+		log.Printf("   Prime is reachable")
 	}
 
 	// Connect to Prime in background
 	go func() {
+		defer crash.Recover("connection")
 		log.Printf("Connecting to Prime at %s...", cfg.PrimeAddress)
 		if err := client.Connect(ctx); err != nil {
 			if err != context.Canceled {
-				log.Printf("Connection error: %v", err)
+				slog.Error("Connection error", "error", err)
 			}
 		}
 	}()
@@ -91,15 +245,77 @@ func main() {
 	// Wait for shutdown signal
 	sig := <-sigChan
 	log.Printf("Received signal %v, shutting down...", sig)
-	cancel()
 
 	// Stop emitters
 	emitterManager.Stop()
 
-	// Close client
-	if err := client.Close(); err != nil {
-		log.Printf("Error closing client: %v", err)
+	// Let running commands report their results before the connection goes;
+	// a second signal skips the wait
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	go func() {
+		select {
+		case <-sigChan:
+			slog.Warn("Second signal, not waiting for running commands")
+			cancelDrain()
+		case <-drainCtx.Done():
+		}
+	}()
+	log.Printf("Draining: waiting up to %v for %d running command(s)", cfg.ShutdownTimeout, handlers.ActiveTasks())
+	if err := client.Shutdown(drainCtx); err != nil {
+		slog.Error("Error during shutdown", "error", err)
 	}
+	cancelDrain()
+	cancel()
 
 	log.Println("Goodbye!")
 }
+
+// buildEmitters creates the configured emitters. It is also used on SIGHUP
+// to rebuild them from freshly loaded config.
+func buildEmitters(cfg *config.Config, manager *emitters.Manager) []emitters.Emitter {
+	// Filesystems to watch for disk pressure
+	executor.SetDiskPaths(cfg.DiskPaths)
+
+	// Add resource monitor
+	monitor := emitters.NewResourceMonitor(manager, cfg.Name)
+	monitor.SetCheckInterval(cfg.ResourceInterval)
+	monitor.SetThresholds(cfg.CPUThreshold, cfg.MemThreshold, cfg.DiskThreshold)
+	monitor.SetInodeThreshold(cfg.InodeThreshold)
+	list := []emitters.Emitter{monitor}
+
+	// Add periodic system snapshots for trend analysis
+	if cfg.SnapshotInterval > 0 {
+		snapshot := emitters.NewSystemSnapshot(manager, cfg.Name, cfg.SnapshotInterval)
+		snapshot.IncludeEnv = cfg.SnapshotEnv
+		list = append(list, snapshot)
+	}
+
+	// Add structured log tailers ("path|format|match")
+	for _, spec := range cfg.StructuredLogs {
+		parts := strings.SplitN(spec, "|", 3)
+		for len(parts) < 3 {
+			parts = append(parts, "")
+		}
+		if parts[1] == "" {
+			parts[1] = "json"
+		}
+		tailer, err := emitters.NewStructuredLogTailer(manager, cfg.Name, parts[0], parts[1], parts[2])
+		if err != nil {
+			slog.Warn("Skipping structured log", "spec", spec, "error", err)
+			continue
+		}
+		list = append(list, tailer)
+	}
+
+	// Add plain file tailers ("path|regex")
+	for _, spec := range cfg.TailFiles {
+		path, filter, _ := strings.Cut(spec, "|")
+		tailer, err := emitters.NewFileTailer(manager, cfg.Name, path, filter)
+		if err != nil {
+			slog.Warn("Skipping tailed file", "spec", spec, "error", err)
+			continue
+		}
+		list = append(list, tailer)
+	}
+	return list
+}
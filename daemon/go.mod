@@ -2,11 +2,15 @@ module github.com/ultron/daemon
 
 go 1.22
 
-require google.golang.org/grpc v1.60.1
+require (
+	github.com/fsnotify/fsnotify v1.7.0
+	golang.org/x/net v0.20.0
+	google.golang.org/grpc v1.60.1
+	nhooyr.io/websocket v1.8.10
+)
 
 require (
 	github.com/golang/protobuf v1.5.3 // indirect
-	golang.org/x/net v0.20.0 // indirect
 	golang.org/x/sys v0.16.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240116215550-a9fa1716bcac // indirect
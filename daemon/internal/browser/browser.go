@@ -38,6 +38,10 @@ type Command struct {
 	Timeout       int    `json:"timeout,omitempty"`
 	Amount        int    `json:"amount,omitempty"`
 	Direction     string `json:"direction,omitempty"`
+
+	Storage *WebStorage     `json:"storage,omitempty"`
+	Clear   bool            `json:"clear,omitempty"`
+	State   json.RawMessage `json:"state,omitempty"` // Playwright storage_state blob
 }
 
 // Result represents a browser command result
@@ -54,6 +58,28 @@ type Result struct {
 	Count    int         `json:"count,omitempty"`
 	Result   interface{} `json:"result,omitempty"`
 	Ready    bool        `json:"ready,omitempty"`
+	Filename string      `json:"filename,omitempty"`
+
+	Console []ConsoleMessage `json:"console,omitempty"`
+	Storage *WebStorage      `json:"storage,omitempty"`
+	State   json.RawMessage  `json:"state,omitempty"`
+}
+
+// WebStorage holds localStorage and sessionStorage entries for one origin
+type WebStorage struct {
+	Origin         string            `json:"origin,omitempty"`
+	LocalStorage   map[string]string `json:"local_storage,omitempty"`
+	SessionStorage map[string]string `json:"session_storage,omitempty"`
+}
+
+// ConsoleMessage is a console entry or uncaught error captured from the page
+type ConsoleMessage struct {
+	Level     string  `json:"level"` // log, info, warning, error, debug, ...
+	Text      string  `json:"text"`
+	URL       string  `json:"url,omitempty"`
+	Line      int     `json:"line,omitempty"`
+	Column    int     `json:"column,omitempty"`
+	Timestamp float64 `json:"timestamp"` // Unix seconds
 }
 
 // Global manager instance
@@ -269,3 +295,35 @@ func (m *Manager) Wait(selector string, timeout int) (*Result, error) {
 func (m *Manager) Close() (*Result, error) {
 	return m.Execute(Command{Action: "close"})
 }
+
+// GetConsole returns console messages collected since the last call
+func (m *Manager) GetConsole() (*Result, error) {
+	return m.Execute(Command{Action: "get_console"})
+}
+
+// Download triggers a download by clicking selector (or navigating to url)
+// and waits for it to be saved locally. timeout is in milliseconds.
+func (m *Manager) Download(selector, url string, timeout int) (*Result, error) {
+	return m.Execute(Command{Action: "download", Selector: selector, URL: url, Timeout: timeout})
+}
+
+// GetStorage reads localStorage and sessionStorage for the current origin
+func (m *Manager) GetStorage() (*Result, error) {
+	return m.Execute(Command{Action: "get_storage"})
+}
+
+// SetStorage writes storage entries for the current origin, optionally
+// clearing existing entries first
+func (m *Manager) SetStorage(storage WebStorage, clear bool) (*Result, error) {
+	return m.Execute(Command{Action: "set_storage", Storage: &storage, Clear: clear})
+}
+
+// SaveState captures the context's cookies and localStorage as a storage_state blob
+func (m *Manager) SaveState() (*Result, error) {
+	return m.Execute(Command{Action: "save_state"})
+}
+
+// LoadState replaces the current context with one pre-loaded from a storage_state blob
+func (m *Manager) LoadState(state json.RawMessage, headless bool) (*Result, error) {
+	return m.Execute(Command{Action: "load_state", State: state, Headless: headless})
+}
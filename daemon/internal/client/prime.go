@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -16,6 +18,9 @@ type PrimeClient struct {
 	registrationKey string
 	httpClient      *http.Client
 	daemonID        string
+
+	sourceAddr *net.TCPAddr                          // See SetSourceAddr
+	proxyFor   func(*http.Request) (*url.URL, error) // See SetProxy (nil = environment)
 }
 
 // RegistrationRequest is sent to Prime to register this daemon
@@ -45,6 +50,36 @@ func NewPrimeClient(baseURL, registrationKey string) *PrimeClient {
 	}
 }
 
+// SetSourceAddr makes requests to Prime originate from addr (see
+// primeclient.ResolveSourceAddr); nil restores the OS's choice.
+func (c *PrimeClient) SetSourceAddr(addr *net.TCPAddr) {
+	c.sourceAddr = addr
+	c.updateTransport()
+}
+
+// SetProxy sends requests to Prime through the proxy proxyFor picks (e.g.
+// primeclient.Proxy.ForRequest); nil connects directly.
+func (c *PrimeClient) SetProxy(proxyFor func(*http.Request) (*url.URL, error)) {
+	c.proxyFor = proxyFor
+	if proxyFor == nil {
+		c.proxyFor = func(*http.Request) (*url.URL, error) { return nil, nil }
+	}
+	c.updateTransport()
+}
+
+func (c *PrimeClient) updateTransport() {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if c.sourceAddr != nil {
+		dialer.LocalAddr = c.sourceAddr
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	if c.proxyFor != nil {
+		transport.Proxy = c.proxyFor
+	}
+	c.httpClient.Transport = transport
+}
+
 // Register registers this daemon with Ultron Prime
 func (c *PrimeClient) Register(ctx context.Context, req RegistrationRequest) (*RegistrationResponse, error) {
 	body, err := json.Marshal(req)
@@ -9,10 +9,12 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
 // Manager handles the computer use subprocess
@@ -22,45 +24,113 @@ type Manager struct {
 	stdout  *bufio.Reader
 	mu      sync.Mutex
 	running bool
+
+	// Screenshot cache; see SetScreenshotCacheTTL
+	cacheTTL time.Duration
+	cached   *Result
+	cachedAt time.Time
+}
+
+// DefaultScreenshotCacheTTL is how long a screenshot is reused unless
+// SetScreenshotCacheTTL says otherwise.
+const DefaultScreenshotCacheTTL = 200 * time.Millisecond
+
+// lookActions only observe the screen, so they leave the screenshot cache
+// alone; every other action may change what's on it.
+var lookActions = map[string]bool{
+	"screenshot":      true,
+	"screenshot_diff": true,
+	"cursor_position": true,
+	"ping":            true,
 }
 
 // Command represents a computer use action
 type Command struct {
-	Action          string    `json:"action"`
-	Coordinate      []int     `json:"coordinate,omitempty"`
-	StartCoordinate []int     `json:"start_coordinate,omitempty"`
-	Text            string    `json:"text,omitempty"`
-	Key             string    `json:"key,omitempty"`
-	Direction       string    `json:"direction,omitempty"`
-	Amount          int       `json:"amount,omitempty"`
-	Duration        float64   `json:"duration,omitempty"`
+	Action          string  `json:"action"`
+	Coordinate      []int   `json:"coordinate,omitempty"`
+	StartCoordinate []int   `json:"start_coordinate,omitempty"`
+	Text            string  `json:"text,omitempty"`
+	Key             string  `json:"key,omitempty"`
+	Direction       string  `json:"direction,omitempty"`
+	Amount          int     `json:"amount,omitempty"`
+	Duration        float64 `json:"duration,omitempty"`
 }
 
 // Result represents a computer use action result
 type Result struct {
-	Success         bool    `json:"success"`
-	Error           string  `json:"error,omitempty"`
-	Base64Image     string  `json:"base64_image,omitempty"`
-	DisplayWidth    int     `json:"display_width,omitempty"`
-	DisplayHeight   int     `json:"display_height,omitempty"`
-	ScreenWidth     int     `json:"screen_width,omitempty"`
-	ScreenHeight    int     `json:"screen_height,omitempty"`
-	ApiWidth        int     `json:"api_width,omitempty"`
-	ApiHeight       int     `json:"api_height,omitempty"`
-	ScaleX          float64 `json:"scale_x,omitempty"`
-	ScaleY          float64 `json:"scale_y,omitempty"`
-	ScreenshotError string  `json:"screenshot_error,omitempty"`
-	HasCliclick     bool    `json:"has_cliclick,omitempty"`
-	Ready           bool    `json:"ready,omitempty"`
-	X               int     `json:"x,omitempty"`
-	Y               int     `json:"y,omitempty"`
+	Success         bool        `json:"success"`
+	Error           string      `json:"error,omitempty"`
+	Base64Image     string      `json:"base64_image,omitempty"`
+	DisplayWidth    int         `json:"display_width,omitempty"`
+	DisplayHeight   int         `json:"display_height,omitempty"`
+	ScreenWidth     int         `json:"screen_width,omitempty"`
+	ScreenHeight    int         `json:"screen_height,omitempty"`
+	ApiWidth        int         `json:"api_width,omitempty"`
+	ApiHeight       int         `json:"api_height,omitempty"`
+	ScaleX          float64     `json:"scale_x,omitempty"`
+	ScaleY          float64     `json:"scale_y,omitempty"`
+	ScreenshotError string      `json:"screenshot_error,omitempty"`
+	HasCliclick     bool        `json:"has_cliclick,omitempty"`
+	Ready           bool        `json:"ready,omitempty"`
+	X               int         `json:"x,omitempty"`
+	Y               int         `json:"y,omitempty"`
+	Cached          bool        `json:"cached,omitempty"` // Screenshot served from the cache
+	Diff            *ScreenDiff `json:"diff,omitempty"`   // screenshot_diff only
+}
+
+// ScreenDiff is screenshot_diff's comparison of two screenshots.
+type ScreenDiff struct {
+	Similarity    float64 `json:"similarity"` // Fraction of pixels unchanged, 0-1
+	Changed       bool    `json:"changed"`
+	ChangedPixels int     `json:"changed_pixels"`
+	TotalPixels   int     `json:"total_pixels"`
+	Tolerance     int     `json:"tolerance"` // Per-channel difference still counted as unchanged
+	BBox          *Rect   `json:"bbox"`      // Region containing every changed pixel; nil if none
+}
+
+// Rect is a region of a screenshot, in API coordinates.
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
 }
 
 // Global manager instance
 var DefaultManager *Manager
 
 func init() {
-	DefaultManager = &Manager{}
+	DefaultManager = &Manager{cacheTTL: DefaultScreenshotCacheTTL}
+}
+
+// SetScreenshotCacheTTL sets how long a screenshot is reused for further
+// screenshot actions (0 = always capture). Any other action that could
+// change the screen drops the cached one.
+func (m *Manager) SetScreenshotCacheTTL(ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cacheTTL = ttl
+	m.cached = nil
+}
+
+// cachedScreenshotLocked returns a copy of the cached screenshot if it's
+// still fresh.
+func (m *Manager) cachedScreenshotLocked() *Result {
+	if m.cached == nil || m.cacheTTL <= 0 || time.Since(m.cachedAt) >= m.cacheTTL {
+		return nil
+	}
+	result := *m.cached
+	result.Cached = true
+	return &result
+}
+
+// cacheScreenshotLocked keeps a successful screenshot for reuse.
+func (m *Manager) cacheScreenshotLocked(result *Result) {
+	if m.cacheTTL <= 0 || !result.Success || result.Base64Image == "" {
+		return
+	}
+	cached := *result
+	m.cached, m.cachedAt = &cached, time.Now()
 }
 
 // Start launches the Python computer use subprocess
@@ -165,6 +235,7 @@ func (m *Manager) Stop() {
 	}
 
 	m.running = false
+	m.cached = nil
 	log.Println("Computer use subprocess stopped")
 }
 
@@ -182,7 +253,18 @@ func (m *Manager) Execute(cmd Command) (*Result, error) {
 		m.mu.Lock()
 	}
 
-	return m.sendCommand(cmd)
+	if !lookActions[cmd.Action] {
+		m.cached = nil // It may change the screen
+	} else if cmd.Action == "screenshot" {
+		if cached := m.cachedScreenshotLocked(); cached != nil {
+			return cached, nil
+		}
+	}
+	result, err := m.sendCommand(cmd)
+	if err == nil && cmd.Action == "screenshot" {
+		m.cacheScreenshotLocked(result)
+	}
+	return result, err
 }
 
 // sendCommand sends a command and reads the response
@@ -214,6 +296,9 @@ func (m *Manager) sendCommand(cmd Command) (*Result, error) {
 // as JSON to the Python subprocess. This ensures ALL Anthropic fields
 // (action, text, coordinate, scroll_direction, scroll_amount, etc.)
 // are passed through without needing Go struct mapping.
+//
+// A screenshot taken within the cache TTL of the last one is returned from
+// the cache (with Cached set) unless params has force: true.
 func (m *Manager) ExecuteRaw(params map[string]interface{}) (*Result, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -227,13 +312,33 @@ func (m *Manager) ExecuteRaw(params map[string]interface{}) (*Result, error) {
 		m.mu.Lock()
 	}
 
+	action, _ := params["action"].(string)
+	force, _ := params["force"].(bool)
+	if !lookActions[action] {
+		m.cached = nil // It may change the screen
+	} else if action == "screenshot" && !force {
+		if cached := m.cachedScreenshotLocked(); cached != nil {
+			return cached, nil
+		}
+	}
+	// force is only for the cache
+	if _, ok := params["force"]; ok {
+		forward := make(map[string]interface{}, len(params))
+		for k, v := range params {
+			if k != "force" {
+				forward[k] = v
+			}
+		}
+		params = forward
+	}
+
 	// Marshal the raw params directly - Python handles all field parsing
 	data, err := json.Marshal(params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode params: %w", err)
 	}
 
-	log.Printf("[computer] Sending raw params: action=%v", params["action"])
+	slog.Debug("[computer] Sending raw params", "action", params["action"])
 
 	if _, err := m.stdin.Write(append(data, '\n')); err != nil {
 		return nil, fmt.Errorf("failed to send command: %w", err)
@@ -249,5 +354,8 @@ func (m *Manager) ExecuteRaw(params map[string]interface{}) (*Result, error) {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	if action == "screenshot" {
+		m.cacheScreenshotLocked(&result)
+	}
 	return &result, nil
 }
@@ -0,0 +1,137 @@
+package computer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// ImageOptions says how to shrink a screenshot before it's sent.
+type ImageOptions struct {
+	MaxDimension int // Scale down so neither side exceeds this, keeping the aspect ratio (0 = keep size)
+	JPEGQuality  int // Re-encode as JPEG at this quality, 1-100 (0 = keep PNG)
+}
+
+// Enabled reports whether the options change anything.
+func (o ImageOptions) Enabled() bool {
+	return o.MaxDimension > 0 || o.JPEGQuality > 0
+}
+
+// ImageInfo describes a shrunk image.
+type ImageInfo struct {
+	MediaType      string
+	Width, Height  int
+	OriginalWidth  int
+	OriginalHeight int
+	OriginalBytes  int
+	Bytes          int
+}
+
+// ShrinkImage decodes a PNG or JPEG, scales it down to opts.MaxDimension and
+// re-encodes it as JPEG (if opts.JPEGQuality is set) or PNG. The original is
+// returned unchanged if it needs no scaling and re-encoding wouldn't make it
+// smaller.
+func ShrinkImage(data []byte, opts ImageOptions) ([]byte, ImageInfo, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ImageInfo{}, fmt.Errorf("decode image: %w", err)
+	}
+	bounds := src.Bounds()
+	info := ImageInfo{
+		MediaType:      "image/" + format,
+		Width:          bounds.Dx(),
+		Height:         bounds.Dy(),
+		OriginalWidth:  bounds.Dx(),
+		OriginalHeight: bounds.Dy(),
+		OriginalBytes:  len(data),
+		Bytes:          len(data),
+	}
+
+	img := src
+	w, h := fitWithin(bounds.Dx(), bounds.Dy(), opts.MaxDimension)
+	scaled := w != bounds.Dx() || h != bounds.Dy()
+	if scaled {
+		img = downscale(src, w, h)
+		info.Width, info.Height = w, h
+	} else if opts.JPEGQuality <= 0 {
+		return data, info, nil
+	}
+
+	var buf bytes.Buffer
+	if opts.JPEGQuality > 0 {
+		quality := opts.JPEGQuality
+		if quality > 100 {
+			quality = 100
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+		info.MediaType = "image/jpeg"
+	} else {
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+		info.MediaType = "image/png"
+	}
+	if err != nil {
+		return nil, ImageInfo{}, fmt.Errorf("encode image: %w", err)
+	}
+	if !scaled && buf.Len() >= len(data) {
+		info.MediaType = "image/" + format
+		return data, info, nil
+	}
+	info.Bytes = buf.Len()
+	return buf.Bytes(), info, nil
+}
+
+// fitWithin scales w x h down so neither side exceeds max.
+func fitWithin(w, h, max int) (int, int) {
+	if max <= 0 || (w <= max && h <= max) {
+		return w, h
+	}
+	if w >= h {
+		return max, maxInt(1, h*max/w)
+	}
+	return maxInt(1, w*max/h), max
+}
+
+// downscale resizes src to w x h by averaging the source pixels each
+// destination pixel covers, which keeps text legible when shrinking.
+func downscale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+	sw, sh := b.Dx(), b.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, maxInt((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, maxInt((x+1)*sw/w, x*sw/w+1)
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					bl += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -2,9 +2,12 @@ package config
 
 import (
 	"bufio"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // loadEnvFile loads environment variables from a .env file
@@ -46,15 +49,85 @@ type Config struct {
 	PrimeAddress string // TCP address to connect to Prime (e.g., "prime.example.com:50051")
 	PrimeURL     string // HTTP URL for Prime (legacy, for health checks)
 
+	// Connection timeouts
+	ReadTimeout   time.Duration // Read deadline on the Prime connection
+	WriteTimeout  time.Duration // Write deadline on the Prime connection
+	KeepAlive     time.Duration // TCP keepalive probe interval
+	MaxMissedAcks int           // Unacked heartbeats before reconnecting
+
+	// Message size limits on the Prime connection
+	MaxRecvBytes int
+	MaxSendBytes int
+
 	// Security
 	RegistrationKey string
-	TLSCertPath     string
+	TLSCertPath     string // Client certificate presented to Prime over TLS (optional)
 	TLSKeyPath      string
+	PrimeTransport  string // "tcp" (default) or "websocket"
+	PrimeWSURL      string // ws:// or wss:// URL of Prime's daemon WebSocket endpoint
+	PrimeTLS        bool   // Connect to Prime over TLS
+	PrimeTLSCA      string // CA bundle Prime's certificate must chain to (empty = system roots)
+	PrimeTLSName    string // Expected name on Prime's certificate (empty = host from PrimeAddress)
+	MessageMAC      bool   // HMAC every message to and from Prime (Prime must enable it too)
+	SourceAddr      string // Local IP (or IP:port) to connect to Prime from (empty = OS choice)
+	Proxy           string // HTTP or SOCKS5 proxy URL to reach Prime through (empty = HTTPS_PROXY/ALL_PROXY)
 
 	// Soul Daemon (daemon on Prime's server for self-modification)
 	IsSoulDaemon bool   // True if this daemon runs on Prime's server
 	UltronRoot   string // Root directory of Ultron installation
 
+	// Commands
+	MaxCommandTimeout time.Duration // Upper bound on a shell command's requested timeout
+	HandlerTimeout    time.Duration // Registry watchdog: longest wait on any handler
+	ShutdownTimeout   time.Duration // How long shutdown waits for running commands to finish
+	MaxConcurrent     int           // Commands from Prime run at once; as many again may queue (0 = unlimited)
+	ReadOnly          bool          // Refuse every command that could change the host
+
+	// Sessions
+	MaxSessions      int  // tmux sessions allowed at once (0 = unlimited)
+	SessionEvictIdle bool // At the limit, kill the least recently used session instead of failing
+
+	// Streaming
+	StreamBatchBytes    int           // Flush partial output once a batch reaches this many bytes
+	StreamFlushInterval time.Duration // ...or once this much time has passed
+
+	// Output redaction
+	RedactPatterns []string // Extra regexes masked in command output
+	RedactDefaults bool     // Keep the built-in patterns (AWS keys, bearer tokens, private keys)
+
+	// Logging
+	LogBufferLines int    // Recent log records kept in memory for get_logs
+	LogLevel       string // Initial log level (debug, info, warn, error)
+
+	// State
+	KVPath          string   // File backing the kv_* handlers
+	BackupDir       string   // Where backup_file keeps snapshots
+	BackupRetention int      // Snapshots kept per file (0 = all)
+	TrashDir        string   // Where delete_file quarantines what it deletes
+	ProtectedPaths  []string // Paths (globs allowed) deletes refuse to remove, nor anything in or containing them
+	DeletablePaths  []string // Directories (globs allowed) inside protected paths whose contents may be deleted
+	DeleteConfirm   int      // Items a recursive delete may remove before it needs a dry-run token (0 = never)
+
+	// Monitoring
+	ResourceInterval time.Duration // How often the resource monitor checks thresholds
+	CPUThreshold     float64       // Percent; cpu_high above this
+	MemThreshold     float64       // Percent; memory_high above this
+	DiskThreshold    float64       // Percent; disk_high above this
+	InodeThreshold   float64       // Percent; inodes_high above this
+	DiskPaths        []string      // Filesystems reported by system_info and the resource monitor
+	SnapshotInterval time.Duration // How often to emit system_snapshot events (0 disables)
+	SnapshotEnv      bool          // Include the redacted environment in snapshots
+	StructuredLogs   []string      // "path|format|match" specs for structured log tailers
+	TailFiles        []string      // "path|regex" specs for plain file tailers
+
+	// Screenshots (computer and browser_screenshot); commands can override
+	ScreenshotMaxDimension int           // Scale screenshots so neither side exceeds this (0 = keep size)
+	ScreenshotJPEGQuality  int           // Re-encode screenshots as JPEG at this quality, 1-100 (0 = keep PNG)
+	ScreenshotCacheTTL     time.Duration // Reuse a computer screenshot this long unless the screen may have changed (0 disables)
+
+	// Debugging
+	Debug bool // Register introspection handlers (list_handlers)
+
 	// Runtime
 	DaemonID string // Assigned by Prime after registration
 }
@@ -65,13 +138,13 @@ func Load(configPath string) (*Config, error) {
 	loadEnvFile(".env")
 	// Also try from daemon directory if run from elsewhere
 	loadEnvFile("daemon/.env")
-	
+
 	hostname, _ := os.Hostname()
 
 	// Default capabilities - full control
 	defaultCaps := []string{
 		"shell", "files", "docker", "services", "git", "network",
-		"process", "package", "cron", "session",
+		"process", "package", "cron", "session", "computer", "browser",
 	}
 
 	cfg := &Config{
@@ -80,11 +153,68 @@ func Load(configPath string) (*Config, error) {
 		Capabilities:    getEnvSlice("DAEMON_CAPABILITIES", defaultCaps),
 		PrimeAddress:    getEnv("PRIME_ADDRESS", "localhost:50051"),
 		PrimeURL:        getEnv("PRIME_URL", "http://localhost:8000"),
+		ReadTimeout:     time.Duration(getEnvInt("PRIME_READ_TIMEOUT", 60)) * time.Second,
+		WriteTimeout:    time.Duration(getEnvInt("PRIME_WRITE_TIMEOUT", 30)) * time.Second,
+		KeepAlive:       time.Duration(getEnvInt("PRIME_KEEPALIVE", 15)) * time.Second,
+		MaxMissedAcks:   getEnvInt("PRIME_MAX_MISSED_ACKS", 2),
+		MaxRecvBytes:    getEnvInt("PRIME_MAX_RECV_BYTES", 64*1024*1024),
+		MaxSendBytes:    getEnvInt("PRIME_MAX_SEND_BYTES", 64*1024*1024),
 		RegistrationKey: getEnv("DAEMON_REGISTRATION_KEY", ""),
 		TLSCertPath:     getEnv("DAEMON_TLS_CERT", ""),
 		TLSKeyPath:      getEnv("DAEMON_TLS_KEY", ""),
+		PrimeTransport:  getEnv("PRIME_TRANSPORT", "tcp"),
+		PrimeWSURL:      getEnv("PRIME_WS_URL", ""),
+		PrimeTLS:        getEnvBool("PRIME_TLS", false),
+		PrimeTLSCA:      getEnv("PRIME_TLS_CA", ""),
+		PrimeTLSName:    getEnv("PRIME_TLS_SERVER_NAME", ""),
+		MessageMAC:      getEnvBool("DAEMON_MESSAGE_MAC", false),
+		SourceAddr:      getEnv("DAEMON_SOURCE_ADDR", ""),
+		Proxy:           getEnv("DAEMON_PROXY", ""),
 		IsSoulDaemon:    getEnvBool("DAEMON_IS_SOUL", false),
 		UltronRoot:      getEnv("ULTRON_ROOT", ""),
+
+		MaxCommandTimeout: time.Duration(getEnvInt("DAEMON_MAX_COMMAND_TIMEOUT", 3600)) * time.Second,
+		HandlerTimeout:    time.Duration(getEnvInt("DAEMON_HANDLER_TIMEOUT", 600)) * time.Second,
+		ShutdownTimeout:   time.Duration(getEnvInt("DAEMON_SHUTDOWN_TIMEOUT", 30)) * time.Second,
+		ReadOnly:          getEnvBool("DAEMON_READONLY", false),
+		MaxConcurrent:     getEnvInt("DAEMON_MAX_CONCURRENT", 10),
+
+		MaxSessions:      getEnvInt("DAEMON_MAX_SESSIONS", 20),
+		SessionEvictIdle: getEnvBool("DAEMON_SESSION_EVICT_IDLE", false),
+
+		StreamBatchBytes:    getEnvInt("DAEMON_STREAM_BATCH_BYTES", 4096),
+		StreamFlushInterval: time.Duration(getEnvInt("DAEMON_STREAM_FLUSH_MS", 100)) * time.Millisecond,
+
+		RedactPatterns: getEnvSlice("DAEMON_REDACT_PATTERNS", nil),
+		RedactDefaults: getEnvBool("DAEMON_REDACT_DEFAULTS", true),
+
+		LogBufferLines: getEnvInt("DAEMON_LOG_BUFFER_LINES", 1000),
+		LogLevel:       getEnv("DAEMON_LOG_LEVEL", "info"),
+
+		KVPath:          getEnv("DAEMON_KV_PATH", defaultKVPath()),
+		BackupDir:       getEnv("DAEMON_BACKUP_DIR", defaultBackupDir()),
+		BackupRetention: getEnvInt("DAEMON_BACKUP_RETENTION", 10),
+		TrashDir:        getEnv("DAEMON_TRASH_DIR", defaultTrashDir()),
+		ProtectedPaths:  getEnvSlice("DAEMON_PROTECTED_PATHS", defaultProtectedPaths()),
+		DeletablePaths:  getEnvSlice("DAEMON_DELETABLE_PATHS", defaultDeletablePaths()),
+		DeleteConfirm:   getEnvInt("DAEMON_DELETE_CONFIRM_THRESHOLD", 100),
+
+		ResourceInterval: time.Duration(getEnvInt("DAEMON_RESOURCE_CHECK_INTERVAL", 30)) * time.Second,
+		CPUThreshold:     getEnvFloat("DAEMON_CPU_THRESHOLD", 80),
+		MemThreshold:     getEnvFloat("DAEMON_MEM_THRESHOLD", 85),
+		DiskThreshold:    getEnvFloat("DAEMON_DISK_THRESHOLD", 90),
+		InodeThreshold:   getEnvFloat("DAEMON_INODE_THRESHOLD", 90),
+		DiskPaths:        getEnvSlice("DAEMON_DISK_PATHS", []string{"/"}),
+		SnapshotInterval: time.Duration(getEnvInt("DAEMON_SNAPSHOT_INTERVAL", 300)) * time.Second,
+		SnapshotEnv:      getEnvBool("DAEMON_SNAPSHOT_INCLUDE_ENV", false),
+		StructuredLogs:   splitNonEmpty(getEnv("DAEMON_STRUCTURED_LOGS", ""), ";"),
+		TailFiles:        splitNonEmpty(getEnv("DAEMON_TAIL_FILES", ""), ";"),
+
+		ScreenshotMaxDimension: getEnvInt("DAEMON_SCREENSHOT_MAX_DIMENSION", 0),
+		ScreenshotJPEGQuality:  getEnvInt("DAEMON_SCREENSHOT_JPEG_QUALITY", 0),
+		ScreenshotCacheTTL:     time.Duration(getEnvInt("DAEMON_SCREENSHOT_CACHE_MS", 200)) * time.Millisecond,
+
+		Debug: getEnvBool("DAEMON_DEBUG", false),
 	}
 
 	// Soul daemon gets additional capabilities
@@ -92,9 +222,99 @@ func Load(configPath string) (*Config, error) {
 		cfg.Capabilities = append(cfg.Capabilities, "soul", "self-modify")
 	}
 
+	if err := cfg.validateMonitoring(); err != nil {
+		return nil, err
+	}
+	if cfg.ScreenshotMaxDimension < 0 {
+		return nil, fmt.Errorf("DAEMON_SCREENSHOT_MAX_DIMENSION must not be negative")
+	}
+	if cfg.ScreenshotJPEGQuality < 0 || cfg.ScreenshotJPEGQuality > 100 {
+		return nil, fmt.Errorf("DAEMON_SCREENSHOT_JPEG_QUALITY must be between 0 and 100, got %d", cfg.ScreenshotJPEGQuality)
+	}
+	if cfg.ScreenshotCacheTTL < 0 {
+		return nil, fmt.Errorf("DAEMON_SCREENSHOT_CACHE_MS must not be negative")
+	}
+
 	return cfg, nil
 }
 
+// minResourceInterval keeps the resource monitor from sampling constantly.
+const minResourceInterval = 5 * time.Second
+
+// validateMonitoring checks the resource monitor settings.
+func (c *Config) validateMonitoring() error {
+	if c.ResourceInterval < minResourceInterval {
+		return fmt.Errorf("DAEMON_RESOURCE_CHECK_INTERVAL must be at least %d seconds", int(minResourceInterval.Seconds()))
+	}
+	thresholds := []struct {
+		env   string
+		value float64
+	}{
+		{"DAEMON_CPU_THRESHOLD", c.CPUThreshold},
+		{"DAEMON_MEM_THRESHOLD", c.MemThreshold},
+		{"DAEMON_DISK_THRESHOLD", c.DiskThreshold},
+		{"DAEMON_INODE_THRESHOLD", c.InodeThreshold},
+	}
+	for _, t := range thresholds {
+		if t.value < 0 || t.value > 100 {
+			return fmt.Errorf("%s must be a percentage between 0 and 100, got %g", t.env, t.value)
+		}
+	}
+	return nil
+}
+
+// defaultKVPath keeps the kv store under the user's home directory.
+func defaultKVPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "ultron-kv.json")
+	}
+	return filepath.Join(home, ".ultron", "kv.json")
+}
+
+// defaultBackupDir keeps file backups next to the kv store.
+func defaultBackupDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "ultron-backups")
+	}
+	return filepath.Join(home, ".ultron", "backups")
+}
+
+// defaultProtectedPaths are system directories, nothing in which may be
+// deleted, and home directories. The filesystem root is always protected.
+func defaultProtectedPaths() []string {
+	paths := []string{
+		"/bin", "/boot", "/dev", "/etc", "/lib", "/lib64", "/opt", "/proc",
+		"/root", "/sbin", "/sys", "/usr", "/var",
+		"/home", "/home/*", "/Users", "/Users/*",
+		"/Applications", "/Library", "/System",
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, home)
+	}
+	return paths
+}
+
+// defaultDeletablePaths leave what's in home directories and /var/tmp
+// deletable, though not the directories themselves.
+func defaultDeletablePaths() []string {
+	paths := []string{"/home/*", "/Users/*", "/var/tmp"}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, home)
+	}
+	return paths
+}
+
+// defaultTrashDir keeps trashed files next to the backups.
+func defaultTrashDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "ultron-trash")
+	}
+	return filepath.Join(home, ".ultron", "trash")
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		lower := strings.ToLower(value)
@@ -119,6 +339,26 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+// splitNonEmpty splits s on sep, dropping blank entries.
+func splitNonEmpty(s, sep string) []string {
+	var out []string
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
 func getEnvSlice(key string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
 		return strings.Split(value, ",")
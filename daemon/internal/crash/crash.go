@@ -0,0 +1,52 @@
+// Package crash turns panics in long-lived goroutines into crash reports.
+// Without it a panic kills the daemon and Prime only sees a dropped connection.
+package crash
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"sync"
+)
+
+// Reporter delivers a crash report, e.g. as an alert to Prime. It should be
+// best-effort and return promptly; the process exits right after.
+type Reporter func(where, message string, stack []byte)
+
+var (
+	mu       sync.Mutex
+	reporter Reporter
+)
+
+// SetReporter installs the function called when a recovered panic is reported.
+func SetReporter(r Reporter) {
+	mu.Lock()
+	defer mu.Unlock()
+	reporter = r
+}
+
+// Recover must be deferred directly at the top of a goroutine:
+//
+//	defer crash.Recover("heartbeat")
+//
+// On panic it logs the stack, reports it, and exits the process.
+func Recover(where string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	stack := debug.Stack()
+	message := fmt.Sprint(r)
+	slog.Error("PANIC in "+where+": "+message, "stack", string(stack))
+
+	mu.Lock()
+	report := reporter
+	mu.Unlock()
+	if report != nil {
+		report(where, message, stack)
+	}
+
+	os.Exit(2)
+}
@@ -0,0 +1,267 @@
+package emitters
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Content diff limits for watches with TrackDiff
+const (
+	maxDiffFileSize = 1 << 20  // Larger files only report their size change
+	maxDiffBytes    = 64 << 10 // Diffs are truncated past this
+	maxDiffEdits    = 2000     // Give up on diffs changing more lines than this
+	diffContext     = 3        // Unchanged lines around each hunk
+)
+
+// fileSnapshot is what a TrackDiff watch remembers about a file between
+// changes. text is nil for binary files and files over maxDiffFileSize.
+type fileSnapshot struct {
+	size   int64
+	text   []byte
+	binary bool
+}
+
+// takeSnapshot reads path for a later diff; false if it's gone or a directory.
+func takeSnapshot(path string) (fileSnapshot, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return fileSnapshot{}, false
+	}
+	snap := fileSnapshot{size: info.Size()}
+	if info.Size() > maxDiffFileSize {
+		return snap, true
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snap, true
+	}
+	snap.size = int64(len(data))
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		snap.binary = true
+		return snap, true
+	}
+	snap.text = data
+	return snap, true
+}
+
+// addDiffLocked compares path with its last snapshot, adding the change to a
+// file_modified payload, and keeps the new content for next time.
+func (f *FileWatcher) addDiffLocked(path string, payload map[string]interface{}) {
+	prev, had := f.snapshots[path]
+	cur, ok := takeSnapshot(path)
+	if !ok {
+		delete(f.snapshots, path)
+		return
+	}
+	f.snapshots[path] = cur
+	if !had {
+		return // Nothing to compare with yet
+	}
+
+	payload["previous_size"] = prev.size
+	payload["size"] = cur.size
+	switch {
+	case prev.binary || cur.binary:
+		payload["binary"] = true
+	case prev.text == nil || cur.text == nil:
+		payload["diff_skipped"] = fmt.Sprintf("larger than %d bytes", maxDiffFileSize)
+	default:
+		diff, ok := unifiedDiff(path, prev.text, cur.text)
+		if !ok {
+			payload["diff_skipped"] = "too many changed lines"
+			return
+		}
+		if len(diff) > maxDiffBytes {
+			diff = diff[:maxDiffBytes]
+			payload["diff_truncated"] = true
+		}
+		payload["diff"] = diff
+	}
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added.
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff returns the unified diff from old to new, or false if they
+// differ in more than maxDiffEdits lines.
+func unifiedDiff(name string, old, new []byte) (string, bool) {
+	a, b := splitLines(old), splitLines(new)
+	ops, ok := diffLines(a, b)
+	if !ok {
+		return "", false
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a%s\n+++ b%s\n", name, name)
+
+	// Line numbers (1-based) of the next old and new line before each op
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	aLine[0], bLine[0] = 1, 1
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.kind != '+' {
+			aLine[i+1]++
+		}
+		if op.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while the next change is within two contexts
+		last := i
+		for j := i + 1; j < len(ops) && j <= last+2*diffContext; j++ {
+			if ops[j].kind != ' ' {
+				last = j
+			}
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := last + diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		aStart, bStart := aLine[start], bLine[start]
+		aCount, bCount := aLine[end]-aStart, bLine[end]-bStart
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.text)
+			sb.WriteByte('\n')
+		}
+		i = end
+	}
+	return sb.String(), true
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLines finds a shortest edit script from a to b (Myers' algorithm).
+// Common leading and trailing lines are matched up front, so the cost
+// depends on the size of the change rather than of the file.
+func diffLines(a, b []string) ([]diffOp, bool) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	middle, ok := myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if !ok {
+		return nil, false
+	}
+	ops = append(ops, middle...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops, true
+}
+
+func myers(a, b []string) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil, true
+	}
+	v := make([]int, 2*max+2)
+	// trace[d] holds v[-d..d] as it was before round d, for backtracking
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		if d > maxDiffEdits {
+			return nil, false
+		}
+		snap := make([]int, 2*d+1)
+		copy(snap, v[max-d:max+d+1])
+		trace = append(trace, snap)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1] // Down: insert from b
+			} else {
+				x = v[max+k-1] + 1 // Right: delete from a
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func backtrack(trace [][]int, a, b []string) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if prevK == k+1 {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x--
+		y--
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
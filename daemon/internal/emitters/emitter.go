@@ -5,16 +5,21 @@ package emitters
 import (
 	"context"
 	"log"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/ultron/daemon/internal/crash"
 )
 
 // Event represents something that happened on the daemon.
 type Event struct {
-	Source    string                 `json:"source"`     // e.g., "daemon:macbook"
-	Type      string                 `json:"type"`       // e.g., "file_changed", "cpu_high"
-	Payload   map[string]interface{} `json:"payload"`    // Event data
+	Source    string                 `json:"source"`  // e.g., "daemon:macbook"
+	Type      string                 `json:"type"`    // e.g., "file_changed", "cpu_high"
+	Payload   map[string]interface{} `json:"payload"` // Event data
 	Timestamp time.Time              `json:"timestamp"`
+	Seq       uint64                 `json:"seq"` // Assigned by Manager.Emit, increasing per manager
 }
 
 // EventCallback is called when an event is emitted.
@@ -27,6 +32,19 @@ type Emitter interface {
 	Name() string
 }
 
+// Delivery limits
+const (
+	maxPendingEvents = 10000 // Events held while emitters reload
+	eventWorkers     = 8     // Goroutines running event callbacks
+	eventQueueSize   = 1000  // Deliveries queued before events are dropped
+)
+
+// delivery is one event waiting to be passed to one callback.
+type delivery struct {
+	cb    EventCallback
+	event Event
+}
+
 // Manager manages all emitters and routes events.
 type Manager struct {
 	emitters  []Emitter
@@ -34,6 +52,20 @@ type Manager struct {
 	mu        sync.RWMutex
 	ctx       context.Context
 	cancel    context.CancelFunc
+
+	// While reloading, events are held in pending and flushed afterwards
+	reloading bool
+	pending   []Event
+	dropped   int
+
+	// Callbacks run on a fixed pool so event storms can't spawn unbounded goroutines
+	queue        chan delivery
+	workersOnce  sync.Once
+	queueDropped atomic.Int64
+
+	// Ordered callbacks each get their own queue drained by a single goroutine
+	ordered []chan Event
+	seq     uint64
 }
 
 // NewManager creates a new emitter manager.
@@ -41,6 +73,7 @@ func NewManager() *Manager {
 	return &Manager{
 		emitters:  make([]Emitter, 0),
 		callbacks: make([]EventCallback, 0),
+		queue:     make(chan delivery, eventQueueSize),
 	}
 }
 
@@ -51,54 +84,179 @@ func (m *Manager) AddEmitter(e Emitter) {
 	m.emitters = append(m.emitters, e)
 }
 
-// OnEvent registers a callback for events.
+// OnEvent registers a callback for events. This is the default delivery
+// mode: callbacks run concurrently on a shared worker pool, so they may see
+// events out of order. Use OnEventOrdered when order matters.
 func (m *Manager) OnEvent(callback EventCallback) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.callbacks = append(m.callbacks, callback)
 }
 
-// Emit sends an event to all callbacks.
+// OnEventOrdered registers a callback that receives events one at a time in
+// Seq order, e.g. a file's create before its delete.
+func (m *Manager) OnEventOrdered(callback EventCallback) {
+	ch := make(chan Event, eventQueueSize)
+	go func() {
+		defer crash.Recover("ordered event callback")
+		for event := range ch {
+			callback(event)
+		}
+	}()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ordered = append(m.ordered, ch)
+}
+
+// Emit sends an event to all callbacks. During a reload the event is held
+// and delivered once the new emitters are running.
 func (m *Manager) Emit(event Event) {
-	m.mu.RLock()
+	m.mu.Lock()
+	m.seq++
+	event.Seq = m.seq
+	if m.reloading {
+		if len(m.pending) < maxPendingEvents {
+			m.pending = append(m.pending, event)
+		} else {
+			m.dropped++
+		}
+		m.mu.Unlock()
+		return
+	}
+	m.enqueueOrderedLocked(event)
 	callbacks := m.callbacks
-	m.mu.RUnlock()
+	m.mu.Unlock()
+
+	m.dispatch(callbacks, event)
+}
+
+// enqueueOrderedLocked hands event to the ordered callbacks. It runs under
+// m.mu so queue order matches Seq order.
+func (m *Manager) enqueueOrderedLocked(event Event) {
+	for _, ch := range m.ordered {
+		select {
+		case ch <- event:
+		default:
+			m.countDropped(event)
+		}
+	}
+}
 
+// dispatch queues event for the unordered callbacks on the worker pool.
+func (m *Manager) dispatch(callbacks []EventCallback, event Event) {
+	m.workersOnce.Do(m.startWorkers)
 	for _, cb := range callbacks {
-		go cb(event)
+		select {
+		case m.queue <- delivery{cb: cb, event: event}:
+		default:
+			// Queue full - drop rather than block the emitter
+			m.countDropped(event)
+		}
+	}
+}
+
+func (m *Manager) countDropped(event Event) {
+	if n := m.queueDropped.Add(1); n == 1 || n%1000 == 0 {
+		slog.Warn("Event queue full, dropping events", "dropped", n, "latest", event.Type)
+	}
+}
+
+// DroppedEvents returns how many deliveries were dropped because the queue was full.
+func (m *Manager) DroppedEvents() int64 {
+	return m.queueDropped.Load()
+}
+
+func (m *Manager) startWorkers() {
+	for i := 0; i < eventWorkers; i++ {
+		go func() {
+			defer crash.Recover("event callback")
+			for d := range m.queue {
+				d.cb(d.event)
+			}
+		}()
 	}
 }
 
 // Start starts all emitters.
 func (m *Manager) Start() error {
-	m.ctx, m.cancel = context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
 
-	m.mu.RLock()
+	m.mu.Lock()
+	m.ctx, m.cancel = ctx, cancel
 	emitters := m.emitters
-	m.mu.RUnlock()
+	m.mu.Unlock()
+
+	startEmitters(ctx, emitters)
+	return nil
+}
+
+// Reload stops the current emitters and starts replacements. Events emitted
+// in between (including by the old emitters as they shut down) are buffered
+// and delivered after the new emitters have started, so nothing is lost.
+func (m *Manager) Reload(emitters []Emitter) error {
+	m.mu.Lock()
+	m.reloading = true
+	old, cancel := m.emitters, m.cancel
+	m.mu.Unlock()
 
+	if cancel != nil {
+		cancel()
+	}
+	for _, e := range old {
+		e.Stop()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.emitters = emitters
+	m.ctx, m.cancel = ctx, cancel
+	m.mu.Unlock()
+
+	startEmitters(ctx, emitters)
+
+	m.mu.Lock()
+	pending, dropped := m.pending, m.dropped
+	m.pending, m.dropped = nil, 0
+	for _, event := range pending {
+		m.enqueueOrderedLocked(event)
+	}
+	m.reloading = false
+	callbacks := m.callbacks
+	m.mu.Unlock()
+
+	log.Printf("Reloaded %d emitters, flushing %d buffered events", len(emitters), len(pending))
+	if dropped > 0 {
+		slog.Warn("Dropped events during reload (buffer full)", "dropped", dropped)
+	}
+	for _, event := range pending {
+		m.dispatch(callbacks, event)
+	}
+	return nil
+}
+
+func startEmitters(ctx context.Context, emitters []Emitter) {
 	for _, e := range emitters {
 		log.Printf("Starting emitter: %s", e.Name())
 		go func(emitter Emitter) {
-			if err := emitter.Start(m.ctx); err != nil {
-				log.Printf("Emitter %s error: %v", emitter.Name(), err)
+			defer crash.Recover("emitter " + emitter.Name())
+			if err := emitter.Start(ctx); err != nil && err != context.Canceled {
+				slog.Error("Emitter failed", "emitter", emitter.Name(), "error", err)
 			}
 		}(e)
 	}
-
-	return nil
 }
 
 // Stop stops all emitters.
 func (m *Manager) Stop() error {
-	if m.cancel != nil {
-		m.cancel()
-	}
-
 	m.mu.RLock()
-	emitters := m.emitters
+	cancel, emitters := m.cancel, m.emitters
 	m.mu.RUnlock()
 
+	if cancel != nil {
+		cancel()
+	}
+
 	for _, e := range emitters {
 		e.Stop()
 	}
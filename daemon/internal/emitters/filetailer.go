@@ -0,0 +1,88 @@
+// File tailer emitter - emits each line appended to a file.
+package emitters
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+)
+
+// FileTailer follows a file from its current end and emits a log_line event
+// for every appended line, optionally only those matching a regex. Truncation
+// and rotation are handled by reopening, as for structured log tailers.
+type FileTailer struct {
+	manager    *Manager
+	daemonName string
+	path       string
+	filter     *regexp.Regexp
+	interval   time.Duration
+}
+
+// NewFileTailer creates a tailer for path. An empty filter emits every line.
+func NewFileTailer(manager *Manager, daemonName, path, filter string) (*FileTailer, error) {
+	t := &FileTailer{
+		manager:    manager,
+		daemonName: daemonName,
+		path:       path,
+		interval:   time.Second,
+	}
+	if filter != "" {
+		re, err := regexp.Compile(filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+		t.filter = re
+	}
+	return t, nil
+}
+
+// Name returns the emitter name.
+func (t *FileTailer) Name() string {
+	return "file_tail:" + t.path
+}
+
+// Start follows the file until ctx is done.
+func (t *FileTailer) Start(ctx context.Context) error {
+	tail := newTailFile(t.path)
+	defer tail.close()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			lines, err := tail.poll()
+			if err != nil {
+				slog.Error("File tail failed", "path", t.path, "error", err)
+			}
+			for _, line := range lines {
+				t.handleLine(line)
+			}
+		}
+	}
+}
+
+// Stop stops the tailer.
+func (t *FileTailer) Stop() error {
+	return nil
+}
+
+func (t *FileTailer) handleLine(line string) {
+	if t.filter != nil && !t.filter.MatchString(line) {
+		return
+	}
+	t.manager.Emit(Event{
+		Source:    "daemon:" + t.daemonName,
+		Type:      "log_line",
+		Timestamp: time.Now(),
+		Payload: map[string]interface{}{
+			"path": t.path,
+			"line": line,
+		},
+	})
+}
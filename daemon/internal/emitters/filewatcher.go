@@ -1,13 +1,24 @@
 // File watcher emitter - watches files/directories for changes.
+//
+// Changes are delivered as they happen through fsnotify (inotify, kqueue,
+// ReadDirectoryChangesW). Where that isn't available, or a watch can't be
+// added (e.g. the inotify watch limit is reached), the watcher falls back to
+// rescanning every interval.
 package emitters
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 // FileWatch represents a watched file or directory.
@@ -16,6 +27,7 @@ type FileWatch struct {
 	Recursive bool
 	Pattern   string // Optional glob pattern
 	EventMask uint32 // What events to watch (create, modify, delete)
+	TrackDiff bool   // Include a diff of small text files in file_modified (see diff.go)
 }
 
 // Event masks
@@ -31,10 +43,14 @@ type FileWatcher struct {
 	manager    *Manager
 	daemonName string
 	watches    map[string]*FileWatch
-	fileStates map[string]time.Time // Track mod times
+	fileStates map[string]os.FileInfo  // Last seen info, for mod times and deletions
+	snapshots  map[string]fileSnapshot // Last content of files under TrackDiff watches
 	mu         sync.RWMutex
 	interval   time.Duration
 	running    bool
+
+	notify      *fsnotify.Watcher // nil when polling
+	watchedDirs map[string]bool   // Directories added to notify
 }
 
 // NewFileWatcher creates a new file watcher.
@@ -43,7 +59,8 @@ func NewFileWatcher(manager *Manager, daemonName string) *FileWatcher {
 		manager:    manager,
 		daemonName: daemonName,
 		watches:    make(map[string]*FileWatch),
-		fileStates: make(map[string]time.Time),
+		fileStates: make(map[string]os.FileInfo),
+		snapshots:  make(map[string]fileSnapshot),
 		interval:   5 * time.Second,
 	}
 }
@@ -53,8 +70,19 @@ func (f *FileWatcher) Name() string {
 	return "file_watcher"
 }
 
-// Watch adds a path to watch.
+// Watch adds a path to watch for all events.
 func (f *FileWatcher) Watch(path string, recursive bool, pattern string) error {
+	return f.WatchEvents(path, recursive, pattern, EventAll)
+}
+
+// WatchEvents adds a path to watch for the events in mask (EventCreate,
+// EventModify and/or EventDelete), e.g. EventDelete alone to notice a
+// critical file being removed without hearing about every edit.
+func (f *FileWatcher) WatchEvents(path string, recursive bool, pattern string, mask uint32) error {
+	if mask&EventAll == 0 {
+		return fmt.Errorf("no events selected for %s", path)
+	}
+
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
@@ -67,10 +95,40 @@ func (f *FileWatcher) Watch(path string, recursive bool, pattern string) error {
 		Path:      absPath,
 		Recursive: recursive,
 		Pattern:   pattern,
-		EventMask: EventAll,
+		EventMask: mask & EventAll,
+	}
+
+	log.Printf("Watching: %s (recursive=%v, pattern=%s, events=%s)", absPath, recursive, pattern, eventMaskString(mask))
+	if f.notify != nil {
+		f.syncNotifyLocked()
+	}
+	return nil
+}
+
+// TrackDiff turns content diffs in file_modified events on or off for the
+// watch on path. Only text files up to maxDiffFileSize are diffed; binary and
+// larger files report their previous and new size.
+func (f *FileWatcher) TrackDiff(path string, enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	absPath, _ := filepath.Abs(path)
+	watch, ok := f.watches[absPath]
+	if !ok {
+		return fmt.Errorf("not watching %s", absPath)
 	}
+	watch.TrackDiff = enabled
 
-	log.Printf("Watching: %s (recursive=%v, pattern=%s)", absPath, recursive, pattern)
+	// Start from what the files hold now
+	for p := range f.fileStates {
+		if watch.covers(p, false) {
+			if enabled {
+				f.snapshotLocked(p)
+			} else {
+				delete(f.snapshots, p)
+			}
+		}
+	}
 	return nil
 }
 
@@ -81,6 +139,9 @@ func (f *FileWatcher) Unwatch(path string) {
 
 	absPath, _ := filepath.Abs(path)
 	delete(f.watches, absPath)
+	if f.notify != nil {
+		f.syncNotifyLocked()
+	}
 }
 
 // Start begins watching.
@@ -90,6 +151,51 @@ func (f *FileWatcher) Start(ctx context.Context) error {
 	// Initial scan to get baseline
 	f.scan()
 
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Warn("File watcher: fsnotify unavailable, polling", "interval", f.interval, "error", err)
+		return f.poll(ctx)
+	}
+	f.mu.Lock()
+	f.notify = notify
+	f.watchedDirs = make(map[string]bool)
+	f.syncNotifyLocked()
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		if f.notify != nil {
+			f.notify.Close()
+			f.notify = nil
+		}
+		f.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-notify.Events:
+			if !ok {
+				// Closed by fallBackToPolling
+				return f.poll(ctx)
+			}
+			f.handleNotify(event)
+		case err, ok := <-notify.Errors:
+			if !ok {
+				return f.poll(ctx)
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Events were dropped; rescan to catch up
+				f.scan()
+				continue
+			}
+			slog.Error("File watcher failed", "error", err)
+		}
+	}
+}
+
+// poll rescans every interval until ctx is done.
+func (f *FileWatcher) poll(ctx context.Context) error {
 	ticker := time.NewTicker(f.interval)
 	defer ticker.Stop()
 
@@ -117,7 +223,7 @@ func (f *FileWatcher) scan() {
 	}
 	f.mu.RUnlock()
 
-	newStates := make(map[string]time.Time)
+	newStates := make(map[string]os.FileInfo)
 
 	for _, watch := range watches {
 		f.scanPath(watch, newStates)
@@ -128,28 +234,30 @@ func (f *FileWatcher) scan() {
 	defer f.mu.Unlock()
 
 	// Check for modifications and creations
-	for path, modTime := range newStates {
-		oldTime, exists := f.fileStates[path]
+	for path, info := range newStates {
+		old, exists := f.fileStates[path]
 		if !exists {
 			// New file
-			f.emitEvent("file_created", path, nil)
-		} else if modTime.After(oldTime) {
+			f.emitEvent("file_created", path, info)
+			f.snapshotLocked(path)
+		} else if info.ModTime().After(old.ModTime()) {
 			// Modified
-			f.emitEvent("file_modified", path, nil)
+			f.emitModifiedLocked(path, info)
 		}
 	}
 
-	// Check for deletions
-	for path := range f.fileStates {
+	// Check for deletions, reporting what the file was when last seen
+	for path, old := range f.fileStates {
 		if _, exists := newStates[path]; !exists {
-			f.emitEvent("file_deleted", path, nil)
+			f.emitEvent("file_deleted", path, old)
+			delete(f.snapshots, path)
 		}
 	}
 
 	f.fileStates = newStates
 }
 
-func (f *FileWatcher) scanPath(watch *FileWatch, states map[string]time.Time) {
+func (f *FileWatcher) scanPath(watch *FileWatch, states map[string]os.FileInfo) {
 	if watch.Recursive {
 		filepath.Walk(watch.Path, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
@@ -160,7 +268,7 @@ func (f *FileWatcher) scanPath(watch *FileWatch, states map[string]time.Time) {
 					return nil
 				}
 			}
-			states[path] = info.ModTime()
+			states[path] = info
 			return nil
 		})
 	} else {
@@ -185,7 +293,7 @@ func (f *FileWatcher) scanPath(watch *FileWatch, states map[string]time.Time) {
 					continue
 				}
 				path := filepath.Join(watch.Path, entry.Name())
-				states[path] = entryInfo.ModTime()
+				states[path] = entryInfo
 			}
 		} else {
 			if watch.Pattern != "" {
@@ -193,12 +301,79 @@ func (f *FileWatcher) scanPath(watch *FileWatch, states map[string]time.Time) {
 					return
 				}
 			}
-			states[watch.Path] = info.ModTime()
+			states[watch.Path] = info
+		}
+	}
+}
+
+// eventBits maps event types to the EventMask bit that selects them.
+var eventBits = map[string]uint32{
+	"file_created":  EventCreate,
+	"file_modified": EventModify,
+	"file_deleted":  EventDelete,
+}
+
+func eventMaskString(mask uint32) string {
+	var names []string
+	for _, t := range []string{"file_created", "file_modified", "file_deleted"} {
+		if mask&eventBits[t] != 0 {
+			names = append(names, strings.TrimPrefix(t, "file_"))
 		}
 	}
+	return strings.Join(names, ",")
 }
 
+// wantsLocked reports whether a watch covering path selected eventType.
+func (f *FileWatcher) wantsLocked(eventType, path string) bool {
+	for _, watch := range f.watches {
+		if watch.EventMask&eventBits[eventType] != 0 && watch.covers(path, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// emitEvent emits eventType for path if a watch covering it selected it.
 func (f *FileWatcher) emitEvent(eventType, path string, info os.FileInfo) {
+	if !f.wantsLocked(eventType, path) {
+		return
+	}
+	f.emitPayload(eventType, filePayload(path, info))
+}
+
+// emitModifiedLocked emits file_modified, with what changed if path is under
+// a TrackDiff watch.
+func (f *FileWatcher) emitModifiedLocked(path string, info os.FileInfo) {
+	if !f.wantsLocked("file_modified", path) {
+		return
+	}
+	payload := filePayload(path, info)
+	if f.tracksDiffLocked(path) {
+		f.addDiffLocked(path, payload)
+	}
+	f.emitPayload("file_modified", payload)
+}
+
+// snapshotLocked remembers path's content if it's under a TrackDiff watch.
+func (f *FileWatcher) snapshotLocked(path string) {
+	if !f.tracksDiffLocked(path) {
+		return
+	}
+	if snap, ok := takeSnapshot(path); ok {
+		f.snapshots[path] = snap
+	}
+}
+
+func (f *FileWatcher) tracksDiffLocked(path string) bool {
+	for _, watch := range f.watches {
+		if watch.TrackDiff && watch.covers(path, false) {
+			return true
+		}
+	}
+	return false
+}
+
+func filePayload(path string, info os.FileInfo) map[string]interface{} {
 	payload := map[string]interface{}{
 		"path": path,
 	}
@@ -208,7 +383,10 @@ func (f *FileWatcher) emitEvent(eventType, path string, info os.FileInfo) {
 		payload["is_dir"] = info.IsDir()
 		payload["mod_time"] = info.ModTime().UTC().Format(time.RFC3339)
 	}
+	return payload
+}
 
+func (f *FileWatcher) emitPayload(eventType string, payload map[string]interface{}) {
 	f.manager.Emit(Event{
 		Source:    "daemon:" + f.daemonName,
 		Type:      eventType,
@@ -216,3 +394,147 @@ func (f *FileWatcher) emitEvent(eventType, path string, info os.FileInfo) {
 		Payload:   payload,
 	})
 }
+
+// syncNotifyLocked adds the directories the watches need to notify and
+// removes those no longer needed. A watched file is followed through its
+// parent directory, so replacing it (as editors do) is seen too.
+func (f *FileWatcher) syncNotifyLocked() {
+	wanted := make(map[string]bool)
+	for _, watch := range f.watches {
+		info, err := os.Stat(watch.Path)
+		switch {
+		case err != nil || !info.IsDir():
+			// A file, or not there yet: its directory reports it appearing
+			wanted[filepath.Dir(watch.Path)] = true
+		case watch.Recursive:
+			filepath.Walk(watch.Path, func(path string, info os.FileInfo, err error) error {
+				if err == nil && info.IsDir() {
+					wanted[path] = true
+				}
+				return nil
+			})
+		default:
+			wanted[watch.Path] = true
+		}
+	}
+
+	for dir := range wanted {
+		if f.watchedDirs[dir] {
+			continue
+		}
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := f.notify.Add(dir); err != nil {
+			f.fallBackToPollingLocked(err)
+			return
+		}
+		f.watchedDirs[dir] = true
+	}
+	for dir := range f.watchedDirs {
+		if !wanted[dir] {
+			f.notify.Remove(dir)
+			delete(f.watchedDirs, dir)
+		}
+	}
+}
+
+// fallBackToPollingLocked gives up on fsnotify; Start's loop sees the
+// closed channels and polls instead.
+func (f *FileWatcher) fallBackToPollingLocked(err error) {
+	slog.Warn("File watcher: can't watch with fsnotify, polling", "interval", f.interval, "error", err)
+	f.notify.Close()
+	f.notify = nil
+	f.watchedDirs = nil
+}
+
+// handleNotify turns an fsnotify event into the same events scan emits.
+func (f *FileWatcher) handleNotify(event fsnotify.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := event.Name
+	switch {
+	case event.Has(fsnotify.Create) || event.Has(fsnotify.Write):
+		info, err := os.Stat(path)
+		if err != nil {
+			return // Already gone again
+		}
+		if f.coveredLocked(path, info) {
+			old, existed := f.fileStates[path]
+			f.fileStates[path] = info
+			if !existed {
+				f.emitEvent("file_created", path, info)
+				f.snapshotLocked(path)
+			} else if info.ModTime().After(old.ModTime()) {
+				f.emitModifiedLocked(path, info)
+			}
+		}
+		if info.IsDir() && event.Has(fsnotify.Create) && f.notify != nil {
+			// Watch a new subdirectory and report what was created in it
+			// before the watch was in place
+			f.syncNotifyLocked()
+			filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+				if err != nil || p == path {
+					return nil
+				}
+				if _, seen := f.fileStates[p]; !seen && f.coveredLocked(p, info) {
+					f.fileStates[p] = info
+					f.emitEvent("file_created", p, info)
+					f.snapshotLocked(p)
+				}
+				return nil
+			})
+		}
+
+	case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+		// A rename reports the old name; the new one arrives as a Create
+		prefix := path + string(filepath.Separator)
+		for p, old := range f.fileStates {
+			if p == path || strings.HasPrefix(p, prefix) {
+				delete(f.fileStates, p)
+				delete(f.snapshots, p)
+				f.emitEvent("file_deleted", p, old)
+			}
+		}
+		if f.watchedDirs != nil {
+			for dir := range f.watchedDirs {
+				if dir == path || strings.HasPrefix(dir, prefix) {
+					delete(f.watchedDirs, dir) // The kernel dropped these watches
+				}
+			}
+		}
+	}
+}
+
+// coveredLocked reports whether scanPath would record path for some watch.
+func (f *FileWatcher) coveredLocked(path string, info os.FileInfo) bool {
+	for _, watch := range f.watches {
+		if watch.covers(path, info.IsDir()) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether scanPath records path for this watch.
+func (w *FileWatch) covers(path string, isDir bool) bool {
+	var inScope bool
+	switch {
+	case w.Recursive:
+		inScope = path == w.Path || strings.HasPrefix(path, w.Path+string(filepath.Separator))
+	case path == w.Path:
+		inScope = !isDir // A watched directory reports its entries, not itself
+	default:
+		inScope = filepath.Dir(path) == w.Path
+	}
+	if !inScope {
+		return false
+	}
+	if w.Pattern != "" {
+		if matched, _ := filepath.Match(w.Pattern, filepath.Base(path)); !matched {
+			return false
+		}
+	}
+	return true
+}
@@ -3,11 +3,12 @@ package emitters
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"os"
 	"runtime"
-	"syscall"
 	"time"
+
+	"github.com/ultron/daemon/internal/executor"
 )
 
 // ResourceMonitor monitors system resources and emits events on thresholds.
@@ -18,23 +19,29 @@ type ResourceMonitor struct {
 	cpuThreshold   float64
 	memThreshold   float64
 	diskThreshold  float64
+	inodeThreshold float64
 	lastCPUAlert   time.Time
 	lastMemAlert   time.Time
-	lastDiskAlert  time.Time
+	lastDiskAlert  map[string]time.Time // Per monitored path
+	lastInodeAlert map[string]time.Time // Per monitored path
 	alertCooldown  time.Duration
 	running        bool
+	cpu            executor.CPUSampler // CPU usage is measured over each check interval
 }
 
 // NewResourceMonitor creates a new resource monitor.
 func NewResourceMonitor(manager *Manager, daemonName string) *ResourceMonitor {
 	return &ResourceMonitor{
-		manager:       manager,
-		daemonName:    daemonName,
-		checkInterval: 30 * time.Second,
-		cpuThreshold:  80.0,  // Alert if CPU > 80%
-		memThreshold:  85.0,  // Alert if memory > 85%
-		diskThreshold: 90.0,  // Alert if disk > 90%
-		alertCooldown: 5 * time.Minute,
+		manager:        manager,
+		daemonName:     daemonName,
+		checkInterval:  30 * time.Second,
+		cpuThreshold:   80.0, // Alert if CPU > 80%
+		memThreshold:   85.0, // Alert if memory > 85%
+		diskThreshold:  90.0, // Alert if disk > 90%
+		inodeThreshold: 90.0, // Alert if inodes > 90% used
+		alertCooldown:  5 * time.Minute,
+		lastDiskAlert:  make(map[string]time.Time),
+		lastInodeAlert: make(map[string]time.Time),
 	}
 }
 
@@ -45,6 +52,19 @@ func (r *ResourceMonitor) SetThresholds(cpu, mem, disk float64) {
 	r.diskThreshold = disk
 }
 
+// SetCheckInterval sets how often thresholds are checked. It takes effect
+// on the next Start.
+func (r *ResourceMonitor) SetCheckInterval(interval time.Duration) {
+	if interval > 0 {
+		r.checkInterval = interval
+	}
+}
+
+// SetInodeThreshold sets the inode usage alert threshold.
+func (r *ResourceMonitor) SetInodeThreshold(percent float64) {
+	r.inodeThreshold = percent
+}
+
 // Name returns the emitter name.
 func (r *ResourceMonitor) Name() string {
 	return "resource_monitor"
@@ -53,6 +73,7 @@ func (r *ResourceMonitor) Name() string {
 // Start begins monitoring.
 func (r *ResourceMonitor) Start(ctx context.Context) error {
 	r.running = true
+	r.cpu.Percent() // First sample, so the first check covers a full interval
 	ticker := time.NewTicker(r.checkInterval)
 	defer ticker.Stop()
 
@@ -74,52 +95,74 @@ func (r *ResourceMonitor) Stop() error {
 
 func (r *ResourceMonitor) check() {
 	now := time.Now()
+	stats := executor.GetHostStatsSampled(&r.cpu)
 
-	// Check memory
-	var memStats runtime.MemStats
-	runtime.ReadMemStats(&memStats)
-
-	// This is a simplified memory check - in production you'd use cgroups or /proc
-	memPercent := float64(memStats.Alloc) / float64(memStats.Sys) * 100
+	if stats.CPUPercent > r.cpuThreshold && now.Sub(r.lastCPUAlert) > r.alertCooldown {
+		r.lastCPUAlert = now
+		r.manager.Emit(Event{
+			Source:    "daemon:" + r.daemonName,
+			Type:      "cpu_high",
+			Timestamp: now,
+			Payload: map[string]interface{}{
+				"percent":   stats.CPUPercent,
+				"threshold": r.cpuThreshold,
+				"num_cpu":   runtime.NumCPU(),
+			},
+		})
+		slog.Warn("CPU alert", "percent", stats.CPUPercent, "threshold", r.cpuThreshold)
+	}
 
-	if memPercent > r.memThreshold && now.Sub(r.lastMemAlert) > r.alertCooldown {
+	if stats.MemoryPercent > r.memThreshold && now.Sub(r.lastMemAlert) > r.alertCooldown {
 		r.lastMemAlert = now
 		r.manager.Emit(Event{
 			Source:    "daemon:" + r.daemonName,
 			Type:      "memory_high",
 			Timestamp: now,
 			Payload: map[string]interface{}{
-				"percent":   memPercent,
+				"percent":   stats.MemoryPercent,
 				"threshold": r.memThreshold,
-				"alloc":     memStats.Alloc,
-				"sys":       memStats.Sys,
+				"total":     stats.Memory.Total,
+				"available": stats.Memory.Available,
 			},
 		})
-		log.Printf("Memory alert: %.1f%% > %.1f%%", memPercent, r.memThreshold)
+		slog.Warn("Memory alert", "percent", stats.MemoryPercent, "threshold", r.memThreshold)
 	}
 
-	// Check disk
-	var stat syscall.Statfs_t
-	if err := syscall.Statfs("/", &stat); err == nil {
-		diskTotal := stat.Blocks * uint64(stat.Bsize)
-		diskFree := stat.Bfree * uint64(stat.Bsize)
-		diskUsed := diskTotal - diskFree
-		diskPercent := float64(diskUsed) / float64(diskTotal) * 100
-
-		if diskPercent > r.diskThreshold && now.Sub(r.lastDiskAlert) > r.alertCooldown {
-			r.lastDiskAlert = now
+	// Check each monitored disk
+	for path, usage := range stats.Disks {
+		if usage.Percent > r.diskThreshold && now.Sub(r.lastDiskAlert[path]) > r.alertCooldown {
+			r.lastDiskAlert[path] = now
 			r.manager.Emit(Event{
 				Source:    "daemon:" + r.daemonName,
 				Type:      "disk_high",
 				Timestamp: now,
 				Payload: map[string]interface{}{
-					"percent":   diskPercent,
+					"path":      path,
+					"percent":   usage.Percent,
 					"threshold": r.diskThreshold,
-					"total_gb":  float64(diskTotal) / 1024 / 1024 / 1024,
-					"free_gb":   float64(diskFree) / 1024 / 1024 / 1024,
+					"total_gb":  float64(usage.Total) / 1024 / 1024 / 1024,
+					"free_gb":   float64(usage.Total-usage.Used) / 1024 / 1024 / 1024,
+				},
+			})
+			slog.Warn("Disk alert", "path", path, "percent", usage.Percent, "threshold", r.diskThreshold)
+		}
+
+		// Inode exhaustion fails writes just like a full disk, with bytes to spare
+		if usage.InodesPercent > r.inodeThreshold && now.Sub(r.lastInodeAlert[path]) > r.alertCooldown {
+			r.lastInodeAlert[path] = now
+			r.manager.Emit(Event{
+				Source:    "daemon:" + r.daemonName,
+				Type:      "inodes_high",
+				Timestamp: now,
+				Payload: map[string]interface{}{
+					"path":         path,
+					"percent":      usage.InodesPercent,
+					"threshold":    r.inodeThreshold,
+					"inodes_total": usage.InodesTotal,
+					"inodes_free":  usage.InodesFree,
 				},
 			})
-			log.Printf("Disk alert: %.1f%% > %.1f%%", diskPercent, r.diskThreshold)
+			slog.Warn("Inode alert", "path", path, "percent", usage.InodesPercent, "threshold", r.inodeThreshold)
 		}
 	}
 }
@@ -127,25 +170,44 @@ func (r *ResourceMonitor) check() {
 // GetResourceStats returns current resource stats without alerting.
 func GetResourceStats() map[string]interface{} {
 	hostname, _ := os.Hostname()
+	host := executor.GetHostStats()
 
+	// memory_alloc/memory_sys are the daemon's own Go heap
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
 	stats := map[string]interface{}{
-		"hostname":     hostname,
-		"num_cpu":      runtime.NumCPU(),
-		"memory_alloc": memStats.Alloc,
-		"memory_sys":   memStats.Sys,
+		"hostname":         hostname,
+		"num_cpu":          runtime.NumCPU(),
+		"cpu_percent":      host.CPUPercent,
+		"memory_percent":   host.MemoryPercent,
+		"memory_total":     host.Memory.Total,
+		"memory_available": host.Memory.Available,
+		"memory_alloc":     memStats.Alloc,
+		"memory_sys":       memStats.Sys,
 	}
 
-	var diskStat syscall.Statfs_t
-	if err := syscall.Statfs("/", &diskStat); err == nil {
-		diskTotal := diskStat.Blocks * uint64(diskStat.Bsize)
-		diskFree := diskStat.Bfree * uint64(diskStat.Bsize)
-		stats["disk_total"] = diskTotal
-		stats["disk_free"] = diskFree
-		stats["disk_percent"] = float64(diskTotal-diskFree) / float64(diskTotal) * 100
+	disks := make(map[string]interface{})
+	for i, path := range executor.DiskPaths() {
+		usage, ok := host.Disks[path]
+		if !ok {
+			continue
+		}
+		if i == 0 {
+			stats["disk_total"] = usage.Total
+			stats["disk_free"] = usage.Total - usage.Used
+			stats["disk_percent"] = usage.Percent
+		}
+		disks[path] = map[string]interface{}{
+			"total":          usage.Total,
+			"free":           usage.Total - usage.Used,
+			"percent":        usage.Percent,
+			"inodes_total":   usage.InodesTotal,
+			"inodes_free":    usage.InodesFree,
+			"inodes_percent": usage.InodesPercent,
+		}
 	}
+	stats["disks"] = disks
 
 	return stats
 }
@@ -0,0 +1,137 @@
+// System snapshot emitter - periodically captures full system state for trend analysis.
+package emitters
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ultron/daemon/internal/executor"
+)
+
+// snapshotTopProcesses is how many processes (by CPU) each snapshot includes.
+const snapshotTopProcesses = 10
+
+// SystemSnapshot emits a system_snapshot event on a fixed interval.
+type SystemSnapshot struct {
+	manager    *Manager
+	daemonName string
+	interval   time.Duration
+
+	// IncludeEnv adds the daemon's redacted environment to each snapshot,
+	// as system_info does with include_env.
+	IncludeEnv bool
+}
+
+// NewSystemSnapshot creates a snapshot emitter firing every interval.
+func NewSystemSnapshot(manager *Manager, daemonName string, interval time.Duration) *SystemSnapshot {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	return &SystemSnapshot{
+		manager:    manager,
+		daemonName: daemonName,
+		interval:   interval,
+	}
+}
+
+// Name returns the emitter name.
+func (s *SystemSnapshot) Name() string {
+	return "system_snapshot"
+}
+
+// Start emits a snapshot immediately and then on every interval.
+func (s *SystemSnapshot) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.emit(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			s.emit(ctx)
+		}
+	}
+}
+
+// Stop stops the emitter.
+func (s *SystemSnapshot) Stop() error {
+	return nil
+}
+
+func (s *SystemSnapshot) emit(ctx context.Context) {
+	now := time.Now()
+	payload := map[string]interface{}{
+		"resources": GetResourceStats(),
+		"processes": topProcesses(ctx, snapshotTopProcesses),
+	}
+
+	if info, err := executor.DefaultExecutor.GetSystemInfo(); err == nil {
+		payload["system"] = map[string]interface{}{
+			"hostname": info.Hostname,
+			"os":       info.OS,
+			"arch":     info.Arch,
+			"num_cpu":  info.NumCPU,
+			"username": info.Username,
+		}
+		if s.IncludeEnv {
+			system := payload["system"].(map[string]interface{})
+			system["env"], system["env_redacted"] = executor.RedactedEnviron()
+		}
+	}
+
+	s.manager.Emit(Event{
+		Source:    "daemon:" + s.daemonName,
+		Type:      "system_snapshot",
+		Timestamp: now,
+		Payload:   payload,
+	})
+}
+
+// topProcesses returns the n busiest processes by CPU. It returns nil where ps
+// isn't available.
+func topProcesses(ctx context.Context, n int) []map[string]interface{} {
+	var args []string
+	switch runtime.GOOS {
+	case "linux":
+		args = []string{"-eo", "pid,pcpu,pmem,comm", "--sort=-pcpu", "--no-headers"}
+	case "darwin":
+		args = []string{"-Ao", "pid=,pcpu=,pmem=,comm=", "-r"}
+	default:
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "ps", args...).Output()
+	if err != nil {
+		return nil
+	}
+
+	procs := make([]map[string]interface{}, 0, n)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		cpu, _ := strconv.ParseFloat(fields[1], 64)
+		mem, _ := strconv.ParseFloat(fields[2], 64)
+		procs = append(procs, map[string]interface{}{
+			"pid":         pid,
+			"cpu_percent": cpu,
+			"mem_percent": mem,
+			"command":     strings.Join(fields[3:], " "),
+		})
+		if len(procs) == n {
+			break
+		}
+	}
+	return procs
+}
@@ -0,0 +1,273 @@
+// Structured log tailer emitter - parses JSON/logfmt lines and emits matching records.
+package emitters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StructuredLogTailer follows a log file, parses each line as JSON or logfmt
+// and emits a structured_log event for records matching its expression.
+type StructuredLogTailer struct {
+	manager    *Manager
+	daemonName string
+	path       string
+	format     string // "json" or "logfmt"
+	match      []matchClause
+	interval   time.Duration
+}
+
+// NewStructuredLogTailer creates a tailer for path. match is a list of
+// clauses joined by " and ", e.g. `level=error and status>=500`. Supported
+// operators are = != > >= < <= and ~ (regex). Nested JSON fields use dots
+// (http.status). An empty match emits every record.
+func NewStructuredLogTailer(manager *Manager, daemonName, path, format, match string) (*StructuredLogTailer, error) {
+	if format != "json" && format != "logfmt" {
+		return nil, fmt.Errorf("unsupported log format %q (want json or logfmt)", format)
+	}
+	clauses, err := parseMatch(match)
+	if err != nil {
+		return nil, err
+	}
+	return &StructuredLogTailer{
+		manager:    manager,
+		daemonName: daemonName,
+		path:       path,
+		format:     format,
+		match:      clauses,
+		interval:   time.Second,
+	}, nil
+}
+
+// Name returns the emitter name.
+func (s *StructuredLogTailer) Name() string {
+	return "structured_log:" + s.path
+}
+
+// Start follows the file until ctx is done.
+func (s *StructuredLogTailer) Start(ctx context.Context) error {
+	tail := newTailFile(s.path)
+	defer tail.close()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			lines, err := tail.poll()
+			if err != nil {
+				slog.Error("Structured log tail failed", "path", s.path, "error", err)
+			}
+			for _, line := range lines {
+				s.handleLine(line)
+			}
+		}
+	}
+}
+
+// Stop stops the tailer.
+func (s *StructuredLogTailer) Stop() error {
+	return nil
+}
+
+func (s *StructuredLogTailer) handleLine(line string) {
+	var record map[string]interface{}
+	if s.format == "json" {
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return
+		}
+	} else {
+		record = parseLogfmt(line)
+	}
+	if len(record) == 0 || !matchRecord(s.match, record) {
+		return
+	}
+
+	s.manager.Emit(Event{
+		Source:    "daemon:" + s.daemonName,
+		Type:      "structured_log",
+		Timestamp: time.Now(),
+		Payload: map[string]interface{}{
+			"path":   s.path,
+			"format": s.format,
+			"record": record,
+			"line":   line,
+		},
+	})
+}
+
+// matchClause is one "field op value" test.
+type matchClause struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// Operators, longest first so ">=" isn't read as ">".
+var matchOps = []string{"!=", ">=", "<=", "=", ">", "<", "~"}
+
+func parseMatch(expr string) ([]matchClause, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, nil
+	}
+
+	var clauses []matchClause
+	for _, part := range strings.Split(expr, " and ") {
+		part = strings.TrimSpace(part)
+		clause, err := parseClause(part)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+func parseClause(part string) (matchClause, error) {
+	best := -1
+	var op string
+	for _, candidate := range matchOps {
+		if i := strings.Index(part, candidate); i > 0 && (best == -1 || i < best) {
+			best, op = i, candidate
+		}
+	}
+	if best == -1 {
+		return matchClause{}, fmt.Errorf("invalid match clause %q", part)
+	}
+
+	clause := matchClause{
+		field: strings.TrimSpace(part[:best]),
+		op:    op,
+		value: strings.Trim(strings.TrimSpace(part[best+len(op):]), `"`),
+	}
+	if op == "~" {
+		re, err := regexp.Compile(clause.value)
+		if err != nil {
+			return matchClause{}, fmt.Errorf("invalid regex in %q: %w", part, err)
+		}
+		clause.re = re
+	}
+	return clause, nil
+}
+
+func matchRecord(clauses []matchClause, record map[string]interface{}) bool {
+	for _, c := range clauses {
+		v, ok := lookupField(record, c.field)
+		if !ok {
+			return false
+		}
+		actual := fmt.Sprint(v)
+
+		switch c.op {
+		case "=":
+			if actual != c.value {
+				return false
+			}
+		case "!=":
+			if actual == c.value {
+				return false
+			}
+		case "~":
+			if !c.re.MatchString(actual) {
+				return false
+			}
+		default:
+			a, errA := strconv.ParseFloat(actual, 64)
+			b, errB := strconv.ParseFloat(c.value, 64)
+			if errA != nil || errB != nil {
+				return false
+			}
+			switch c.op {
+			case ">":
+				ok = a > b
+			case ">=":
+				ok = a >= b
+			case "<":
+				ok = a < b
+			case "<=":
+				ok = a <= b
+			}
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lookupField resolves a dotted path through nested objects.
+func lookupField(record map[string]interface{}, field string) (interface{}, bool) {
+	if v, ok := record[field]; ok {
+		return v, true
+	}
+
+	var current interface{} = record
+	for _, key := range strings.Split(field, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// parseLogfmt parses key=value pairs; values may be double-quoted.
+func parseLogfmt(line string) map[string]interface{} {
+	record := make(map[string]interface{})
+	for i := 0; i < len(line); {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			i++
+			continue
+		}
+		if i >= len(line) || line[i] != '=' {
+			record[key] = true // Bare key
+			continue
+		}
+		i++ // Skip '='
+
+		var value string
+		if i < len(line) && line[i] == '"' {
+			i++
+			var b strings.Builder
+			for i < len(line) && line[i] != '"' {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				b.WriteByte(line[i])
+				i++
+			}
+			i++ // Skip closing quote
+			value = b.String()
+		} else {
+			start = i
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			value = line[start:i]
+		}
+		record[key] = value
+	}
+	return record
+}
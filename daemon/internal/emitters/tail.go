@@ -0,0 +1,106 @@
+// File tailing - follows a growing file across truncation and rotation.
+package emitters
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// tailFile reads lines appended to a file since the last poll. It reopens the
+// file when it is rotated (the path now names a different file) and rewinds
+// when it is truncated.
+type tailFile struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial string // Trailing text not yet terminated by a newline
+}
+
+// newTailFile starts at the current end of path, so only new lines are read.
+// The file doesn't have to exist yet.
+func newTailFile(path string) *tailFile {
+	t := &tailFile{path: path}
+	if t.open() == nil {
+		t.offset = t.info.Size()
+	}
+	return t
+}
+
+func (t *tailFile) open() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	t.file, t.info, t.offset, t.partial = f, info, 0, ""
+	return nil
+}
+
+// poll returns the complete lines appended since the previous call.
+func (t *tailFile) poll() ([]string, error) {
+	current, err := os.Stat(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // Rotated away; wait for it to reappear
+		}
+		return nil, err
+	}
+
+	switch {
+	case t.file == nil:
+		if err := t.open(); err != nil {
+			return nil, err
+		}
+	case !os.SameFile(t.info, current):
+		// Rotated: drain what's left of the old file first, then switch
+		lines, _ := t.read()
+		t.file.Close()
+		t.file = nil
+		if err := t.open(); err != nil {
+			return lines, err
+		}
+		more, err := t.read()
+		return append(lines, more...), err
+	case current.Size() < t.offset:
+		// Truncated in place
+		t.offset, t.partial = 0, ""
+	}
+
+	return t.read()
+}
+
+func (t *tailFile) read() ([]string, error) {
+	if _, err := t.file.Seek(t.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	reader := bufio.NewReader(t.file)
+	for {
+		chunk, err := reader.ReadString('\n')
+		t.offset += int64(len(chunk))
+		if err != nil {
+			t.partial += chunk
+			if err == io.EOF {
+				return lines, nil
+			}
+			return lines, err
+		}
+		lines = append(lines, strings.TrimRight(t.partial+chunk, "\r\n"))
+		t.partial = ""
+	}
+}
+
+func (t *tailFile) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
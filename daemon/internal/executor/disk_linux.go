@@ -0,0 +1,14 @@
+package executor
+
+import "syscall"
+
+func diskUsage(path string) (DiskUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return DiskUsage{}, err
+	}
+	bsize := uint64(stat.Bsize)
+	usage := newDiskUsage(stat.Blocks*bsize, stat.Bfree*bsize, stat.Bavail*bsize)
+	usage.setInodes(uint64(stat.Files), uint64(stat.Ffree))
+	return usage, nil
+}
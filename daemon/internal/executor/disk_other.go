@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !windows
+
+package executor
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func diskUsage(path string) (DiskUsage, error) {
+	return DiskUsage{}, fmt.Errorf("disk usage not supported on %s", runtime.GOOS)
+}
@@ -3,19 +3,30 @@ package executor
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
+// DefaultMaxOutputBytes caps how much stdout/stderr ExecuteShell keeps in memory per stream.
+const DefaultMaxOutputBytes = 10 * 1024 * 1024
+
 // Executor handles command execution and file operations
 type Executor struct {
-	sessions sync.Map // session name -> *Session
+	sessions       sync.Map // session name -> *Session
+	maxOutputBytes int
+
+	// In-flight commands, cancellable by ID (see inflight.go)
+	inflight   map[string]*inflightCommand
+	inflightMu sync.Mutex
 }
 
 // Session represents a persistent shell session
@@ -31,21 +42,75 @@ type Session struct {
 
 // New creates a new Executor
 func New() *Executor {
-	return &Executor{}
+	return &Executor{
+		maxOutputBytes: DefaultMaxOutputBytes,
+	}
+}
+
+// Global executor instance
+var DefaultExecutor = New()
+
+// SetMaxOutputBytes sets the per-stream cap on buffered command output.
+func (e *Executor) SetMaxOutputBytes(n int) {
+	e.maxOutputBytes = n
 }
 
 // ShellResult holds the result of a shell command
 type ShellResult struct {
-	Stdout   string
-	Stderr   string
-	ExitCode int
-	Error    error
+	Stdout    string
+	Stderr    string
+	ExitCode  int
+	Error     error
+	Truncated bool // Output exceeded the buffer cap; streamed lines are still complete
+}
+
+// Output stream names
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputLine is one line of command output and the stream it came from.
+type OutputLine struct {
+	Stream string `json:"stream"` // StreamStdout or StreamStderr
+	Line   string `json:"line"`
+}
+
+// cappedBuffer accumulates output up to a byte limit and drops the rest.
+type cappedBuffer struct {
+	buf       strings.Builder
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) WriteLine(line string) {
+	if b.truncated {
+		return
+	}
+	if b.limit > 0 && b.buf.Len()+len(line)+1 > b.limit {
+		b.truncated = true
+		return
+	}
+	b.buf.WriteString(line)
+	b.buf.WriteByte('\n')
 }
 
 // ExecuteShell executes a shell command and streams output
-func (e *Executor) ExecuteShell(ctx context.Context, command, workDir string, env map[string]string, outputChan chan<- string) (*ShellResult, error) {
+func (e *Executor) ExecuteShell(ctx context.Context, command, workDir string, env map[string]string, outputChan chan<- OutputLine) (*ShellResult, error) {
+	return e.ExecuteShellAs(ctx, command, workDir, env, nil, outputChan)
+}
+
+// ExecuteShellAs is ExecuteShell running the command as runAs (nil for the
+// daemon's own user) by switching credentials, which needs root. HOME, USER
+// and LOGNAME are set to the target account's.
+func (e *Executor) ExecuteShellAs(ctx context.Context, command, workDir string, env map[string]string, runAs *RunAsUser, outputChan chan<- OutputLine) (*ShellResult, error) {
 	// Create command
-	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
 
 	if workDir != "" {
 		cmd.Dir = workDir
@@ -53,6 +118,12 @@ func (e *Executor) ExecuteShell(ctx context.Context, command, workDir string, en
 
 	// Set environment
 	cmd.Env = os.Environ()
+	if runAs != nil {
+		if err := setCredential(cmd, runAs); err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, "HOME="+runAs.HomeDir, "USER="+runAs.Username, "LOGNAME="+runAs.Username)
+	}
 	for k, v := range env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
@@ -73,7 +144,12 @@ func (e *Executor) ExecuteShell(ctx context.Context, command, workDir string, en
 		return nil, fmt.Errorf("failed to start command: %w", err)
 	}
 
-	var stdoutBuf, stderrBuf strings.Builder
+	// Sends on outputChan block until the consumer catches up, which stops us
+	// reading the pipe and in turn blocks the process - that is the
+	// backpressure. The buffers below are capped so a chatty command can't
+	// balloon memory while that happens.
+	stdoutBuf := &cappedBuffer{limit: e.maxOutputBytes}
+	stderrBuf := &cappedBuffer{limit: e.maxOutputBytes}
 	var wg sync.WaitGroup
 
 	// Stream stdout
@@ -83,10 +159,10 @@ func (e *Executor) ExecuteShell(ctx context.Context, command, workDir string, en
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
 			line := scanner.Text()
-			stdoutBuf.WriteString(line + "\n")
+			stdoutBuf.WriteLine(line)
 			if outputChan != nil {
 				select {
-				case outputChan <- line:
+				case outputChan <- OutputLine{Stream: StreamStdout, Line: line}:
 				case <-ctx.Done():
 					return
 				}
@@ -101,10 +177,10 @@ func (e *Executor) ExecuteShell(ctx context.Context, command, workDir string, en
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
 			line := scanner.Text()
-			stderrBuf.WriteString(line + "\n")
+			stderrBuf.WriteLine(line)
 			if outputChan != nil {
 				select {
-				case outputChan <- "[stderr] " + line:
+				case outputChan <- OutputLine{Stream: StreamStderr, Line: line}:
 				case <-ctx.Done():
 					return
 				}
@@ -119,9 +195,10 @@ func (e *Executor) ExecuteShell(ctx context.Context, command, workDir string, en
 	err = cmd.Wait()
 
 	result := &ShellResult{
-		Stdout:   stdoutBuf.String(),
-		Stderr:   stderrBuf.String(),
-		ExitCode: 0,
+		Stdout:    stdoutBuf.buf.String(),
+		Stderr:    stderrBuf.buf.String(),
+		ExitCode:  0,
+		Truncated: stdoutBuf.truncated || stderrBuf.truncated,
 	}
 
 	if err != nil {
@@ -216,6 +293,94 @@ func (e *Executor) WriteFile(path string, content []byte, createDirs bool, mode
 	return nil
 }
 
+// MoveFile moves or renames src (a file, symlink or directory) to dst. If
+// dst exists it is replaced only with overwrite. Within a filesystem this
+// is a rename; across filesystems src is copied to a temporary name beside
+// dst, renamed into place, and then removed.
+func (e *Executor) MoveFile(src, dst string, overwrite bool) error {
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+	if _, err := os.Lstat(absSrc); err != nil {
+		return err
+	}
+	if absSrc == absDst {
+		return nil
+	}
+	if _, err := os.Lstat(absDst); err == nil && !overwrite {
+		return fmt.Errorf("destination %s already exists", dst)
+	}
+
+	err = os.Rename(absSrc, absDst)
+	var linkErr *os.LinkError
+	if err == nil || !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+		return err
+	}
+
+	// Different filesystems
+	tmp := filepath.Join(filepath.Dir(absDst), fmt.Sprintf(".%s.move-%d", filepath.Base(absDst), time.Now().UnixNano()))
+	if err := copyTree(absSrc, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("failed to copy across filesystems: %w", err)
+	}
+	if err := os.Rename(tmp, absDst); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.RemoveAll(absSrc)
+}
+
+// copyTree copies a file, symlink or directory tree, keeping permissions.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return fmt.Errorf("can't copy special file %s", path)
+		}
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 // ListFiles lists files in a directory (simple version)
 func (e *Executor) ListFiles(path string, recursive bool) ([]FileInfo, error) {
 	return e.ListFilesWithPattern(path, recursive, "")
@@ -223,6 +388,18 @@ func (e *Executor) ListFiles(path string, recursive bool) ([]FileInfo, error) {
 
 // ListFilesWithPattern lists files in a directory with pattern matching
 func (e *Executor) ListFilesWithPattern(path string, recursive bool, pattern string) ([]FileInfo, error) {
+	return e.ListFilesMatching(path, recursive, PatternGlob, pattern)
+}
+
+// ListFilesMatching lists files in a directory whose names or relative paths
+// match pattern, interpreted as patternType (see PathMatcher).
+func (e *Executor) ListFilesMatching(path string, recursive bool, patternType, pattern string) ([]FileInfo, error) {
+	matcher, err := NewPathMatcher(patternType, pattern)
+	if err != nil {
+		return nil, err
+	}
+	recursive = recursive || matcher.Recursive()
+
 	// Resolve path
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -246,8 +423,11 @@ func (e *Executor) ListFilesWithPattern(path string, recursive bool, pattern str
 
 		// Match pattern if specified
 		if pattern != "" {
-			matched, _ := filepath.Match(pattern, info.Name())
-			if !matched {
+			rel, _ := filepath.Rel(absPath, p)
+			if !matcher.Match(rel, info.Name()) {
+				if !recursive && info.IsDir() && p != absPath {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 		}
@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var vmStatPattern = regexp.MustCompile(`^Pages (free|inactive|speculative|purgeable):\s+(\d+)`)
+
+func memoryInfo() (MemoryInfo, error) {
+	out, err := exec.Command("sysctl", "-n", "hw.memsize", "hw.pagesize").Output()
+	if err != nil {
+		return MemoryInfo{}, err
+	}
+	vals := strings.Fields(string(out))
+	if len(vals) != 2 {
+		return MemoryInfo{}, fmt.Errorf("unexpected sysctl output: %q", out)
+	}
+	total, _ := strconv.ParseUint(vals[0], 10, 64)
+	pageSize, _ := strconv.ParseUint(vals[1], 10, 64)
+
+	out, err = exec.Command("vm_stat").Output()
+	if err != nil {
+		return MemoryInfo{}, err
+	}
+	var freePages uint64
+	for _, line := range strings.Split(string(out), "\n") {
+		if m := vmStatPattern.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.ParseUint(m[2], 10, 64)
+			freePages += n
+		}
+	}
+	return newMemoryInfo(total, freePages*pageSize), nil
+}
+
+// cpuPercent reads the idle share from top. Its first sample averages since
+// boot, so take two a second apart and use the second.
+func cpuPercent() (float64, error) {
+	out, err := exec.Command("top", "-l", "2", "-s", "1", "-n", "0").Output()
+	if err != nil {
+		return 0, err
+	}
+	// "CPU usage: 5.12% user, 10.25% sys, 84.61% idle"
+	idle := -1.0
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.HasPrefix(line, "CPU usage:") {
+			continue
+		}
+		for _, part := range strings.Split(strings.TrimPrefix(line, "CPU usage:"), ",") {
+			fields := strings.Fields(part)
+			if len(fields) == 2 && fields[1] == "idle" {
+				if v, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64); err == nil {
+					idle = v
+				}
+			}
+		}
+	}
+	if idle < 0 {
+		return 0, fmt.Errorf("no CPU usage line in top output")
+	}
+	return 100 - idle, nil
+}
+
+// hostCPU is the sampler behind GetHostStats. top takes its own two samples,
+// so samplers keep no state here.
+var hostCPU CPUSampler
+
+func (s *CPUSampler) sample() (float64, error) {
+	return cpuPercent()
+}
@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func memoryInfo() (MemoryInfo, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return MemoryInfo{}, err
+	}
+	defer f.Close()
+
+	fields := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// "MemAvailable:   12345678 kB"
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(parts[1], 10, 64); err == nil {
+			fields[strings.TrimSuffix(parts[0], ":")] = v * 1024
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return MemoryInfo{}, err
+	}
+
+	available, ok := fields["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14
+		available = fields["MemFree"] + fields["Buffers"] + fields["Cached"]
+	}
+	return newMemoryInfo(fields["MemTotal"], available), nil
+}
+
+// hostCPU is the sampler behind GetCPUPercent and GetHostStats.
+var hostCPU CPUSampler
+
+func cpuPercent() (float64, error) {
+	return hostCPU.Percent()
+}
+
+// sample compares /proc/stat with the previous sample.
+func (s *CPUSampler) sample() (float64, error) {
+	idle, total, err := cpuTimes()
+	if err != nil {
+		return 0, err
+	}
+	if s.total == 0 || total <= s.total {
+		// No earlier sample to compare against; take a short one now
+		time.Sleep(250 * time.Millisecond)
+		s.idle, s.total = idle, total
+		if idle, total, err = cpuTimes(); err != nil {
+			return 0, err
+		}
+	}
+	dIdle, dTotal := idle-s.idle, total-s.total
+	s.idle, s.total = idle, total
+	if dTotal == 0 {
+		return 0, nil
+	}
+	return float64(dTotal-dIdle) / float64(dTotal) * 100, nil
+}
+
+// cpuTimes sums the aggregate CPU line of /proc/stat, in clock ticks.
+func cpuTimes() (idle, total uint64, err error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	// First line: "cpu  user nice system idle iowait irq softirq steal guest guest_nice"
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected /proc/stat format")
+	}
+	for i, f := range fields[1:] {
+		if i >= 8 {
+			break // guest time is already counted in user
+		}
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += v
+		if i == 3 || i == 4 { // idle, iowait
+			idle += v
+		}
+	}
+	return idle, total, nil
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin
+
+package executor
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func memoryInfo() (MemoryInfo, error) {
+	return MemoryInfo{}, fmt.Errorf("memory stats not supported on %s", runtime.GOOS)
+}
+
+func cpuPercent() (float64, error) {
+	return 0, fmt.Errorf("CPU stats not supported on %s", runtime.GOOS)
+}
+
+var hostCPU CPUSampler
+
+func (s *CPUSampler) sample() (float64, error) {
+	return cpuPercent()
+}
@@ -0,0 +1,129 @@
+package executor
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ultron/daemon/internal/crash"
+)
+
+// In-flight tracking limits
+const (
+	inflightTTL = 24 * time.Hour // Entries older than this are swept even if never released
+	maxInflight = 1000           // Oldest entries are evicted beyond this
+)
+
+// inflightCommand is a running command that can be cancelled by ID.
+type inflightCommand struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	startedAt time.Time
+	outer     *inflightCommand // Entry this one replaced, for nested tracking
+}
+
+// Track registers a cancellable command under id. The returned context must
+// be used to run the command, and release must be called when it finishes.
+// Tracking an id that is already tracked (a handler inside a retry loop)
+// nests: cancelling the id cancels both, and release restores the outer one.
+func (e *Executor) Track(ctx context.Context, id string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if id == "" {
+		return ctx, cancel
+	}
+
+	e.inflightMu.Lock()
+	if e.inflight == nil {
+		e.inflight = make(map[string]*inflightCommand)
+	}
+	entry := &inflightCommand{ctx: ctx, cancel: cancel, startedAt: time.Now(), outer: e.inflight[id]}
+	e.inflight[id] = entry
+	e.evictLocked()
+	e.inflightMu.Unlock()
+
+	release := func() {
+		cancel()
+		e.inflightMu.Lock()
+		if e.inflight[id] == entry {
+			if entry.outer != nil && entry.outer.ctx.Err() == nil {
+				e.inflight[id] = entry.outer
+			} else {
+				delete(e.inflight, id)
+			}
+		}
+		e.inflightMu.Unlock()
+	}
+	return ctx, release
+}
+
+// Cancel cancels the in-flight command with the given id.
+func (e *Executor) Cancel(id string) bool {
+	e.inflightMu.Lock()
+	cmd, ok := e.inflight[id]
+	if ok {
+		delete(e.inflight, id)
+	}
+	e.inflightMu.Unlock()
+
+	for ; cmd != nil; cmd = cmd.outer {
+		cmd.cancel()
+	}
+	return ok
+}
+
+// InFlight returns the number of tracked commands.
+func (e *Executor) InFlight() int {
+	e.inflightMu.Lock()
+	defer e.inflightMu.Unlock()
+	return len(e.inflight)
+}
+
+// RunSweeper periodically drops finished or stale in-flight entries until ctx is done.
+func (e *Executor) RunSweeper(ctx context.Context, interval time.Duration) {
+	defer crash.Recover("inflight sweeper")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.sweep()
+		}
+	}
+}
+
+func (e *Executor) sweep() {
+	cutoff := time.Now().Add(-inflightTTL)
+
+	e.inflightMu.Lock()
+	defer e.inflightMu.Unlock()
+
+	for id, cmd := range e.inflight {
+		if cmd.ctx.Err() != nil || cmd.startedAt.Before(cutoff) {
+			delete(e.inflight, id)
+		}
+	}
+}
+
+// evictLocked drops the oldest entries once the map exceeds maxInflight.
+// Evicted commands keep running; they just can no longer be cancelled by ID.
+func (e *Executor) evictLocked() {
+	if len(e.inflight) <= maxInflight {
+		return
+	}
+
+	ids := make([]string, 0, len(e.inflight))
+	for id := range e.inflight {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return e.inflight[ids[i]].startedAt.Before(e.inflight[ids[j]].startedAt)
+	})
+
+	for _, id := range ids[:len(ids)-maxInflight] {
+		delete(e.inflight, id)
+	}
+}
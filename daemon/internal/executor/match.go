@@ -0,0 +1,120 @@
+package executor
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Pattern types for listing files.
+const (
+	// PatternGlob matches filepath.Match against the file name (the default).
+	PatternGlob = "glob"
+	// PatternDoublestar matches a glob against the slash-separated path
+	// relative to the listed directory; a "**" segment matches any number
+	// of directories, including none.
+	PatternDoublestar = "doublestar"
+	// PatternRegex matches a Go regexp against that relative path.
+	PatternRegex = "regex"
+)
+
+// PathMatcher decides which files a listing includes.
+type PathMatcher struct {
+	kind     string
+	pattern  string
+	segments []string
+	re       *regexp.Regexp
+}
+
+// NewPathMatcher compiles pattern as patternType ("" means glob). An empty
+// pattern matches everything.
+func NewPathMatcher(patternType, pattern string) (*PathMatcher, error) {
+	m := &PathMatcher{kind: patternType, pattern: pattern}
+	if m.kind == "" {
+		m.kind = PatternGlob
+	}
+
+	switch m.kind {
+	case PatternGlob:
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	case PatternDoublestar:
+		m.segments = strings.Split(strings.Trim(filepath.ToSlash(pattern), "/"), "/")
+		for _, seg := range m.segments {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+	case PatternRegex:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("unknown pattern_type %q (use glob, doublestar or regex)", patternType)
+	}
+	return m, nil
+}
+
+// Recursive reports whether the pattern has to see subdirectories to match,
+// whatever the caller asked for.
+func (m *PathMatcher) Recursive() bool {
+	return m.kind == PatternDoublestar && m.pattern != ""
+}
+
+// ByPath reports whether the pattern matches relative paths rather than
+// file names. The listed directory itself (".") is never a match then.
+func (m *PathMatcher) ByPath() bool {
+	return m.kind != PatternGlob
+}
+
+// Match reports whether the file called name at rel, relative to the listed
+// directory, is included.
+func (m *PathMatcher) Match(rel, name string) bool {
+	if m.pattern == "" {
+		return true
+	}
+	if m.ByPath() && rel == "." {
+		return false
+	}
+	switch m.kind {
+	case PatternDoublestar:
+		return matchSegments(m.segments, strings.Split(filepath.ToSlash(rel), "/"))
+	case PatternRegex:
+		return m.re.MatchString(filepath.ToSlash(rel))
+	default:
+		matched, _ := filepath.Match(m.pattern, name)
+		return matched
+	}
+}
+
+// matchSegments matches path segments against glob segments, where "**"
+// stands for zero or more whole segments.
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(rest, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
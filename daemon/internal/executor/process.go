@@ -0,0 +1,131 @@
+package executor
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Process is one entry of a process listing. On Windows, tasklist reports
+// neither the parent PID nor CPU and memory percentages, so those are zero
+// and MemKB is set instead.
+type Process struct {
+	PID     int     `json:"pid"`
+	PPID    int     `json:"ppid"`
+	User    string  `json:"user"`
+	CPU     float64 `json:"cpu"` // Percent of one CPU
+	Mem     float64 `json:"mem"` // Percent of physical memory
+	MemKB   int64   `json:"mem_kb,omitempty"`
+	Command string  `json:"command"`
+}
+
+// ListProcesses returns every running process, parsed from ps (or tasklist
+// on Windows), ordered by PID.
+func ListProcesses(ctx context.Context) ([]Process, error) {
+	var procs []Process
+	var err error
+	if runtime.GOOS == "windows" {
+		procs, err = listTasklist(ctx)
+	} else {
+		procs, err = listPS(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	SortProcesses(procs, "pid")
+	return procs, nil
+}
+
+// SortProcesses orders procs by "pid" (ascending), "cpu" or "mem" (both
+// busiest first).
+func SortProcesses(procs []Process, by string) error {
+	var less func(a, b Process) bool
+	switch by {
+	case "", "pid":
+		less = func(a, b Process) bool { return a.PID < b.PID }
+	case "cpu":
+		less = func(a, b Process) bool { return a.CPU > b.CPU }
+	case "mem":
+		less = func(a, b Process) bool {
+			if a.Mem != b.Mem {
+				return a.Mem > b.Mem
+			}
+			return a.MemKB > b.MemKB
+		}
+	default:
+		return fmt.Errorf("unknown sort_by %q (use cpu, mem or pid)", by)
+	}
+	sort.SliceStable(procs, func(i, j int) bool { return less(procs[i], procs[j]) })
+	return nil
+}
+
+// listPS parses ps output; the same columns work with procps and BSD ps.
+func listPS(ctx context.Context) ([]Process, error) {
+	output, err := exec.CommandContext(ctx, "ps", "-A", "-o", "pid=,ppid=,user=,pcpu=,pmem=,args=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ps failed: %w", err)
+	}
+
+	var procs []Process
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		cpu, _ := strconv.ParseFloat(fields[3], 64)
+		mem, _ := strconv.ParseFloat(fields[4], 64)
+		procs = append(procs, Process{
+			PID:     pid,
+			PPID:    ppid,
+			User:    fields[2],
+			CPU:     cpu,
+			Mem:     mem,
+			Command: strings.Join(fields[5:], " "),
+		})
+	}
+	return procs, nil
+}
+
+// listTasklist parses `tasklist /v /fo csv /nh`: image name, PID, session
+// name, session#, mem usage ("12,345 K"), status, user name, CPU time, title.
+func listTasklist(ctx context.Context) ([]Process, error) {
+	output, err := exec.CommandContext(ctx, "tasklist", "/v", "/fo", "csv", "/nh").Output()
+	if err != nil {
+		return nil, fmt.Errorf("tasklist failed: %w", err)
+	}
+
+	r := csv.NewReader(strings.NewReader(string(output)))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse tasklist output: %w", err)
+	}
+
+	var procs []Process
+	for _, rec := range records {
+		if len(rec) < 5 {
+			continue
+		}
+		pid, err := strconv.Atoi(rec[1])
+		if err != nil {
+			continue
+		}
+		memKB, _ := strconv.ParseInt(strings.NewReplacer(",", "", ".", "", " ", "", "K", "").Replace(rec[4]), 10, 64)
+		p := Process{PID: pid, MemKB: memKB, Command: rec[0]}
+		if len(rec) > 6 && rec[6] != "N/A" {
+			p.User = rec[6]
+		}
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
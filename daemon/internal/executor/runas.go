@@ -0,0 +1,49 @@
+package executor
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// RunAsUser is the account a command runs as instead of the daemon's own.
+type RunAsUser struct {
+	Username string
+	UID      uint32
+	GID      uint32
+	Groups   []uint32 // Supplementary groups
+	HomeDir  string
+}
+
+// LookupRunAsUser resolves a username or numeric uid to an existing account.
+func LookupRunAsUser(spec string) (*RunAsUser, error) {
+	var u *user.User
+	var err error
+	if _, convErr := strconv.ParseUint(spec, 10, 32); convErr == nil {
+		u, err = user.LookupId(spec)
+	} else {
+		u, err = user.Lookup(spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("user %q does not exist", spec)
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has a non-numeric uid %q", spec, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has a non-numeric gid %q", spec, u.Gid)
+	}
+
+	runAs := &RunAsUser{Username: u.Username, UID: uint32(uid), GID: uint32(gid), HomeDir: u.HomeDir}
+	if groupIDs, err := u.GroupIds(); err == nil {
+		for _, g := range groupIDs {
+			if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+				runAs.Groups = append(runAs.Groups, uint32(id))
+			}
+		}
+	}
+	return runAs, nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package executor
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setCredential makes cmd run as u. Starting it fails unless the daemon is root.
+func setCredential(cmd *exec.Cmd, u *RunAsUser) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: u.UID, Gid: u.GID, Groups: u.Groups},
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+package executor
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func setCredential(cmd *exec.Cmd, u *RunAsUser) error {
+	return fmt.Errorf("running commands as another user is not supported on windows")
+}
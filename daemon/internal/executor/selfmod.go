@@ -36,6 +36,13 @@ func (s *SelfModification) BackupFile(path string) (string, error) {
 	// Create backup directory
 	timestamp := time.Now().Format("20060102-150405")
 	backupPath := filepath.Join(s.backupDir, timestamp, filepath.Base(path))
+	// Two backups of the same file within a second mustn't overwrite each other
+	for n := 1; ; n++ {
+		if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+			break
+		}
+		backupPath = filepath.Join(s.backupDir, fmt.Sprintf("%s-%d", timestamp, n), filepath.Base(path))
+	}
 
 	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
 		return "", fmt.Errorf("failed to create backup dir: %w", err)
@@ -55,66 +62,68 @@ func (s *SelfModification) BackupFile(path string) (string, error) {
 	return backupPath, nil
 }
 
-// ModifyPrimeCode modifies Prime's source code
-func (s *SelfModification) ModifyPrimeCode(ctx context.Context, filePath, oldContent, newContent string) error {
+// ModifyPrimeCode modifies Prime's source code and returns where the
+// original was backed up
+func (s *SelfModification) ModifyPrimeCode(ctx context.Context, filePath, oldContent, newContent string) (string, error) {
 	fullPath := filepath.Join(s.primeRoot, filePath)
 
 	// Backup first
 	backupPath, err := s.BackupFile(fullPath)
 	if err != nil {
-		return fmt.Errorf("backup failed: %w", err)
+		return "", fmt.Errorf("backup failed: %w", err)
 	}
 
 	// Read current content
 	content, err := os.ReadFile(fullPath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
 
 	// Replace content
 	newFileContent := strings.Replace(string(content), oldContent, newContent, 1)
 	if newFileContent == string(content) {
-		return fmt.Errorf("old content not found in file")
+		return "", fmt.Errorf("old content not found in file")
 	}
 
 	// Write modified content
 	if err := os.WriteFile(fullPath, []byte(newFileContent), 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		return "", fmt.Errorf("failed to write file: %w", err)
 	}
 
 	fmt.Printf("Modified %s (backup at %s)\n", fullPath, backupPath)
-	return nil
+	return backupPath, nil
 }
 
-// ModifyDaemonCode modifies Daemon's source code
-func (s *SelfModification) ModifyDaemonCode(ctx context.Context, filePath, oldContent, newContent string) error {
+// ModifyDaemonCode modifies Daemon's source code and returns where the
+// original was backed up
+func (s *SelfModification) ModifyDaemonCode(ctx context.Context, filePath, oldContent, newContent string) (string, error) {
 	fullPath := filepath.Join(s.daemonRoot, filePath)
 
 	// Backup first
 	backupPath, err := s.BackupFile(fullPath)
 	if err != nil {
-		return fmt.Errorf("backup failed: %w", err)
+		return "", fmt.Errorf("backup failed: %w", err)
 	}
 
 	// Read current content
 	content, err := os.ReadFile(fullPath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
 
 	// Replace content
 	newFileContent := strings.Replace(string(content), oldContent, newContent, 1)
 	if newFileContent == string(content) {
-		return fmt.Errorf("old content not found in file")
+		return "", fmt.Errorf("old content not found in file")
 	}
 
 	// Write modified content
 	if err := os.WriteFile(fullPath, []byte(newFileContent), 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		return "", fmt.Errorf("failed to write file: %w", err)
 	}
 
 	fmt.Printf("Modified %s (backup at %s)\n", fullPath, backupPath)
-	return nil
+	return backupPath, nil
 }
 
 // CreatePrimeFile creates a new file in Prime
@@ -285,12 +294,40 @@ func (s *SelfModification) ListBackups(ctx context.Context) ([]string, error) {
 	return backups, nil
 }
 
-// RestoreBackup restores from a backup
+// RestoreProgress reports how far a restore has got.
+type RestoreProgress struct {
+	FilesDone  int
+	FilesTotal int
+	BytesDone  int64
+	BytesTotal int64
+	Path       string // File just written
+}
+
+// RestoreBackup restores from a backup. Every entry is checked before
+// anything is written: if the backup name or any file in it would resolve
+// outside the backup or target directory (including through a symlink
+// already in the target), or an entry isn't a regular file (a symlink could
+// point anywhere), the restore fails with nothing changed.
 func (s *SelfModification) RestoreBackup(ctx context.Context, backupName, targetPath string) error {
+	return s.RestoreBackupProgress(ctx, backupName, targetPath, nil)
+}
+
+// RestoreBackupProgress is RestoreBackup, calling progress (if non-nil) after
+// each file is written.
+func (s *SelfModification) RestoreBackupProgress(ctx context.Context, backupName, targetPath string, progress func(RestoreProgress)) error {
 	backupPath := filepath.Join(s.backupDir, backupName)
+	if !withinDir(s.backupDir, backupPath) || backupPath == filepath.Clean(s.backupDir) {
+		return fmt.Errorf("invalid backup name: %s", backupName)
+	}
 
-	// Walk backup directory and restore files
-	return filepath.Walk(backupPath, func(path string, info os.FileInfo, err error) error {
+	// Walk backup directory and validate every file before touching targetPath
+	type restoreEntry struct {
+		src, dest string
+		size      int64
+	}
+	var entries []restoreEntry
+	var total int64
+	err := filepath.Walk(backupPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -298,23 +335,101 @@ func (s *SelfModification) RestoreBackup(ctx context.Context, backupName, target
 		if info.IsDir() {
 			return nil
 		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("backup entry is not a regular file: %s", path)
+		}
 
 		// Calculate relative path
-		relPath, _ := filepath.Rel(backupPath, path)
+		relPath, err := filepath.Rel(backupPath, path)
+		if err != nil {
+			return err
+		}
 		destPath := filepath.Join(targetPath, relPath)
+		if !withinDir(targetPath, destPath) || !resolvesWithin(targetPath, destPath) {
+			return fmt.Errorf("backup entry escapes the target directory: %s", relPath)
+		}
+		entries = append(entries, restoreEntry{src: path, dest: destPath, size: info.Size()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("restore aborted, nothing written: %w", err)
+	}
+
+	p := RestoreProgress{FilesTotal: len(entries), BytesTotal: total}
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("restore interrupted after %d of %d files: %w", p.FilesDone, p.FilesTotal, err)
+		}
 
 		// Read backup file
-		content, err := os.ReadFile(path)
+		content, err := os.ReadFile(e.src)
 		if err != nil {
 			return err
 		}
 
 		// Ensure directory exists
-		os.MkdirAll(filepath.Dir(destPath), 0755)
+		os.MkdirAll(filepath.Dir(e.dest), 0755)
 
 		// Write to destination
-		return os.WriteFile(destPath, content, 0644)
-	})
+		if err := os.WriteFile(e.dest, content, 0644); err != nil {
+			return err
+		}
+
+		p.FilesDone++
+		p.BytesDone += int64(len(content))
+		p.Path = e.dest
+		if progress != nil {
+			progress(p)
+		}
+	}
+	return nil
+}
+
+// withinDir reports whether path, once cleaned, is root or somewhere under it.
+func withinDir(root, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvesWithin reports whether writing path stays under root once symlinks
+// already on disk are followed, so a link in the target directory can't
+// redirect a restored file elsewhere. path itself must not be a symlink.
+func resolvesWithin(root, path string) bool {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return false
+	}
+	realRoot, err := resolveExisting(root)
+	if err != nil {
+		return false
+	}
+	realDir, err := resolveExisting(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	return withinDir(realRoot, realDir)
+}
+
+// resolveExisting makes path absolute and resolves symlinks in the part of
+// it that exists; the rest is appended as is.
+func resolveExisting(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if dir == filepath.Dir(dir) {
+			return abs, nil
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
 }
 
 // AddCapability adds a new capability to the daemon dynamically
@@ -0,0 +1,123 @@
+package executor
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// snapshot maps every path under dir to its contents ("-> target" for links).
+func snapshot(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			files[rel] = "-> " + target
+		case d.IsDir():
+			files[rel] = "/"
+		default:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			files[rel] = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("snapshot %s: %v", dir, err)
+	}
+	return files
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+}
+
+// restoreSetup returns a SelfModification rooted in a temp dir and a target
+// directory holding one file.
+func restoreSetup(t *testing.T) (*SelfModification, string) {
+	t.Helper()
+	root := t.TempDir()
+	target := filepath.Join(root, "target")
+	writeFile(t, filepath.Join(target, "keep.txt"), "original")
+	return NewSelfModification(root), target
+}
+
+func TestRestoreBackupRejectsBackupNameOutsideBackups(t *testing.T) {
+	s, target := restoreSetup(t)
+	// A directory next to .backups that "../evil" would reach
+	writeFile(t, filepath.Join(s.ultronRoot, "evil", "keep.txt"), "overwritten")
+	before := snapshot(t, target)
+
+	if err := s.RestoreBackup(context.Background(), "../evil", target); err == nil {
+		t.Fatal("RestoreBackup succeeded with a ../ backup name")
+	}
+	if after := snapshot(t, target); !reflect.DeepEqual(before, after) {
+		t.Errorf("target changed: %v, want %v", after, before)
+	}
+}
+
+func TestRestoreBackupRejectsEntryEscapingTarget(t *testing.T) {
+	s, target := restoreSetup(t)
+	outside := filepath.Join(s.ultronRoot, "outside")
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The backup is ordinary, but a directory in the target links outside it
+	writeFile(t, filepath.Join(s.backupDir, "b1", "a.txt"), "restored")
+	writeFile(t, filepath.Join(s.backupDir, "b1", "sub", "evil.txt"), "escaped")
+	symlink(t, outside, filepath.Join(target, "sub"))
+	before := snapshot(t, target)
+
+	if err := s.RestoreBackup(context.Background(), "b1", target); err == nil {
+		t.Fatal("RestoreBackup succeeded writing through a link out of the target")
+	}
+	if after := snapshot(t, target); !reflect.DeepEqual(before, after) {
+		t.Errorf("target changed: %v, want %v", after, before)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil.txt")); !os.IsNotExist(err) {
+		t.Errorf("file written outside the target (stat error %v)", err)
+	}
+}
+
+func TestRestoreBackupRejectsSymlinkEntry(t *testing.T) {
+	s, target := restoreSetup(t)
+	secret := filepath.Join(s.ultronRoot, "secret")
+	writeFile(t, secret, "secret")
+	writeFile(t, filepath.Join(s.backupDir, "b1", "a.txt"), "restored")
+	symlink(t, secret, filepath.Join(s.backupDir, "b1", "link"))
+	before := snapshot(t, target)
+
+	if err := s.RestoreBackup(context.Background(), "b1", target); err == nil {
+		t.Fatal("RestoreBackup succeeded with a symlink entry")
+	}
+	if after := snapshot(t, target); !reflect.DeepEqual(before, after) {
+		t.Errorf("target changed: %v, want %v", after, before)
+	}
+}
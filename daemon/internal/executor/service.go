@@ -0,0 +1,320 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Service states ManageService reports, whatever the backend calls them.
+const (
+	ServiceRunning  = "running"
+	ServiceStopped  = "stopped"
+	ServiceStarting = "starting"
+	ServiceStopping = "stopping"
+	ServiceFailed   = "failed"
+	ServiceNotFound = "not_found"
+	ServiceUnknown  = "unknown"
+)
+
+// ServiceResult is the outcome of a service action, the same shape on every
+// backend.
+type ServiceResult struct {
+	Service string
+	Action  string
+	Backend string // systemd, launchd or sysv
+	Success bool
+	State   string        // One of the Service* states, read after the action
+	Message string        // One line for people: the failure, or where the service stands
+	PID     int           // Main process, if running and known
+	Enabled string        // systemd's unit file state (enabled, disabled, static, ...); empty elsewhere
+	Output  string        // What the backend printed for the action
+	Waited  time.Duration // restart_and_verify: time from the restart to the verdict
+}
+
+// servicePollInterval is how often RestartAndVerify checks the state.
+const servicePollInterval = 500 * time.Millisecond
+
+// serviceActions are the actions each backend supports.
+var serviceActions = map[string][]string{
+	"systemd": {"start", "stop", "restart", "reload", "enable", "disable", "status"},
+	"launchd": {"start", "stop", "restart", "status"},
+	"sysv":    {"start", "stop", "restart", "reload", "status"},
+}
+
+// DetectServiceManager returns the init system services are managed with:
+// systemd, launchd or sysv (the service command).
+func DetectServiceManager() (string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return "launchd", nil
+	case "linux":
+		if _, err := exec.LookPath("systemctl"); err == nil {
+			return "systemd", nil
+		} else if _, err := exec.LookPath("service"); err == nil {
+			return "sysv", nil
+		}
+		return "", fmt.Errorf("no supported service manager found")
+	default:
+		return "", fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	}
+}
+
+// ManageService runs action (start, stop, restart, reload, enable, disable
+// or status) on a systemd unit, launchd label or SysV service, then reads
+// the service's state. A failed action is reported in the result; the
+// error is for actions the backend can't do at all.
+func (e *Executor) ManageService(ctx context.Context, service, action string) (*ServiceResult, error) {
+	backend, err := DetectServiceManager()
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(serviceActions[backend], action) {
+		return nil, fmt.Errorf("unsupported action for %s: %s (use %s)", backend, action, strings.Join(serviceActions[backend], ", "))
+	}
+
+	res := &ServiceResult{Service: service, Action: action, Backend: backend, Success: true}
+	var actionErr error
+	if action != "status" {
+		res.Output, actionErr = runServiceAction(ctx, backend, service, action)
+	}
+	readServiceState(ctx, res)
+
+	switch {
+	case actionErr != nil:
+		res.Success = false
+		res.Message = fmt.Sprintf("%s %s failed: %s", action, service, commandMessage(res.Output, actionErr))
+	case res.State == ServiceNotFound:
+		res.Success = false
+		res.Message = fmt.Sprintf("%s not found", service)
+	default:
+		res.Message = fmt.Sprintf("%s is %s", service, res.State)
+		if res.PID > 0 {
+			res.Message += fmt.Sprintf(" (pid %d)", res.PID)
+		}
+	}
+	return res, nil
+}
+
+// RestartAndVerify restarts service, then polls its state until it has kept
+// running, with the same main process, for settle. It fails if the service
+// fails, goes away, or isn't settled within timeout - catching restarts that
+// succeed only for the service to crash straight after.
+func (e *Executor) RestartAndVerify(ctx context.Context, service string, timeout, settle time.Duration) (*ServiceResult, error) {
+	res, err := e.ManageService(ctx, service, "restart")
+	if err != nil {
+		return nil, err
+	}
+	res.Action = "restart_and_verify"
+	if !res.Success {
+		return res, nil
+	}
+
+	start := time.Now()
+	var runningSince time.Time
+	runningPID := 0
+	for {
+		now := time.Now()
+		res.Waited = now.Sub(start)
+		switch res.State {
+		case ServiceRunning:
+			if runningSince.IsZero() || res.PID != runningPID {
+				runningSince, runningPID = now, res.PID // A new process means it restarted again
+			}
+			if now.Sub(runningSince) >= settle {
+				res.Message = fmt.Sprintf("%s is running", service)
+				if res.PID > 0 {
+					res.Message += fmt.Sprintf(" (pid %d)", res.PID)
+				}
+				res.Message += fmt.Sprintf(" and stayed up for %v after restart", settle)
+				return res, nil
+			}
+		case ServiceFailed:
+			return restartNotVerified(res, fmt.Sprintf("%s failed after restart", service)), nil
+		case ServiceNotFound:
+			return restartNotVerified(res, fmt.Sprintf("%s not found after restart", service)), nil
+		case ServiceStopped:
+			// launchctl start returns before the job runs; elsewhere the
+			// restart has finished, so the service already exited
+			if res.Backend != "launchd" {
+				return restartNotVerified(res, fmt.Sprintf("%s stopped after restart", service)), nil
+			}
+			runningSince = time.Time{}
+		default:
+			runningSince = time.Time{}
+		}
+		if res.Waited >= timeout {
+			return restartNotVerified(res, fmt.Sprintf("%s did not stay up for %v within %v of restart (state %s)", service, settle, timeout, res.State)), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return restartNotVerified(res, fmt.Sprintf("gave up waiting for %s: %v", service, ctx.Err())), nil
+		case <-time.After(servicePollInterval):
+		}
+		readServiceState(ctx, res)
+	}
+}
+
+func restartNotVerified(res *ServiceResult, message string) *ServiceResult {
+	res.Success = false
+	res.Message = message
+	return res
+}
+
+// readServiceState sets res's State, PID and Enabled from its backend.
+func readServiceState(ctx context.Context, res *ServiceResult) {
+	res.PID = 0
+	switch res.Backend {
+	case "systemd":
+		systemdState(ctx, res)
+	case "launchd":
+		launchdState(ctx, res)
+	default:
+		sysvState(ctx, res)
+	}
+}
+
+// runServiceAction performs a state-changing action, with sudo where the
+// backend needs root and the daemon isn't.
+func runServiceAction(ctx context.Context, backend, service, action string) (string, error) {
+	var args []string
+	switch backend {
+	case "systemd":
+		args = []string{"systemctl", action, service}
+	case "sysv":
+		args = []string{"service", service, action}
+	case "launchd":
+		// Agents and daemons in the daemon's own domain; no sudo
+		if action == "restart" {
+			out, err := exec.CommandContext(ctx, "launchctl", "stop", service).CombinedOutput()
+			if err != nil {
+				return string(out), err
+			}
+			action = "start"
+		}
+		out, err := exec.CommandContext(ctx, "launchctl", action, service).CombinedOutput()
+		return string(out), err
+	}
+	if os.Geteuid() != 0 {
+		args = append([]string{"sudo", "-n"}, args...)
+	}
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	return string(out), err
+}
+
+// systemdState fills in state from systemctl show.
+func systemdState(ctx context.Context, res *ServiceResult) {
+	out, err := exec.CommandContext(ctx, "systemctl", "show", res.Service,
+		"--property=LoadState,ActiveState,SubState,MainPID,UnitFileState").Output()
+	if err != nil {
+		res.State = ServiceUnknown
+		return
+	}
+	props := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			props[k] = strings.TrimSpace(v)
+		}
+	}
+	res.Enabled = props["UnitFileState"]
+	res.PID, _ = strconv.Atoi(props["MainPID"])
+
+	if props["LoadState"] == "not-found" {
+		res.State = ServiceNotFound
+		return
+	}
+	switch props["ActiveState"] {
+	case "active", "reloading":
+		res.State = ServiceRunning
+	case "inactive":
+		res.State = ServiceStopped
+	case "activating":
+		res.State = ServiceStarting
+	case "deactivating":
+		res.State = ServiceStopping
+	case "failed":
+		res.State = ServiceFailed
+	default:
+		res.State = ServiceUnknown
+	}
+}
+
+// launchdPID and launchdExit read launchctl list <label>'s plist-style output.
+var (
+	launchdPID  = regexp.MustCompile(`"PID"\s*=\s*(\d+);`)
+	launchdExit = regexp.MustCompile(`"LastExitStatus"\s*=\s*(-?\d+);`)
+)
+
+// launchdState fills in state from launchctl list. A job without a PID is
+// stopped, or failed if it last exited with an error.
+func launchdState(ctx context.Context, res *ServiceResult) {
+	out, err := exec.CommandContext(ctx, "launchctl", "list", res.Service).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "Could not find service") {
+			res.State = ServiceNotFound
+		} else {
+			res.State = ServiceUnknown
+		}
+		return
+	}
+	if m := launchdPID.FindSubmatch(out); m != nil {
+		res.PID, _ = strconv.Atoi(string(m[1]))
+		res.State = ServiceRunning
+		return
+	}
+	res.State = ServiceStopped
+	if m := launchdExit.FindSubmatch(out); m != nil && string(m[1]) != "0" {
+		res.State = ServiceFailed
+	}
+}
+
+// sysvState reads state from service <name> status's exit code, which LSB
+// defines: 0 running, 1-3 stopped (1-2 with a stale pid file or lock, so
+// failed), 4 unknown service.
+func sysvState(ctx context.Context, res *ServiceResult) {
+	err := exec.CommandContext(ctx, "service", res.Service, "status").Run()
+	if err == nil {
+		res.State = ServiceRunning
+		return
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		res.State = ServiceUnknown
+		return
+	}
+	switch exitErr.ExitCode() {
+	case 1, 2:
+		res.State = ServiceFailed
+	case 3:
+		res.State = ServiceStopped
+	case 4:
+		res.State = ServiceNotFound
+	default:
+		res.State = ServiceUnknown
+	}
+}
+
+// commandMessage is the first line a failed command printed, or its error.
+func commandMessage(output string, err error) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	if first = strings.TrimSpace(first); first != "" {
+		return first
+	}
+	return err.Error()
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -2,13 +2,23 @@ package executor
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
 	"os"
 	"os/exec"
 	"os/user"
 	"runtime"
 	"strings"
+	"sync"
 	"syscall"
+
+	"github.com/ultron/daemon/internal/redact"
 )
 
 // SystemInfo returns comprehensive system information
@@ -34,6 +44,77 @@ type DiskUsage struct {
 	Used      uint64
 	Available uint64
 	Percent   float64
+
+	// Inodes; a disk can fill up with tiny files long before it runs out of
+	// bytes. All zero where the filesystem or platform doesn't report them.
+	InodesTotal   uint64
+	InodesUsed    uint64
+	InodesFree    uint64
+	InodesPercent float64
+}
+
+// diskPaths are the filesystems reported by system info and the resource
+// monitor. SetDiskPaths replaces the slice rather than changing it, so a
+// copy taken under diskPathsMu stays valid.
+var (
+	diskPaths   = []string{"/"}
+	diskPathsMu sync.RWMutex
+)
+
+// SetDiskPaths sets the filesystems to monitor. Empty entries are ignored;
+// an empty list keeps the current paths.
+func SetDiskPaths(paths []string) {
+	var cleaned []string
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			cleaned = append(cleaned, p)
+		}
+	}
+	if len(cleaned) > 0 {
+		diskPathsMu.Lock()
+		diskPaths = cleaned
+		diskPathsMu.Unlock()
+	}
+}
+
+// DiskPaths returns the monitored filesystems.
+func DiskPaths() []string {
+	diskPathsMu.RLock()
+	defer diskPathsMu.RUnlock()
+	return diskPaths
+}
+
+// GetDiskUsage reports usage for the filesystem containing path.
+// It returns an error on platforms without a disk usage implementation.
+func GetDiskUsage(path string) (DiskUsage, error) {
+	return diskUsage(path)
+}
+
+// newDiskUsage builds a DiskUsage from byte counts. free includes blocks
+// reserved for root; available is what unprivileged users can use.
+func newDiskUsage(total, free, available uint64) DiskUsage {
+	usage := DiskUsage{
+		Total:     total,
+		Used:      total - free,
+		Available: available,
+	}
+	if total > 0 {
+		usage.Percent = float64(usage.Used) / float64(total) * 100
+	}
+	return usage
+}
+
+// setInodes fills in inode counts from statfs's files and free-files fields.
+func (u *DiskUsage) setInodes(total, free uint64) {
+	if free > total {
+		free = total
+	}
+	u.InodesTotal = total
+	u.InodesFree = free
+	u.InodesUsed = total - free
+	if total > 0 {
+		u.InodesPercent = float64(u.InodesUsed) / float64(total) * 100
+	}
 }
 
 type MemoryInfo struct {
@@ -43,6 +124,91 @@ type MemoryInfo struct {
 	Percent   float64
 }
 
+// newMemoryInfo builds a MemoryInfo from the host total and what is
+// available to new allocations (free plus reclaimable cache).
+func newMemoryInfo(total, available uint64) MemoryInfo {
+	if available > total {
+		available = total
+	}
+	info := MemoryInfo{
+		Total:     total,
+		Used:      total - available,
+		Available: available,
+	}
+	if total > 0 {
+		info.Percent = float64(info.Used) / float64(total) * 100
+	}
+	return info
+}
+
+// GetMemoryInfo reports host memory usage (not the daemon's own heap).
+// It returns an error on platforms without an implementation.
+func GetMemoryInfo() (MemoryInfo, error) {
+	return memoryInfo()
+}
+
+// GetCPUPercent reports host CPU usage across all cores. On Linux it covers
+// the time since the previous call; the first call samples for 250ms.
+func GetCPUPercent() (float64, error) {
+	return cpuPercent()
+}
+
+// CPUSampler reports host CPU usage over the interval since its own previous
+// call, so a periodic caller (the resource monitor) measures its whole
+// interval rather than the time since some other caller's sample. On macOS
+// each call samples for a second instead.
+type CPUSampler struct {
+	mu    sync.Mutex
+	idle  uint64 // Previous sample, in clock ticks (Linux)
+	total uint64
+}
+
+// Percent returns CPU usage since the previous call; the first call samples
+// briefly.
+func (s *CPUSampler) Percent() (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sample()
+}
+
+// HostStats is a point-in-time view of host load, shared by heartbeats and
+// the resource monitor. Fields that can't be read on this platform are zero.
+type HostStats struct {
+	CPUPercent    float64
+	MemoryPercent float64
+	DiskPercent   float64 // First monitored disk path
+	Memory        MemoryInfo
+	Disks         map[string]DiskUsage
+}
+
+// GetHostStats collects CPU, memory and disk usage for the host.
+func GetHostStats() HostStats {
+	return GetHostStatsSampled(&hostCPU)
+}
+
+// GetHostStatsSampled is GetHostStats with CPU usage measured by cpu.
+func GetHostStatsSampled(cpu *CPUSampler) HostStats {
+	stats := HostStats{Disks: make(map[string]DiskUsage)}
+	if cpu, err := cpu.Percent(); err == nil {
+		stats.CPUPercent = cpu
+	}
+	if mem, err := memoryInfo(); err == nil {
+		stats.Memory = mem
+		stats.MemoryPercent = mem.Percent
+	}
+	for i, path := range DiskPaths() {
+		usage, err := diskUsage(path)
+		if err != nil {
+			continue
+		}
+		if i == 0 {
+			stats.DiskPercent = usage.Percent
+		}
+		stats.Disks[path] = usage
+	}
+	return stats
+}
+
 // GetSystemInfo returns detailed system information
 func (e *Executor) GetSystemInfo() (*SystemInfo, error) {
 	hostname, _ := os.Hostname()
@@ -50,13 +216,13 @@ func (e *Executor) GetSystemInfo() (*SystemInfo, error) {
 	wd, _ := os.Getwd()
 
 	info := &SystemInfo{
-		Hostname:    hostname,
-		OS:          runtime.GOOS,
-		Arch:        runtime.GOARCH,
-		NumCPU:      runtime.NumCPU(),
-		WorkingDir:  wd,
-		PID:         os.Getpid(),
-		Environment: make(map[string]string),
+		Hostname:   hostname,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		NumCPU:     runtime.NumCPU(),
+		WorkingDir: wd,
+		PID:        os.Getpid(),
+		DiskUsage:  make(map[string]DiskUsage),
 	}
 
 	if currentUser != nil {
@@ -64,24 +230,70 @@ func (e *Executor) GetSystemInfo() (*SystemInfo, error) {
 		info.HomeDir = currentUser.HomeDir
 	}
 
-	// Get environment variables
-	for _, env := range os.Environ() {
-		parts := strings.SplitN(env, "=", 2)
-		if len(parts) == 2 {
-			// Skip sensitive variables
-			key := strings.ToLower(parts[0])
-			if !strings.Contains(key, "password") &&
-				!strings.Contains(key, "secret") &&
-				!strings.Contains(key, "token") &&
-				!strings.Contains(key, "api_key") {
-				info.Environment[parts[0]] = parts[1]
-			}
+	info.Environment, _ = RedactedEnviron()
+
+	for _, path := range DiskPaths() {
+		if usage, err := diskUsage(path); err == nil {
+			info.DiskUsage[path] = usage
 		}
 	}
+	if mem, err := memoryInfo(); err == nil {
+		info.MemoryInfo = mem
+	}
 
 	return info, nil
 }
 
+// IsSensitiveEnvKey reports whether an environment variable likely holds a secret.
+func IsSensitiveEnvKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, marker := range sensitiveEnvMarkers {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// sensitiveEnvMarkers are the lowercase substrings IsSensitiveEnvKey looks for.
+var sensitiveEnvMarkers = []string{
+	"password", "secret", "token", "api_key",
+	"credential", "private", "auth", "session",
+}
+
+// ParseEnv turns KEY=VALUE entries, as from os.Environ, into a map. Entries
+// without an "=" are skipped.
+func ParseEnv(entries []string) map[string]string {
+	env := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if k, v, ok := strings.Cut(entry, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// RedactEnv returns a copy of env with the values of likely secrets replaced
+// by redact.Placeholder, and how many were replaced. Keys are kept so callers
+// can still see a variable is set.
+func RedactEnv(env map[string]string) (map[string]string, int) {
+	out := make(map[string]string, len(env))
+	redacted := 0
+	for k, v := range env {
+		if IsSensitiveEnvKey(k) {
+			v = redact.Placeholder
+			redacted++
+		}
+		out[k] = v
+	}
+	return out, redacted
+}
+
+// RedactedEnviron is the daemon's own environment, redacted.
+func RedactedEnviron() (map[string]string, int) {
+	return RedactEnv(ParseEnv(os.Environ()))
+}
+
 // RunAsRoot runs a command with sudo if available
 func (e *Executor) RunAsRoot(ctx context.Context, command string) (*ShellResult, error) {
 	// Check if already root
@@ -94,57 +306,42 @@ func (e *Executor) RunAsRoot(ctx context.Context, command string) (*ShellResult,
 	return e.ExecuteShell(ctx, sudoCmd, "", nil, nil)
 }
 
-// InstallPackage installs a package using the system package manager
-func (e *Executor) InstallPackage(ctx context.Context, packages []string) (*ShellResult, error) {
-	var cmd string
-
+// DetectPackageManager returns the system package manager: brew, apt, yum or pacman.
+func DetectPackageManager() (string, error) {
 	switch runtime.GOOS {
 	case "darwin":
-		cmd = fmt.Sprintf("brew install %s", strings.Join(packages, " "))
+		return "brew", nil
 	case "linux":
-		// Detect package manager
 		if _, err := exec.LookPath("apt-get"); err == nil {
-			cmd = fmt.Sprintf("sudo apt-get install -y %s", strings.Join(packages, " "))
+			return "apt", nil
 		} else if _, err := exec.LookPath("yum"); err == nil {
-			cmd = fmt.Sprintf("sudo yum install -y %s", strings.Join(packages, " "))
+			return "yum", nil
 		} else if _, err := exec.LookPath("pacman"); err == nil {
-			cmd = fmt.Sprintf("sudo pacman -S --noconfirm %s", strings.Join(packages, " "))
-		} else {
-			return nil, fmt.Errorf("no supported package manager found")
+			return "pacman", nil
 		}
+		return "", fmt.Errorf("no supported package manager found")
 	default:
-		return nil, fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+		return "", fmt.Errorf("unsupported OS: %s", runtime.GOOS)
 	}
-
-	return e.ExecuteShell(ctx, cmd, "", nil, nil)
 }
 
-// ManageService manages system services (start, stop, restart, status)
-func (e *Executor) ManageService(ctx context.Context, service, action string) (*ShellResult, error) {
-	var cmd string
+// InstallPackage installs a package using the system package manager
+func (e *Executor) InstallPackage(ctx context.Context, packages []string) (*ShellResult, error) {
+	manager, err := DetectPackageManager()
+	if err != nil {
+		return nil, err
+	}
 
-	switch runtime.GOOS {
-	case "darwin":
-		switch action {
-		case "start":
-			cmd = fmt.Sprintf("launchctl start %s", service)
-		case "stop":
-			cmd = fmt.Sprintf("launchctl stop %s", service)
-		case "restart":
-			cmd = fmt.Sprintf("launchctl stop %s && launchctl start %s", service, service)
-		case "status":
-			cmd = fmt.Sprintf("launchctl list | grep %s", service)
-		default:
-			return nil, fmt.Errorf("unsupported action: %s", action)
-		}
-	case "linux":
-		if _, err := exec.LookPath("systemctl"); err == nil {
-			cmd = fmt.Sprintf("sudo systemctl %s %s", action, service)
-		} else {
-			cmd = fmt.Sprintf("sudo service %s %s", service, action)
-		}
-	default:
-		return nil, fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	var cmd string
+	switch manager {
+	case "brew":
+		cmd = fmt.Sprintf("brew install %s", strings.Join(packages, " "))
+	case "apt":
+		cmd = fmt.Sprintf("sudo apt-get install -y %s", strings.Join(packages, " "))
+	case "yum":
+		cmd = fmt.Sprintf("sudo yum install -y %s", strings.Join(packages, " "))
+	case "pacman":
+		cmd = fmt.Sprintf("sudo pacman -S --noconfirm %s", strings.Join(packages, " "))
 	}
 
 	return e.ExecuteShell(ctx, cmd, "", nil, nil)
@@ -165,7 +362,8 @@ func (e *Executor) KillProcess(ctx context.Context, pid int, signal syscall.Sign
 	return process.Signal(signal)
 }
 
-// GetProcessList returns list of running processes
+// GetProcessList returns the raw ps/tasklist output; ListProcesses parses it
+// into structured entries.
 func (e *Executor) GetProcessList(ctx context.Context) (*ShellResult, error) {
 	var cmd string
 	switch runtime.GOOS {
@@ -257,19 +455,24 @@ func (e *Executor) CronOperation(ctx context.Context, operation string, args ...
 		if len(args) < 1 {
 			return nil, fmt.Errorf("cron entry required")
 		}
-		cmd := fmt.Sprintf("(crontab -l 2>/dev/null; echo %q) | crontab -", args[0])
+		cmd := fmt.Sprintf("(crontab -l 2>/dev/null; echo %s) | crontab -", shellQuote(args[0]))
 		return e.ExecuteShell(ctx, cmd, "", nil, nil)
 	case "remove":
 		if len(args) < 1 {
 			return nil, fmt.Errorf("pattern required")
 		}
-		cmd := fmt.Sprintf("crontab -l | grep -v %q | crontab -", args[0])
+		cmd := fmt.Sprintf("crontab -l | grep -v -- %s | crontab -", shellQuote(args[0]))
 		return e.ExecuteShell(ctx, cmd, "", nil, nil)
 	default:
 		return nil, fmt.Errorf("unknown cron operation: %s", operation)
 	}
 }
 
+// shellQuote wraps s in single quotes so sh passes it through literally.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 // EnvironmentSet sets environment variables for future commands
 func (e *Executor) EnvironmentSet(key, value string) {
 	os.Setenv(key, value)
@@ -284,3 +487,32 @@ func (e *Executor) EnvironmentGet(key string) string {
 func (e *Executor) ChangeDirectory(path string) error {
 	return os.Chdir(path)
 }
+
+// HashFile returns the hex digest of the file at path. algorithm is one of
+// md5, sha1, sha256 or sha512; empty means sha256.
+func HashFile(path, algorithm string) (string, error) {
+	var h hash.Hash
+	switch strings.ToLower(algorithm) {
+	case "", "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	case "sha1":
+		h = sha1.New()
+	case "md5":
+		h = md5.New()
+	default:
+		return "", fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,231 @@
+// Backup handlers - snapshot files before risky edits and restore them.
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	backupDir       = "backups"
+	backupRetention = 10
+	backupMu        sync.Mutex
+)
+
+// SetBackupConfig sets where backup_file keeps snapshots and how many it
+// keeps per file (0 keeps them all).
+func SetBackupConfig(dir string, retention int) {
+	if dir != "" {
+		backupDir = dir
+	}
+	if retention >= 0 {
+		backupRetention = retention
+	}
+}
+
+// backupIDFormat sorts lexically in time order.
+const backupIDFormat = "20060102-150405.000000000"
+
+// FileBackup is one stored snapshot of a file.
+type FileBackup struct {
+	ID        string    `json:"backup_id"`
+	Path      string    `json:"path"` // the file it is a copy of
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+}
+
+// backupDirFor is the directory holding every snapshot of path. The whole
+// absolute path is escaped into one directory name so it can be recovered.
+func backupDirFor(path string) string {
+	return filepath.Join(backupDir, url.PathEscape(path))
+}
+
+// absPath validates and cleans a path param.
+func absPath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("no path provided")
+	}
+	return filepath.Abs(path)
+}
+
+// listFileBackups returns path's backups, newest first.
+func listFileBackups(path string) ([]FileBackup, error) {
+	entries, err := os.ReadDir(backupDirFor(path))
+	if os.IsNotExist(err) {
+		return []FileBackup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]FileBackup, 0, len(entries))
+	for _, e := range entries {
+		created, err := time.ParseInLocation(backupIDFormat, e.Name(), time.Local)
+		if err != nil || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, FileBackup{ID: e.Name(), Path: path, CreatedAt: created, Size: info.Size()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ID > backups[j].ID })
+	return backups, nil
+}
+
+// backupFile copies path into the backup directory, keeping its permissions,
+// and prunes snapshots beyond the retention limit. Caller holds backupMu.
+func backupFile(path string) (*FileBackup, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := backupDirFor(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup dir: %w", err)
+	}
+	now := time.Now()
+	id := now.Format(backupIDFormat)
+	if err := writeFileVerified(filepath.Join(dir, id), data, info.Mode().Perm(), sha256Hex(data)); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	if backupRetention > 0 {
+		if backups, err := listFileBackups(path); err == nil && len(backups) > backupRetention {
+			for _, old := range backups[backupRetention:] {
+				os.Remove(filepath.Join(dir, old.ID))
+			}
+		}
+	}
+	return &FileBackup{ID: id, Path: path, CreatedAt: now, Size: int64(len(data))}, nil
+}
+
+func handleBackupFile(params map[string]interface{}) map[string]interface{} {
+	rawPath, _ := params["path"].(string)
+	path, err := absPath(rawPath)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	backupMu.Lock()
+	defer backupMu.Unlock()
+	backup, err := backupFile(path)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return map[string]interface{}{
+		"success":   true,
+		"path":      path,
+		"backup_id": backup.ID,
+		"size":      backup.Size,
+	}
+}
+
+// handleRestoreFile puts a backup (backup_id, default the newest) back in
+// place. The current file is backed up first, so a restore can be undone.
+func handleRestoreFile(params map[string]interface{}) map[string]interface{} {
+	rawPath, _ := params["path"].(string)
+	id, _ := params["backup_id"].(string)
+	path, err := absPath(rawPath)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	if id == "" {
+		backups, err := listFileBackups(path)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		if len(backups) == 0 {
+			return map[string]interface{}{"success": false, "error": "no backups of " + path}
+		}
+		id = backups[0].ID
+	}
+	if strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return map[string]interface{}{"success": false, "error": "invalid backup_id: " + id}
+	}
+
+	source := filepath.Join(backupDirFor(path), id)
+	info, err := os.Stat(source)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": fmt.Sprintf("backup %s of %s not found", id, path)}
+	}
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	result := map[string]interface{}{
+		"success":       true,
+		"path":          path,
+		"restored_from": id,
+		"size":          len(data),
+	}
+	if _, err := os.Stat(path); err == nil {
+		previous, err := backupFile(path)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": "backing up current file: " + err.Error()}
+		}
+		result["previous_backup_id"] = previous.ID
+	}
+
+	if err := writeFileVerified(path, data, info.Mode().Perm(), sha256Hex(data)); err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return result
+}
+
+// handleListBackups lists the backups of path, newest first, or of every
+// backed-up file when path is omitted.
+func handleListBackups(params map[string]interface{}) map[string]interface{} {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	if p, _ := params["path"].(string); p != "" {
+		path, err := absPath(p)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		backups, err := listFileBackups(path)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		return map[string]interface{}{"success": true, "path": path, "backups": backups, "count": len(backups)}
+	}
+
+	entries, err := os.ReadDir(backupDir)
+	if err != nil && !os.IsNotExist(err) {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	all := []FileBackup{}
+	for _, e := range entries {
+		path, err := url.PathUnescape(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		backups, err := listFileBackups(path)
+		if err != nil {
+			continue
+		}
+		all = append(all, backups...)
+	}
+	return map[string]interface{}{"success": true, "backups": all, "count": len(all)}
+}
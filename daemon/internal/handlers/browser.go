@@ -0,0 +1,240 @@
+// Browser handlers - console capture and other page state beyond the basic actions.
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ultron/daemon/internal/browser"
+)
+
+const (
+	consolePollInterval = 500 * time.Millisecond // How often browser_console_stream checks for new messages
+	downloadChunkSize   = 64 * 1024              // Raw bytes per browser_download_stream chunk
+)
+
+func handleBrowserGetConsole(params map[string]interface{}) map[string]interface{} {
+	result, err := browser.DefaultManager.GetConsole()
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	messages := result.Console
+	if messages == nil {
+		messages = []browser.ConsoleMessage{}
+	}
+	return map[string]interface{}{
+		"success": result.Success,
+		"console": messages,
+		"count":   len(messages),
+		"error":   result.Error,
+	}
+}
+
+// handleBrowserConsoleStream pushes console messages to Prime as they appear,
+// for up to duration seconds (default 60).
+func handleBrowserConsoleStream(params map[string]interface{}, stream StreamFunc) map[string]interface{} {
+	duration, _ := params["duration"].(float64)
+	if duration == 0 {
+		duration = 60
+	}
+
+	deadline := time.Now().Add(time.Duration(duration * float64(time.Second)))
+	batcher := newStreamBatcher(stream, "console")
+	count := 0
+	var streamErr error
+
+	for streamErr == nil {
+		result, err := browser.DefaultManager.GetConsole()
+		if err != nil {
+			streamErr = err
+			break
+		}
+		if !result.Success {
+			return map[string]interface{}{"success": false, "count": count, "error": result.Error}
+		}
+		for _, msg := range result.Console {
+			if streamErr = batcher.Add(msg, len(msg.Text)); streamErr != nil {
+				break
+			}
+			count++
+		}
+		if streamErr != nil || !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(consolePollInterval)
+	}
+	if err := batcher.Flush(); streamErr == nil {
+		streamErr = err
+	}
+
+	result := map[string]interface{}{
+		"success":  streamErr == nil,
+		"count":    count,
+		"followed": true,
+	}
+	if streamErr != nil {
+		result["error"] = streamErr.Error()
+	}
+	return result
+}
+
+// handleBrowserDownloadStream triggers a download in the browser, streams the
+// file to Prime in base64 chunks and removes the local copy afterwards.
+func handleBrowserDownloadStream(params map[string]interface{}, stream StreamFunc) map[string]interface{} {
+	selector, _ := params["selector"].(string)
+	url, _ := params["url"].(string)
+	timeout, _ := params["timeout"].(float64)
+	if selector == "" && url == "" {
+		return map[string]interface{}{"success": false, "error": "selector or url required"}
+	}
+	if timeout == 0 {
+		timeout = 60000
+	}
+
+	result, err := browser.DefaultManager.Download(selector, url, int(timeout))
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	if !result.Success {
+		return map[string]interface{}{"success": false, "error": result.Error}
+	}
+	defer func() {
+		os.Remove(result.Path)
+		os.Remove(filepath.Dir(result.Path)) // Temp dir from the browser script; fails harmlessly if not empty
+	}()
+
+	f, err := os.Open(result.Path)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	buf := make([]byte, downloadChunkSize)
+	var offset int64
+	for {
+		n, readErr := f.Read(buf)
+		if n > 0 {
+			hash.Write(buf[:n])
+			if err := stream(map[string]interface{}{
+				"filename": result.Filename,
+				"offset":   offset,
+				"data":     base64.StdEncoding.EncodeToString(buf[:n]),
+			}); err != nil {
+				return map[string]interface{}{"success": false, "error": err.Error()}
+			}
+			offset += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return map[string]interface{}{"success": false, "error": readErr.Error()}
+		}
+	}
+
+	return map[string]interface{}{
+		"success":  true,
+		"filename": result.Filename,
+		"url":      result.URL,
+		"size":     offset,
+		"sha256":   hex.EncodeToString(hash.Sum(nil)),
+	}
+}
+
+func handleBrowserGetStorage(params map[string]interface{}) map[string]interface{} {
+	result, err := browser.DefaultManager.GetStorage()
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return map[string]interface{}{
+		"success": result.Success,
+		"storage": result.Storage,
+		"error":   result.Error,
+	}
+}
+
+func handleBrowserSetStorage(params map[string]interface{}) map[string]interface{} {
+	clear, _ := params["clear"].(bool)
+	storage := browser.WebStorage{
+		LocalStorage:   stringMap(params["local_storage"]),
+		SessionStorage: stringMap(params["session_storage"]),
+	}
+	if storage.LocalStorage == nil && storage.SessionStorage == nil && !clear {
+		return map[string]interface{}{"success": false, "error": "local_storage or session_storage required"}
+	}
+
+	result, err := browser.DefaultManager.SetStorage(storage, clear)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return map[string]interface{}{
+		"success": result.Success,
+		"message": result.Message,
+		"error":   result.Error,
+	}
+}
+
+func handleBrowserSaveState(params map[string]interface{}) map[string]interface{} {
+	result, err := browser.DefaultManager.SaveState()
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return map[string]interface{}{
+		"success": result.Success,
+		"state":   result.State,
+		"error":   result.Error,
+	}
+}
+
+// handleBrowserLoadState accepts the state from browser_save_state either as
+// an object or as its JSON string.
+func handleBrowserLoadState(params map[string]interface{}) map[string]interface{} {
+	headless, _ := params["headless"].(bool)
+
+	var state json.RawMessage
+	switch v := params["state"].(type) {
+	case string:
+		state = json.RawMessage(v)
+	case map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		state = data
+	}
+	if len(state) == 0 || !json.Valid(state) {
+		return map[string]interface{}{"success": false, "error": "state must be a storage_state object or JSON string"}
+	}
+
+	result, err := browser.DefaultManager.LoadState(state, headless)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return map[string]interface{}{
+		"success": result.Success,
+		"message": result.Message,
+		"error":   result.Error,
+	}
+}
+
+// stringMap converts a decoded JSON object to map[string]string, keeping only string values.
+func stringMap(v interface{}) map[string]string {
+	raw, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	out := make(map[string]string, len(raw))
+	for k, val := range raw {
+		if s, ok := val.(string); ok {
+			out[k] = s
+		}
+	}
+	return out
+}
@@ -5,45 +5,104 @@ package handlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/ultron/daemon/internal/browser"
 	"github.com/ultron/daemon/internal/computer"
+	"github.com/ultron/daemon/internal/executor"
 )
 
 // RegisterBuiltins registers all built-in command handlers.
 func RegisterBuiltins() {
 	// Core commands
 	Register("ping", handlePing)
-	Register("shell", handleShell)
+	RegisterStream("shell", handleShell)
+	Register("cancel_command", handleCancelCommand)
 	Register("read_file", handleReadFile)
 	Register("write_file", handleWriteFile)
+	Register("verify_file", handleVerifyFile)
 	Register("delete_file", handleDeleteFile)
+	Register("move_file", handleMoveFile)
+	Register("write_files", handleWriteFiles)
+	Register("delete_files", handleDeleteFiles)
+	Register("backup_file", handleBackupFile)
+	Register("restore_file", handleRestoreFile)
+	Register("list_backups", handleListBackups)
+	Register("list_trash", handleListTrash)
+	Register("restore_from_trash", handleRestoreFromTrash)
+	Register("empty_trash", handleEmptyTrash)
+	RegisterStream("follow_file", handleFollowFile)
+
+	// Coordination
+	Register("acquire_lock", handleAcquireLock)
+	Register("release_lock", handleReleaseLock)
 	Register("list_files", handleListFiles)
+	Register("list_dir_with_git", handleListDirWithGit)
 	Register("system_info", handleSystemInfo)
+	Register("trace_prime", handleTracePrime)
 
 	// Process management
 	Register("list_processes", handleListProcesses)
 	Register("kill_process", handleKillProcess)
+	Register("process_env", handleProcessEnv)
+	Register("process_open_files", handleProcessOpenFiles)
+
+	// Filesystems (requires the "mount" capability)
+	Register("mount", handleMount)
+	Register("unmount", handleUnmount)
+
+	// Sessions
+	Register("session", handleSession)
+	Register("session_history", handleSessionHistory)
 
 	// Docker
 	Register("docker", handleDocker)
+	Register("docker_cp", handleDockerCp)
+	RegisterStream("docker_stats_stream", handleDockerStatsStream)
 
 	// Git
 	Register("git", handleGit)
 
 	// Service management
 	Register("manage_service", handleManageService)
+	Register("install_service", handleInstallService)
+
+	// Packages
+	Register("install_package", handleInstallPackage)
+
+	// Scheduled tasks
+	Register("cron", handleCron)
+
+	// Soul daemon only; refuses unless EnableSelfModify was called
+	RegisterStream("self_modify", handleSelfModify)
+
+	// Logs
+	RegisterStream("journal", handleJournal)
+	Register("get_logs", handleGetLogs)
+	Register("get_log_level", handleGetLogLevel)
+	Register("set_log_level", handleSetLogLevel)
+
+	// Key-value store
+	Register("kv_get", handleKVGet)
+	Register("kv_set", handleKVSet)
+	Register("kv_delete", handleKVDelete)
+	Register("kv_list", handleKVList)
 
 	// Generic exec - runs any command
-	Register("exec", handleExec)
+	RegisterStream("exec", handleExec)
 
 	// Computer use (Anthropic Computer Use API)
 	Register("computer", handleComputer)
@@ -61,6 +120,55 @@ func RegisterBuiltins() {
 	Register("browser_scroll", handleBrowserScroll)
 	Register("browser_get_elements", handleBrowserGetElements)
 	Register("browser_close", handleBrowserClose)
+	Register("browser_get_console", handleBrowserGetConsole)
+	RegisterStream("browser_console_stream", handleBrowserConsoleStream)
+	RegisterStream("browser_download_stream", handleBrowserDownloadStream)
+	Register("browser_get_storage", handleBrowserGetStorage)
+	Register("browser_set_storage", handleBrowserSetStorage)
+	Register("browser_save_state", handleBrowserSaveState)
+	Register("browser_load_state", handleBrowserLoadState)
+
+	// Capability each command type needs; see DAEMON_CAPABILITIES
+	RequireCapability("shell", "shell", "exec")
+	RequireCapability("files",
+		"read_file", "write_file", "verify_file", "delete_file", "move_file", "write_files", "delete_files",
+		"backup_file", "restore_file", "list_backups", "list_files", "acquire_lock", "release_lock",
+		"list_trash", "restore_from_trash", "empty_trash", "follow_file", "list_dir_with_git",
+	)
+	RequireCapability("process", "list_processes", "kill_process", "process_env", "process_open_files")
+	RequireCapability("mount", "mount", "unmount")
+	RequireCapability("session", "session", "session_history")
+	RequireCapability("docker", "docker", "docker_cp", "docker_stats_stream")
+	RequireCapability("git", "git")
+	RequireCapability("services", "manage_service", "install_service")
+	RequireCapability("package", "install_package")
+	RequireCapability("cron", "cron")
+	RequireCapability("self-modify", "self_modify")
+	RequireCapability("computer", "computer")
+	RequireCapability("browser",
+		"browser_launch", "browser_goto", "browser_click", "browser_type", "browser_get_text",
+		"browser_get_content", "browser_screenshot", "browser_evaluate", "browser_wait",
+		"browser_scroll", "browser_get_elements", "browser_close", "browser_get_console",
+		"browser_console_stream", "browser_download_stream", "browser_get_storage",
+		"browser_set_storage", "browser_save_state", "browser_load_state",
+	)
+
+	// One at a time: package managers hold a global lock, crontab edits are
+	// read-modify-write, and self_modify rebuilds the daemon in place
+	SetConcurrency("install_package", 1)
+	SetConcurrency("cron", 1)
+	SetConcurrency("self_modify", 1)
+
+	// Read-only commands that can be retried without opting in
+	MarkIdempotent(
+		"ping", "read_file", "verify_file", "list_files", "list_dir_with_git", "list_backups", "list_trash", "system_info", "trace_prime",
+		"list_processes", "process_env", "process_open_files",
+		"get_logs", "get_log_level", "kv_get", "kv_list", "session_history",
+		"browser_get_text", "browser_get_content", "browser_get_elements", "browser_get_storage",
+	)
+	// Also allowed in read-only mode: they only observe, but aren't safe to
+	// retry blindly (followed streams) or act on commands already running
+	MarkReadOnly("cancel_command", "journal", "docker_stats_stream", "follow_file")
 }
 
 func handlePing(params map[string]interface{}) map[string]interface{} {
@@ -71,10 +179,54 @@ func handlePing(params map[string]interface{}) map[string]interface{} {
 	}
 }
 
-func handleShell(params map[string]interface{}) map[string]interface{} {
+// Shell timeouts: commands run for timeout seconds (default 60), capped at maxShellTimeout.
+var (
+	defaultShellTimeout = 60 * time.Second
+	maxShellTimeout     = time.Hour
+)
+
+// SetMaxShellTimeout caps the timeout a shell command may request.
+func SetMaxShellTimeout(d time.Duration) {
+	if d > 0 {
+		maxShellTimeout = d
+	}
+}
+
+// parseEnv reads a command's "env" param: an object of variable names to
+// string values. The daemon's own environment is inherited and these
+// variables are added on top, replacing any with the same name.
+func parseEnv(raw interface{}) (map[string]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("env must be an object of strings")
+	}
+	env := make(map[string]string, len(obj))
+	for k, v := range obj {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return nil, fmt.Errorf("invalid env variable name: %q", k)
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("env %s must be a string", k)
+		}
+		env[k] = s
+	}
+	return env, nil
+}
+
+// handleShell runs a command, streaming its output as partial results
+// ({"output": [{"stream": "stdout"|"stderr", "line": ...}, ...]}) while it runs.
+// The final result still carries the complete (capped) stdout and stderr.
+// run_as (username or uid) runs the command as another account.
+func handleShell(params map[string]interface{}, stream StreamFunc) map[string]interface{} {
 	command, _ := params["command"].(string)
+	commandID, _ := params["command_id"].(string)
 	workDir, _ := params["working_directory"].(string)
 	useSudo, _ := params["use_sudo"].(bool)
+	runAsSpec, _ := params["run_as"].(string)
 	timeoutSec, _ := params["timeout"].(float64)
 
 	if command == "" {
@@ -84,49 +236,181 @@ func handleShell(params map[string]interface{}) map[string]interface{} {
 		}
 	}
 
+	env, err := parseEnv(params["env"])
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	if useSudo && runAsSpec != "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "use_sudo and run_as can't be combined; use run_as=root instead",
+		}
+	}
 	if useSudo {
-		command = "sudo " + command
+		command = sudoCommand(command, env)
 	}
 
-	if timeoutSec == 0 {
-		timeoutSec = 60
+	// run_as switches credentials directly when the daemon is root, and
+	// otherwise goes through non-interactive sudo
+	var runAs *executor.RunAsUser
+	sudoRunAs := false
+	if runAsSpec != "" {
+		target, err := executor.LookupRunAsUser(runAsSpec)
+		if err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			}
+		}
+		switch {
+		case os.Geteuid() >= 0 && uint32(os.Geteuid()) == target.UID:
+			// Already running as that user
+		case os.Geteuid() == 0:
+			runAs = target
+		default:
+			if _, err := exec.LookPath("sudo"); err != nil {
+				return map[string]interface{}{
+					"success":         false,
+					"error":           fmt.Sprintf("run_as %s needs the daemon to run as root or have sudo, and sudo is not installed", target.Username),
+					"privilege_error": true,
+				}
+			}
+			command = sudoCommand(command, env, "-n", "-u", target.Username)
+			sudoRunAs = true
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSec)*time.Second)
+	if timeoutSec <= 0 {
+		timeoutSec = defaultShellTimeout.Seconds()
+	}
+	timeout := time.Duration(timeoutSec * float64(time.Second))
+	if timeout > maxShellTimeout {
+		timeout = maxShellTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
-	} else {
-		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	// Track so Prime can cancel it with cancel_command
+	ctx, release := executor.DefaultExecutor.Track(ctx, commandID)
+	defer release()
+
+	// A single reader keeps lines in the order the executor produced them
+	outputChan := make(chan executor.OutputLine, 100)
+	streamed := make(chan struct{})
+	go func() {
+		defer close(streamed)
+		batcher := newStreamBatcher(stream, "output")
+		for line := range outputChan {
+			// Once Prime stops listening Add fails; keep draining so the command isn't blocked
+			batcher.Add(line, len(line.Line)+1)
+		}
+		batcher.Flush()
+	}()
+
+	res, err := executor.DefaultExecutor.ExecuteShellAs(ctx, command, workDir, env, runAs, outputChan)
+	close(outputChan)
+	<-streamed // Every partial result goes out before the final one
+	if err != nil {
+		return map[string]interface{}{
+			"success":   false,
+			"error":     err.Error(),
+			"exit_code": -1,
+		}
 	}
 
-	if workDir != "" {
-		cmd.Dir = workDir
+	result := map[string]interface{}{
+		"success":   res.Error == nil && res.ExitCode == 0,
+		"output":    res.Stdout + res.Stderr,
+		"stdout":    res.Stdout,
+		"stderr":    res.Stderr,
+		"exit_code": res.ExitCode,
+		"truncated": res.Truncated,
+	}
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		// Distinct from a non-zero exit so Prime can tell the two apart
+		result["success"] = false
+		result["error"] = fmt.Sprintf("command timed out after %gs", timeout.Seconds())
+		result["timed_out"] = true
+	case ctx.Err() != nil:
+		result["success"] = false
+		result["error"] = ctx.Err().Error()
+	case res.Error != nil:
+		result["error"] = res.Error.Error()
+	case sudoRunAs && res.ExitCode == 1 && sudoRefused(res.Stderr):
+		result["error"] = fmt.Sprintf("run_as %s: the daemon isn't root and sudo refused without a password; run the daemon as root or allow it passwordless sudo to that user", runAsSpec)
+		result["privilege_error"] = true
+	case res.ExitCode != 0:
+		result["error"] = fmt.Sprintf("exit status %d", res.ExitCode)
 	}
 
-	output, err := cmd.CombinedOutput()
+	return result
+}
 
-	result := map[string]interface{}{
-		"success":   err == nil,
-		"output":    string(output),
-		"exit_code": 0,
+// sudoCommand wraps command in sudo with the given flags. The whole command
+// runs in a shell under sudo, so every part of a pipeline or command list
+// gets the new credentials, not just the first. sudo resets the
+// environment, so the variables we were asked to set are preserved.
+func sudoCommand(command string, env map[string]string, flags ...string) string {
+	args := append([]string{"sudo"}, flags...)
+	if len(env) > 0 {
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		args = append(args, "--preserve-env="+strings.Join(keys, ","))
 	}
+	args = append(args, "--", "sh", "-c", command)
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
 
-	if err != nil {
-		result["error"] = err.Error()
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result["exit_code"] = exitErr.ExitCode()
+// shellQuote wraps s in single quotes so sh passes it through literally.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// sudoRefused reports whether sudo's stderr says it wouldn't run the command.
+func sudoRefused(stderr string) bool {
+	return strings.Contains(stderr, "a password is required") ||
+		strings.Contains(stderr, "is not allowed to execute") ||
+		strings.Contains(stderr, "is not in the sudoers file")
+}
+
+func handleCancelCommand(params map[string]interface{}) map[string]interface{} {
+	target, _ := params["target_command_id"].(string)
+	if target == "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "no target_command_id provided",
 		}
 	}
 
-	return result
+	if !executor.DefaultExecutor.Cancel(target) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("no in-flight command: %s", target),
+		}
+	}
+
+	return map[string]interface{}{
+		"success":           true,
+		"target_command_id": target,
+	}
 }
 
-func handleExec(params map[string]interface{}) map[string]interface{} {
+func handleExec(params map[string]interface{}, stream StreamFunc) map[string]interface{} {
 	// Generic exec - just calls shell
-	return handleShell(params)
+	return handleShell(params, stream)
 }
 
 func handleReadFile(params map[string]interface{}) map[string]interface{} {
@@ -181,6 +465,7 @@ func handleReadFile(params map[string]interface{}) map[string]interface{} {
 func handleWriteFile(params map[string]interface{}) map[string]interface{} {
 	path, _ := params["path"].(string)
 	content, _ := params["content"].(string)
+	encoding, _ := params["encoding"].(string)
 	appendMode, _ := params["append"].(bool)
 	mode, _ := params["mode"].(float64)
 
@@ -191,20 +476,38 @@ func handleWriteFile(params map[string]interface{}) map[string]interface{} {
 		}
 	}
 
-	var fileMode os.FileMode = 0644
-	if mode > 0 {
-		fileMode = os.FileMode(int(mode))
+	data, err := decodeContent(content, encoding)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
 	}
 
-	var err error
+	// Reject corrupted transfers before touching the disk
+	checksum := sha256Hex(data)
+	expected, _ := params["expected_checksum"].(string)
+	expected = strings.ToLower(strings.TrimPrefix(expected, "sha256:"))
+	if expected != "" && expected != checksum {
+		return map[string]interface{}{
+			"success":  false,
+			"error":    fmt.Sprintf("checksum mismatch: expected %s, content is %s; nothing written", expected, checksum),
+			"checksum": checksum,
+		}
+	}
+
+	fileMode := fileModeFor(path, mode)
 	if appendMode {
-		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, fileMode)
+		var f *os.File
+		f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, fileMode)
 		if err == nil {
-			_, err = f.WriteString(content)
-			f.Close()
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
 		}
 	} else {
-		err = ioutil.WriteFile(path, []byte(content), fileMode)
+		err = writeFileVerified(path, data, fileMode, checksum)
 	}
 
 	if err != nil {
@@ -215,10 +518,138 @@ func handleWriteFile(params map[string]interface{}) map[string]interface{} {
 	}
 
 	return map[string]interface{}{
-		"success": true,
-		"path":    path,
-		"size":    len(content),
+		"success":  true,
+		"path":     path,
+		"size":     len(data),
+		"checksum": checksum, // SHA-256 of the bytes written
+	}
+}
+
+// decodeContent turns write_file content into bytes. Binary content travels
+// base64-encoded; plain text is the default.
+func decodeContent(content, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", "utf8":
+		return []byte(content), nil
+	case "base64":
+		data, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 content: %v", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %q (want utf8 or base64)", encoding)
+	}
+}
+
+// fileModeFor picks the permissions for a write: the requested mode, else
+// the existing file's (so overwriting keeps them), else 0644.
+func fileModeFor(path string, mode float64) os.FileMode {
+	if mode > 0 {
+		return os.FileMode(int(mode))
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// handleVerifyFile checks a file on disk against an expected digest, so Prime
+// can confirm a pushed file is intact without reading it back.
+func handleVerifyFile(params map[string]interface{}) map[string]interface{} {
+	path, _ := params["path"].(string)
+	algorithm, _ := params["algorithm"].(string)
+	expected, _ := params["expected"].(string)
+
+	if path == "" || expected == "" {
+		return map[string]interface{}{"success": false, "error": "path and expected required"}
+	}
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	algorithm = strings.ToLower(algorithm)
+	// Accept "sha256:abc..." as well as a bare digest
+	expected = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(expected)), algorithm+":")
+
+	actual, err := executor.HashFile(path, algorithm)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	return map[string]interface{}{
+		"success":   true,
+		"path":      path,
+		"algorithm": algorithm,
+		"match":     actual == expected,
+		"expected":  expected,
+		"actual":    actual,
+	}
+}
+
+// writeFileVerified writes data to a temp file next to path, reads it back
+// to confirm it hashes to checksum, then renames it into place. On any
+// failure the temp file is removed and path is left untouched.
+func writeFileVerified(path string, data []byte, mode os.FileMode, checksum string) error {
+	tmpPath, target, err := stageFileVerified(path, data, mode, checksum)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		os.Remove(tmpPath)
+		return err
 	}
+	return nil
+}
+
+// stageFileVerified does the first half of writeFileVerified: it leaves the
+// verified content in a temp file and returns it along with the path it
+// should be renamed to (path with symlinks resolved). The caller owns the
+// temp file.
+func stageFileVerified(path string, data []byte, mode os.FileMode, checksum string) (tmpPath, target string, err error) {
+	// Write through symlinks rather than replacing them
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", "", err
+	}
+	tmpPath = tmp.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, mode)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	written, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return "", "", err
+	}
+	if got := sha256Hex(written); got != checksum {
+		err = fmt.Errorf("checksum mismatch after write: expected %s, got %s; nothing written", checksum, got)
+		return "", "", err
+	}
+	return tmpPath, path, nil
 }
 
 func handleDeleteFile(params map[string]interface{}) map[string]interface{} {
@@ -231,6 +662,42 @@ func handleDeleteFile(params map[string]interface{}) map[string]interface{} {
 			"error":   "no path provided",
 		}
 	}
+	if err := checkProtected(path); err != nil {
+		return map[string]interface{}{
+			"success":   false,
+			"error":     err.Error(),
+			"protected": true,
+		}
+	}
+	if dryRun, _ := params["dry_run"].(bool); dryRun {
+		return deleteDryRun(path, recursive)
+	}
+	if count, err := checkDeleteConfirmation(path, recursive, params); err != nil {
+		return map[string]interface{}{
+			"success":               false,
+			"error":                 err.Error(),
+			"count":                 count,
+			"confirmation_required": true,
+		}
+	}
+
+	// Recursive deletes go to the trash unless the caller opts out
+	if useTrash(params, recursive) {
+		abs, err := absPath(path)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		entry, err := moveToTrash(abs, abs)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		return map[string]interface{}{
+			"success":  true,
+			"path":     path,
+			"trashed":  true,
+			"trash_id": entry.ID,
+		}
+	}
 
 	var err error
 	if recursive {
@@ -252,15 +719,76 @@ func handleDeleteFile(params map[string]interface{}) map[string]interface{} {
 	}
 }
 
+// handleMoveFile moves or renames source to destination, atomically within a
+// filesystem. An existing destination is only replaced with overwrite.
+// Protected paths can't be moved away or overwritten.
+func handleMoveFile(params map[string]interface{}) map[string]interface{} {
+	source, _ := params["source"].(string)
+	destination, _ := params["destination"].(string)
+	overwrite, _ := params["overwrite"].(bool)
+	createDirs, _ := params["create_dirs"].(bool)
+
+	if source == "" || destination == "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "source and destination required",
+		}
+	}
+	for _, path := range []string{source, destination} {
+		if err := checkProtected(path); err != nil {
+			return map[string]interface{}{
+				"success":   false,
+				"error":     err.Error(),
+				"protected": true,
+			}
+		}
+	}
+	if createDirs {
+		if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+	}
+
+	absSource, _ := filepath.Abs(source)
+	absDest, _ := filepath.Abs(destination)
+	_, statErr := os.Lstat(destination)
+	overwritten := statErr == nil && absSource != absDest
+	if err := executor.DefaultExecutor.MoveFile(source, destination, overwrite); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	return map[string]interface{}{
+		"success":     true,
+		"source":      source,
+		"destination": destination,
+		"overwritten": overwritten,
+	}
+}
+
 func handleListFiles(params map[string]interface{}) map[string]interface{} {
 	path, _ := params["path"].(string)
 	recursive, _ := params["recursive"].(bool)
 	pattern, _ := params["pattern"].(string)
+	patternType, _ := params["pattern_type"].(string)
 
 	if path == "" {
 		path = "."
 	}
 
+	// glob (the default) matches file names; doublestar and regex match the
+	// path relative to path, and doublestar always walks subdirectories
+	matcher, err := executor.NewPathMatcher(patternType, pattern)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	recursive = recursive || matcher.Recursive()
+
 	var files []map[string]interface{}
 
 	if recursive {
@@ -268,10 +796,9 @@ func handleListFiles(params map[string]interface{}) map[string]interface{} {
 			if err != nil {
 				return nil
 			}
-			if pattern != "" {
-				if matched, _ := filepath.Match(pattern, info.Name()); !matched {
-					return nil
-				}
+			rel, _ := filepath.Rel(path, p)
+			if !matcher.Match(rel, info.Name()) {
+				return nil
 			}
 			files = append(files, fileToMap(p, info))
 			return nil
@@ -285,10 +812,8 @@ func handleListFiles(params map[string]interface{}) map[string]interface{} {
 			}
 		}
 		for _, entry := range entries {
-			if pattern != "" {
-				if matched, _ := filepath.Match(pattern, entry.Name()); !matched {
-					continue
-				}
+			if !matcher.Match(entry.Name(), entry.Name()) {
+				continue
 			}
 			files = append(files, fileToMap(filepath.Join(path, entry.Name()), entry))
 		}
@@ -318,16 +843,7 @@ func handleSystemInfo(params map[string]interface{}) map[string]interface{} {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
-	// Get disk usage for root
-	var diskTotal, diskFree uint64
-	if stat, err := os.Stat("/"); err == nil {
-		if statfs, ok := stat.Sys().(*syscall.Statfs_t); ok {
-			diskTotal = statfs.Blocks * uint64(statfs.Bsize)
-			diskFree = statfs.Bfree * uint64(statfs.Bsize)
-		}
-	}
-
-	return map[string]interface{}{
+	resp := map[string]interface{}{
 		"success":      true,
 		"hostname":     hostname,
 		"os":           runtime.GOOS,
@@ -336,26 +852,76 @@ func handleSystemInfo(params map[string]interface{}) map[string]interface{} {
 		"go_version":   runtime.Version(),
 		"memory_alloc": memStats.Alloc,
 		"memory_sys":   memStats.Sys,
-		"disk_total":   diskTotal,
-		"disk_free":    diskFree,
 	}
+	resp["read_only"] = ReadOnly()
+	resp["active_tasks"] = ActiveTasks()
+	if queues := QueueDepths(); len(queues) > 0 {
+		resp["command_queues"] = queues
+	}
+
+	// Get disk usage for each monitored path; disk_total/disk_free describe the first
+	disks := make(map[string]interface{})
+	for i, path := range executor.DiskPaths() {
+		usage, err := executor.GetDiskUsage(path)
+		if err != nil {
+			disks[path] = map[string]interface{}{"error": err.Error()}
+			continue
+		}
+		if i == 0 {
+			resp["disk_total"] = usage.Total
+			resp["disk_free"] = usage.Total - usage.Used
+		}
+		disks[path] = map[string]interface{}{
+			"total":          usage.Total,
+			"used":           usage.Used,
+			"available":      usage.Available,
+			"percent":        usage.Percent,
+			"inodes_total":   usage.InodesTotal,
+			"inodes_used":    usage.InodesUsed,
+			"inodes_free":    usage.InodesFree,
+			"inodes_percent": usage.InodesPercent,
+		}
+	}
+	resp["disks"] = disks
+
+	if includeEnv, _ := params["include_env"].(bool); includeEnv {
+		resp["env"], resp["env_redacted"] = executor.RedactedEnviron()
+	}
+	return resp
 }
 
+// handleListProcesses returns running processes as {pid, ppid, user, cpu,
+// mem, command} objects, optionally sorted by sort_by (cpu, mem or pid) and
+// cut to the first limit. total counts every process before the limit.
 func handleListProcesses(params map[string]interface{}) map[string]interface{} {
-	// Use ps command for simplicity
-	cmd := exec.Command("ps", "aux")
-	output, err := cmd.CombinedOutput()
+	sortBy, _ := params["sort_by"].(string)
+	limit, _ := params["limit"].(float64)
 
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	procs, err := executor.ListProcesses(ctx)
 	if err != nil {
 		return map[string]interface{}{
 			"success": false,
 			"error":   err.Error(),
 		}
 	}
+	if err := executor.SortProcesses(procs, sortBy); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
 
+	total := len(procs)
+	if limit > 0 && int(limit) < total {
+		procs = procs[:int(limit)]
+	}
 	return map[string]interface{}{
-		"success": true,
-		"output":  string(output),
+		"success":   true,
+		"processes": procs,
+		"count":     len(procs),
+		"total":     total,
 	}
 }
 
@@ -397,6 +963,78 @@ func handleKillProcess(params map[string]interface{}) map[string]interface{} {
 	}
 }
 
+// packagePattern matches package names (with optional version or repo
+// qualifiers) and nothing the shell would interpret.
+var packagePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+:=@/-]*$`)
+
+const defaultInstallTimeout = 10 * time.Minute
+
+func handleInstallPackage(params map[string]interface{}) map[string]interface{} {
+	list, _ := params["packages"].([]interface{})
+	timeoutSec, _ := params["timeout"].(float64)
+
+	var packages []string
+	for _, p := range list {
+		name, ok := p.(string)
+		if !ok || !packagePattern.MatchString(name) {
+			return map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("invalid package name: %v", p),
+			}
+		}
+		packages = append(packages, name)
+	}
+	if len(packages) == 0 {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "no packages provided",
+		}
+	}
+
+	manager, err := executor.DetectPackageManager()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	timeout := defaultInstallTimeout
+	if timeoutSec > 0 {
+		timeout = time.Duration(timeoutSec * float64(time.Second))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	res, err := executor.DefaultExecutor.InstallPackage(ctx, packages)
+	if err != nil {
+		return map[string]interface{}{
+			"success":         false,
+			"error":           err.Error(),
+			"package_manager": manager,
+		}
+	}
+
+	result := map[string]interface{}{
+		"success":         res.Error == nil && res.ExitCode == 0,
+		"package_manager": manager,
+		"packages":        packages,
+		"stdout":          res.Stdout,
+		"stderr":          res.Stderr,
+		"exit_code":       res.ExitCode,
+	}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		result["success"] = false
+		result["error"] = fmt.Sprintf("install timed out after %v", timeout)
+	case res.Error != nil:
+		result["error"] = res.Error.Error()
+	case res.ExitCode != 0:
+		result["error"] = fmt.Sprintf("%s exited with status %d", manager, res.ExitCode)
+	}
+	return result
+}
+
 func handleDocker(params map[string]interface{}) map[string]interface{} {
 	args, _ := params["args"].([]interface{})
 
@@ -452,6 +1090,25 @@ func handleGit(params map[string]interface{}) map[string]interface{} {
 	return result
 }
 
+// serviceTimeout bounds a manage_service action; units can take a while to
+// stop.
+const serviceTimeout = 2 * time.Minute
+
+// restart_and_verify defaults: how long to wait for the service to come up,
+// and how long it must then stay up.
+const (
+	defaultVerifyTimeout = 30 * time.Second
+	defaultVerifySettle  = 2 * time.Second
+)
+
+// handleManageService runs a service action through systemd, launchd or
+// SysV init and reports the outcome the same way on each: state is running,
+// stopped, starting, stopping, failed, not_found or unknown, and message
+// sums it up in one line.
+//
+// restart_and_verify restarts the service and only succeeds once it has
+// stayed running for settle seconds (default 2), waiting up to timeout
+// seconds (default 30) for that.
 func handleManageService(params map[string]interface{}) map[string]interface{} {
 	action, _ := params["action"].(string)
 	serviceName, _ := params["service_name"].(string)
@@ -462,39 +1119,81 @@ func handleManageService(params map[string]interface{}) map[string]interface{} {
 			"error":   "no service_name provided",
 		}
 	}
+	if !validUnitName.MatchString(serviceName) || strings.HasPrefix(serviceName, "-") {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("invalid service name: %s", serviceName),
+		}
+	}
 
 	if action == "" {
 		action = "status"
 	}
 
-	// Try systemctl first, fall back to service
-	var cmd *exec.Cmd
-	if _, err := exec.LookPath("systemctl"); err == nil {
-		cmd = exec.Command("sudo", "systemctl", action, serviceName)
+	var res *executor.ServiceResult
+	var err error
+	if action == "restart_and_verify" {
+		timeout, settle := defaultVerifyTimeout, defaultVerifySettle
+		if v, ok := params["timeout"].(float64); ok && v > 0 {
+			timeout = time.Duration(v * float64(time.Second))
+		}
+		if v, ok := params["settle"].(float64); ok && v >= 0 {
+			settle = time.Duration(v * float64(time.Second))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), serviceTimeout+timeout+settle)
+		defer cancel()
+		res, err = executor.DefaultExecutor.RestartAndVerify(ctx, serviceName, timeout, settle)
 	} else {
-		cmd = exec.Command("sudo", "service", serviceName, action)
+		ctx, cancel := context.WithTimeout(context.Background(), serviceTimeout)
+		defer cancel()
+		res, err = executor.DefaultExecutor.ManageService(ctx, serviceName, action)
+	}
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+			"service": serviceName,
+			"action":  action,
+		}
 	}
-
-	output, err := cmd.CombinedOutput()
 
 	result := map[string]interface{}{
-		"success": err == nil,
-		"output":  string(output),
-		"service": serviceName,
-		"action":  action,
+		"success": res.Success,
+		"service": res.Service,
+		"action":  res.Action,
+		"state":   res.State,
+		"message": res.Message,
+		"backend": res.Backend,
+		"output":  res.Output,
 	}
-
-	if err != nil {
-		result["error"] = err.Error()
+	if res.PID > 0 {
+		result["pid"] = res.PID
+	}
+	if res.Enabled != "" {
+		result["enabled"] = res.Enabled
+	}
+	if res.Action == "restart_and_verify" {
+		result["waited_ms"] = res.Waited.Milliseconds()
+	}
+	if !res.Success {
+		result["error"] = res.Message
 	}
-
 	return result
 }
 
 // Computer use handler (Anthropic Computer Use API)
 
 func handleComputer(params map[string]interface{}) map[string]interface{} {
-	result, err := computer.DefaultManager.ExecuteRaw(params)
+	// Shrinking happens here; the rest goes to the subprocess as is
+	shrink := screenshotOptions(params)
+	forward := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		if k != "max_dimension" && k != "jpeg_quality" {
+			forward[k] = v
+		}
+	}
+
+	result, err := computer.DefaultManager.ExecuteRaw(forward)
 	if err != nil {
 		return map[string]interface{}{"success": false, "error": err.Error()}
 	}
@@ -507,7 +1206,11 @@ func handleComputer(params map[string]interface{}) map[string]interface{} {
 		resp["error"] = result.Error
 	}
 	if result.Base64Image != "" {
-		resp["base64_image"] = result.Base64Image
+		if shrink.Enabled() {
+			shrinkScreenshot(result.Base64Image, shrink, resp)
+		} else {
+			resp["base64_image"] = result.Base64Image
+		}
 	}
 	if result.DisplayWidth > 0 {
 		resp["display_width"] = result.DisplayWidth
@@ -521,6 +1224,12 @@ func handleComputer(params map[string]interface{}) map[string]interface{} {
 	if result.ScreenHeight > 0 {
 		resp["screen_height"] = result.ScreenHeight
 	}
+	if result.Diff != nil {
+		resp["diff"] = result.Diff
+	}
+	if result.Cached {
+		resp["cached"] = true
+	}
 	return resp
 }
 
@@ -646,11 +1355,16 @@ func handleBrowserScreenshot(params map[string]interface{}) map[string]interface
 	if err != nil {
 		return map[string]interface{}{"success": false, "error": err.Error()}
 	}
-	return map[string]interface{}{
+	resp := map[string]interface{}{
 		"success": result.Success,
 		"path":    result.Path,
 		"error":   result.Error,
 	}
+	// With shrinking on, the (shrunk) image comes back too, saving a read_file
+	if shrink := screenshotOptions(params); result.Success && shrink.Enabled() {
+		shrinkScreenshotFile(result.Path, shrink, resp)
+	}
+	return resp
 }
 
 func handleBrowserEvaluate(params map[string]interface{}) map[string]interface{} {
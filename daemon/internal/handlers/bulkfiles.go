@@ -0,0 +1,295 @@
+// Bulk file handlers - write or delete many files in one request.
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileOpResults summarises per-file results into a handler result.
+func fileOpResults(results []map[string]interface{}, atomic, rolledBack bool) map[string]interface{} {
+	failed := 0
+	for _, r := range results {
+		ok, _ := r["success"].(bool)
+		skipped, _ := r["rolled_back"].(bool)
+		if !ok && !skipped {
+			failed++
+		}
+	}
+	result := map[string]interface{}{
+		"success": failed == 0 && !rolledBack,
+		"results": results,
+		"count":   len(results),
+		"failed":  failed,
+		"atomic":  atomic,
+	}
+	if failed > 0 {
+		result["error"] = fmt.Sprintf("%d of %d files failed", failed, len(results))
+		if rolledBack {
+			result["error"] = result["error"].(string) + "; all changes rolled back"
+			result["rolled_back"] = true
+		}
+	}
+	return result
+}
+
+// stagedWrite is one file of an atomic write_files, verified on disk but not
+// yet in place.
+type stagedWrite struct {
+	path     string // as requested
+	target   string // symlinks resolved
+	tmpPath  string
+	backup   string // original moved aside while committing, if there was one
+	size     int
+	checksum string
+}
+
+// handleWriteFiles writes each of files ([{path, content, mode, encoding}])
+// as write_file would. With atomic, every file is staged and verified first
+// and then renamed into place; if anything fails, files already replaced
+// are restored and nothing is left changed.
+func handleWriteFiles(params map[string]interface{}) map[string]interface{} {
+	files, _ := params["files"].([]interface{})
+	atomic, _ := params["atomic"].(bool)
+
+	if len(files) == 0 {
+		return map[string]interface{}{"success": false, "error": "no files provided"}
+	}
+
+	entries := make([]map[string]interface{}, len(files))
+	for i, f := range files {
+		entry, ok := f.(map[string]interface{})
+		if !ok {
+			return map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("files[%d] is not an object", i),
+			}
+		}
+		entries[i] = entry
+	}
+
+	if !atomic {
+		results := make([]map[string]interface{}, 0, len(entries))
+		for _, entry := range entries {
+			r := handleWriteFile(entry)
+			r["path"], _ = entry["path"].(string)
+			results = append(results, r)
+		}
+		return fileOpResults(results, false, false)
+	}
+
+	// Stage everything; nothing on disk changes until all files verify
+	staged := make([]*stagedWrite, 0, len(entries))
+	results := make([]map[string]interface{}, len(entries))
+	failed := false
+	for i, entry := range entries {
+		path, _ := entry["path"].(string)
+		content, _ := entry["content"].(string)
+		encoding, _ := entry["encoding"].(string)
+		mode, _ := entry["mode"].(float64)
+
+		results[i] = map[string]interface{}{"success": false, "path": path}
+		if path == "" {
+			results[i]["error"] = "no path provided"
+			failed = true
+			continue
+		}
+		data, err := decodeContent(content, encoding)
+		if err != nil {
+			results[i]["error"] = err.Error()
+			failed = true
+			continue
+		}
+		checksum := sha256Hex(data)
+		tmpPath, target, err := stageFileVerified(path, data, fileModeFor(path, mode), checksum)
+		if err != nil {
+			results[i]["error"] = err.Error()
+			failed = true
+			continue
+		}
+		staged = append(staged, &stagedWrite{
+			path: path, target: target, tmpPath: tmpPath, size: len(data), checksum: checksum,
+		})
+	}
+	if failed {
+		for _, s := range staged {
+			os.Remove(s.tmpPath)
+		}
+		return fileOpResults(markSkipped(results), true, true)
+	}
+
+	// Commit: move each original aside, then rename the new file into place
+	for i, s := range staged {
+		if err := commitStagedWrite(s); err != nil {
+			results[i]["error"] = err.Error()
+			rollbackStagedWrites(staged[:i])
+			for _, rest := range staged[i:] {
+				os.Remove(rest.tmpPath)
+			}
+			return fileOpResults(markSkipped(results), true, true)
+		}
+	}
+
+	for i, s := range staged {
+		if s.backup != "" {
+			os.Remove(s.backup)
+		}
+		results[i] = map[string]interface{}{
+			"success":  true,
+			"path":     s.path,
+			"size":     s.size,
+			"checksum": s.checksum,
+		}
+	}
+	return fileOpResults(results, true, false)
+}
+
+func commitStagedWrite(s *stagedWrite) error {
+	if _, err := os.Lstat(s.target); err == nil {
+		s.backup = s.tmpPath + ".orig"
+		if err := os.Rename(s.target, s.backup); err != nil {
+			s.backup = ""
+			return err
+		}
+	}
+	if err := os.Rename(s.tmpPath, s.target); err != nil {
+		if s.backup != "" {
+			os.Rename(s.backup, s.target)
+			s.backup = ""
+		}
+		return err
+	}
+	return nil
+}
+
+// rollbackStagedWrites puts back what commitStagedWrite replaced, newest first.
+func rollbackStagedWrites(committed []*stagedWrite) {
+	for i := len(committed) - 1; i >= 0; i-- {
+		s := committed[i]
+		if s.backup != "" {
+			os.Rename(s.backup, s.target)
+		} else {
+			os.Remove(s.target)
+		}
+	}
+}
+
+// markSkipped fills in the results of files that didn't fail themselves but
+// were rolled back because another one did.
+func markSkipped(results []map[string]interface{}) []map[string]interface{} {
+	for _, r := range results {
+		if _, hasErr := r["error"]; !hasErr {
+			r["success"] = false
+			r["rolled_back"] = true
+			r["error"] = "rolled back: another file failed"
+		}
+	}
+	return results
+}
+
+// handleDeleteFiles deletes each of paths as delete_file would, trash
+// included. It takes no confirm tokens, so a path large enough to need one is
+// refused; delete it with delete_file instead. With atomic, every path is first renamed aside; if any can't be,
+// the others are put back and nothing is deleted.
+func handleDeleteFiles(params map[string]interface{}) map[string]interface{} {
+	rawPaths, _ := params["paths"].([]interface{})
+	recursive, _ := params["recursive"].(bool)
+	atomic, _ := params["atomic"].(bool)
+	trash := useTrash(params, recursive)
+
+	paths := make([]string, 0, len(rawPaths))
+	for _, p := range rawPaths {
+		if s, ok := p.(string); ok {
+			paths = append(paths, s)
+		}
+	}
+	if len(paths) == 0 {
+		return map[string]interface{}{"success": false, "error": "no paths provided"}
+	}
+
+	if !atomic {
+		results := make([]map[string]interface{}, 0, len(paths))
+		for _, path := range paths {
+			r := handleDeleteFile(map[string]interface{}{
+				"path":      path,
+				"recursive": recursive,
+				"trash":     trash,
+			})
+			r["path"] = path
+			results = append(results, r)
+		}
+		return fileOpResults(results, false, false)
+	}
+
+	results := make([]map[string]interface{}, len(paths))
+	for i, path := range paths {
+		results[i] = map[string]interface{}{"success": false, "path": path}
+	}
+	moved := make([]string, 0, len(paths)) // aside-names, parallel to paths
+	for i, path := range paths {
+		err := checkDeletable(path, recursive)
+		if err == nil {
+			_, err = checkDeleteConfirmation(path, recursive, nil)
+		}
+		var aside string
+		if err == nil {
+			aside = filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.deleting-%d", filepath.Base(path), os.Getpid()))
+			err = os.Rename(path, aside)
+		}
+		if err != nil {
+			results[i]["error"] = err.Error()
+			for j := len(moved) - 1; j >= 0; j-- {
+				os.Rename(moved[j], paths[j])
+			}
+			return fileOpResults(markSkipped(results), true, true)
+		}
+		moved = append(moved, aside)
+	}
+
+	for i, aside := range moved {
+		if trash {
+			original, _ := filepath.Abs(paths[i])
+			entry, err := moveToTrash(original, aside)
+			if err != nil {
+				results[i]["error"] = fmt.Sprintf("moved aside to %s but not trashed: %v", aside, err)
+				continue
+			}
+			results[i]["success"] = true
+			results[i]["trashed"] = true
+			results[i]["trash_id"] = entry.ID
+			continue
+		}
+		if err := os.RemoveAll(aside); err != nil {
+			// Already out of the way; report it but there's nothing left to roll back to
+			results[i]["error"] = fmt.Sprintf("moved aside to %s but not removed: %v", aside, err)
+			continue
+		}
+		results[i]["success"] = true
+	}
+	return fileOpResults(results, true, false)
+}
+
+// checkDeletable reports why delete_file would refuse path, without deleting it.
+func checkDeletable(path string, recursive bool) error {
+	if path == "" {
+		return fmt.Errorf("no path provided")
+	}
+	if err := checkProtected(path); err != nil {
+		return err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && !recursive {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("remove %s: directory not empty", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Capabilities - command types only run when the daemon was configured with
+// the capability they belong to (DAEMON_CAPABILITIES).
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// capabilities enabled on this daemon (DAEMON_CAPABILITIES)
+var capabilities = map[string]bool{}
+
+// requiredCapability maps command types to the capability they need. Types
+// not listed (ping, system_info, logs, ...) always run.
+var requiredCapability = map[string]string{}
+
+// SetCapabilities records which capabilities are enabled. Command types
+// declared with RequireCapability refuse to run unless theirs is listed.
+func SetCapabilities(caps []string) {
+	enabled := make(map[string]bool, len(caps))
+	for _, c := range caps {
+		enabled[strings.TrimSpace(c)] = true
+	}
+	capabilities = enabled
+}
+
+// RequireCapability declares that cmdTypes only run when capability is enabled.
+func RequireCapability(capability string, cmdTypes ...string) {
+	for _, t := range cmdTypes {
+		requiredCapability[t] = capability
+	}
+}
+
+// HasCapability reports whether capability is enabled on this daemon.
+func HasCapability(capability string) bool {
+	return capabilities[capability]
+}
+
+// CheckCapability returns an error result if cmdType needs a capability this
+// daemon wasn't configured with, or nil if it may run.
+func CheckCapability(cmdType string) map[string]interface{} {
+	capability, ok := requiredCapability[cmdType]
+	if !ok {
+		return nil
+	}
+	if resp := requireCapability(capability); resp != nil {
+		resp["error"] = fmt.Sprintf("capability not enabled: %s needs %q (add it to DAEMON_CAPABILITIES)", cmdType, capability)
+		return resp
+	}
+	return nil
+}
+
+func requireCapability(name string) map[string]interface{} {
+	if !capabilities[name] {
+		return map[string]interface{}{
+			"success":    false,
+			"error":      fmt.Sprintf("capability %q is not enabled on this daemon (add it to DAEMON_CAPABILITIES)", name),
+			"capability": name,
+		}
+	}
+	return nil
+}
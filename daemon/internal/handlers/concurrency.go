@@ -0,0 +1,100 @@
+// Concurrency limits - serialize command types that can't safely overlap.
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// typeLimiter caps how many commands of one type run at once; the rest queue.
+type typeLimiter struct {
+	slots   chan struct{}
+	queued  atomic.Int64
+	running atomic.Int64
+}
+
+// QueueStatus reports a limited command type's load.
+type QueueStatus struct {
+	Type    string `json:"type"`
+	Limit   int    `json:"limit"`
+	Running int64  `json:"running"`
+	Queued  int64  `json:"queued"`
+}
+
+// SetConcurrency limits cmdType to n concurrent commands; further commands
+// wait for a slot instead of running alongside (e.g. one install_package at a
+// time because of the dpkg lock). n <= 0 removes the limit. Commands already
+// running or queued keep the limiter they started with.
+func (r *Registry) SetConcurrency(cmdType string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n <= 0 {
+		delete(r.limits, cmdType)
+		return
+	}
+	r.limits[cmdType] = &typeLimiter{slots: make(chan struct{}, n)}
+}
+
+// QueueDepths reports every limited command type, sorted by name.
+func (r *Registry) QueueDepths() []QueueStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]QueueStatus, 0, len(r.limits))
+	for t, l := range r.limits {
+		statuses = append(statuses, QueueStatus{
+			Type:    t,
+			Limit:   cap(l.slots),
+			Running: l.running.Load(),
+			Queued:  l.queued.Load(),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Type < statuses[j].Type })
+	return statuses
+}
+
+// acquire waits up to maxWait (0 = forever) for a slot and returns how long
+// it waited. The caller must call release once the handler has returned.
+func (l *typeLimiter) acquire(cmdType string, maxWait time.Duration) (time.Duration, error) {
+	start := time.Now()
+	select {
+	case l.slots <- struct{}{}:
+		l.running.Add(1)
+		return 0, nil
+	default:
+	}
+
+	l.queued.Add(1)
+	defer l.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		l.running.Add(1)
+		return time.Since(start), nil
+	case <-timeout:
+		return time.Since(start), fmt.Errorf("%s: no free slot after %v (limit %d)", cmdType, maxWait, cap(l.slots))
+	}
+}
+
+func (l *typeLimiter) release() {
+	l.running.Add(-1)
+	<-l.slots
+}
+
+// QueueDepths is a convenience function for the default registry.
+func QueueDepths() []QueueStatus {
+	return DefaultRegistry.QueueDepths()
+}
+
+// SetConcurrency is a convenience function for the default registry.
+func SetConcurrency(cmdType string, n int) {
+	DefaultRegistry.SetConcurrency(cmdType, n)
+}
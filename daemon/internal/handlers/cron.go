@@ -0,0 +1,141 @@
+// Cron handler - list, add and remove crontab entries.
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ultron/daemon/internal/executor"
+)
+
+// CronEntry is one job line from a crontab.
+type CronEntry struct {
+	Line     int    `json:"line"`     // 1-based line number in the crontab
+	Schedule string `json:"schedule"` // e.g. "*/5 * * * *" or "@reboot"
+	Command  string `json:"command"`
+}
+
+// parseCrontab splits a crontab into job entries and environment assignments,
+// skipping comments and blank lines.
+func parseCrontab(text string) ([]CronEntry, map[string]string) {
+	entries := []CronEntry{}
+	env := make(map[string]string)
+	for i, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if strings.HasPrefix(line, "@") {
+			if len(fields) < 2 {
+				continue
+			}
+			entries = append(entries, CronEntry{
+				Line:     i + 1,
+				Schedule: fields[0],
+				Command:  strings.TrimSpace(strings.TrimPrefix(line, fields[0])),
+			})
+			continue
+		}
+
+		// NAME=value lines set variables for the jobs below them
+		if eq := strings.Index(line, "="); eq > 0 && !strings.ContainsAny(line[:eq], " \t") {
+			env[line[:eq]] = strings.Trim(strings.TrimSpace(line[eq+1:]), `"'`)
+			continue
+		}
+
+		if len(fields) < 6 {
+			continue
+		}
+		schedule := strings.Join(fields[:5], " ")
+		rest := line
+		for _, f := range fields[:5] {
+			rest = strings.TrimSpace(strings.TrimPrefix(rest, f))
+		}
+		entries = append(entries, CronEntry{Line: i + 1, Schedule: schedule, Command: rest})
+	}
+	return entries, env
+}
+
+// listCrontab reads the current user's crontab. No crontab is an empty one.
+func listCrontab(ctx context.Context) ([]CronEntry, map[string]string, error) {
+	res, err := executor.DefaultExecutor.CronOperation(ctx, "list")
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.ExitCode != 0 {
+		if strings.Contains(res.Stderr, "no crontab") {
+			entries, env := parseCrontab("")
+			return entries, env, nil
+		}
+		return nil, nil, fmt.Errorf("crontab -l failed: %s", strings.TrimSpace(res.Stderr))
+	}
+	entries, env := parseCrontab(res.Stdout)
+	return entries, env, nil
+}
+
+// handleCron manages the daemon user's crontab. operation is list, add
+// (args[0] is the full cron line) or remove (args[0] is a pattern; matching
+// lines are deleted). Every operation returns the resulting entries.
+func handleCron(params map[string]interface{}) map[string]interface{} {
+	operation, _ := params["operation"].(string)
+	rawArgs, _ := params["args"].([]interface{})
+
+	var args []string
+	for _, a := range rawArgs {
+		if s, ok := a.(string); ok {
+			args = append(args, s)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch operation {
+	case "list":
+	case "add", "remove":
+		if len(args) == 0 || strings.TrimSpace(args[0]) == "" {
+			return map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("cron %s requires args[0]", operation),
+			}
+		}
+		if strings.ContainsAny(args[0], "\n\r") {
+			return map[string]interface{}{
+				"success": false,
+				"error":   "cron entry must be a single line",
+			}
+		}
+		res, err := executor.DefaultExecutor.CronOperation(ctx, operation, args...)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		if res.ExitCode != 0 {
+			return map[string]interface{}{
+				"success":   false,
+				"error":     fmt.Sprintf("crontab %s failed: %s", operation, strings.TrimSpace(res.Stderr)),
+				"exit_code": res.ExitCode,
+			}
+		}
+	default:
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("unknown cron operation: %q (want list, add or remove)", operation),
+		}
+	}
+
+	entries, env, err := listCrontab(ctx)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return map[string]interface{}{
+		"success":   true,
+		"operation": operation,
+		"entries":   entries,
+		"env":       env,
+		"count":     len(entries),
+	}
+}
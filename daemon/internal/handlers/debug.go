@@ -0,0 +1,44 @@
+// Debug handlers - introspection for operators, off unless DAEMON_DEBUG is set.
+package handlers
+
+import "sort"
+
+// RegisterDebug adds handlers that expose the daemon's command surface.
+// They are not part of RegisterBuiltins so production daemons don't advertise them.
+func RegisterDebug() {
+	Register("list_handlers", handleListHandlers)
+	MarkReadOnly("list_handlers")
+}
+
+func handleListHandlers(params map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"success":  true,
+		"handlers": DefaultRegistry.Describe(),
+	}
+}
+
+// HandlerInfo describes a registered command type.
+type HandlerInfo struct {
+	Type       string `json:"type"`
+	Streaming  bool   `json:"streaming"`
+	Idempotent bool   `json:"idempotent"`
+	ReadOnly   bool   `json:"read_only"` // Runs in read-only mode
+}
+
+// Describe lists every registered command type, sorted by name.
+func (r *Registry) Describe() []HandlerInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]HandlerInfo, 0, len(r.handlers))
+	for t := range r.handlers {
+		infos = append(infos, HandlerInfo{
+			Type:       t,
+			Streaming:  r.streaming[t],
+			Idempotent: r.idempotent[t],
+			ReadOnly:   r.idempotent[t] || r.readSafe[t],
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Type < infos[j].Type })
+	return infos
+}
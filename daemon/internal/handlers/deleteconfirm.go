@@ -0,0 +1,157 @@
+// Delete confirmation - large recursive deletes need a token from a dry run.
+//
+// delete_file with dry_run counts what a delete would remove and returns a
+// confirm_token bound to that path and count. A recursive delete of at least
+// the threshold number of items is refused unless it passes the token back
+// with confirm_count equal to the count, and the tree still holds that many
+// items, so a mistaken path can't wipe thousands of files in one step.
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// deleteTokenTTL is how long a dry run's confirm_token stays valid.
+const deleteTokenTTL = 5 * time.Minute
+
+var (
+	deleteConfirmThreshold = 100
+	deleteTokens           = make(map[string]deleteToken)
+	deleteTokensMu         sync.Mutex
+)
+
+type deleteToken struct {
+	path    string
+	count   int
+	expires time.Time
+}
+
+// SetDeleteConfirmThreshold sets how many items a recursive delete may remove
+// without confirmation (0 disables confirmation).
+func SetDeleteConfirmThreshold(n int) {
+	deleteConfirmThreshold = n
+}
+
+// countTree returns the number of entries (path itself included) and bytes a
+// recursive delete of path would remove. Symlinks are counted, not followed.
+func countTree(path string) (int, int64, error) {
+	var count int
+	var bytes int64
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		count++
+		if info.Mode().IsRegular() {
+			bytes += info.Size()
+		}
+		return nil
+	})
+	return count, bytes, err
+}
+
+// issueDeleteToken records a token confirming a delete of count items at path.
+func issueDeleteToken(path string, count int) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	deleteTokensMu.Lock()
+	defer deleteTokensMu.Unlock()
+	now := time.Now()
+	for t, pending := range deleteTokens {
+		if now.After(pending.expires) {
+			delete(deleteTokens, t)
+		}
+	}
+	deleteTokens[token] = deleteToken{path: path, count: count, expires: now.Add(deleteTokenTTL)}
+	return token, nil
+}
+
+// checkDeleteConfirmation returns the item count and an error if deleting
+// path needs a confirmation that params don't carry. A valid token is used up.
+func checkDeleteConfirmation(path string, recursive bool, params map[string]interface{}) (int, error) {
+	if !recursive || deleteConfirmThreshold <= 0 {
+		return 0, nil
+	}
+	abs, err := absPath(path)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Lstat(abs)
+	if err != nil || !info.IsDir() {
+		return 0, nil // Nothing to count; the delete itself reports any error
+	}
+	count, _, err := countTree(abs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", path, err)
+	}
+	if count < deleteConfirmThreshold {
+		return count, nil
+	}
+
+	token, _ := params["confirm_token"].(string)
+	confirmCount, _ := params["confirm_count"].(float64)
+	if token == "" {
+		return count, fmt.Errorf("deleting %s would remove %d items; run delete_file with dry_run first and pass back confirm_token and confirm_count", path, count)
+	}
+
+	deleteTokensMu.Lock()
+	pending, ok := deleteTokens[token]
+	delete(deleteTokens, token)
+	deleteTokensMu.Unlock()
+
+	switch {
+	case !ok || time.Now().After(pending.expires):
+		return count, fmt.Errorf("confirm_token is unknown or expired; run the dry run again")
+	case pending.path != abs:
+		return count, fmt.Errorf("confirm_token was issued for %s, not %s", pending.path, abs)
+	case int(confirmCount) != pending.count:
+		return count, fmt.Errorf("confirm_count %d doesn't match the %d items the dry run found", int(confirmCount), pending.count)
+	case count != pending.count:
+		return count, fmt.Errorf("%s now holds %d items, not the %d confirmed; run the dry run again", path, count, pending.count)
+	}
+	return count, nil
+}
+
+// deleteDryRun reports what deleting path would remove, with a token for
+// confirming it.
+func deleteDryRun(path string, recursive bool) map[string]interface{} {
+	if err := checkDeletable(path, recursive); err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	abs, err := absPath(path)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	count, bytes := 1, int64(0)
+	if recursive {
+		if count, bytes, err = countTree(abs); err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+	} else if info, err := os.Lstat(abs); err == nil && info.Mode().IsRegular() {
+		bytes = info.Size()
+	}
+	token, err := issueDeleteToken(abs, count)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return map[string]interface{}{
+		"success":               true,
+		"dry_run":               true,
+		"path":                  path,
+		"count":                 count,
+		"bytes":                 bytes,
+		"confirm_token":         token,
+		"expires_in":            int(deleteTokenTTL.Seconds()),
+		"confirmation_required": recursive && deleteConfirmThreshold > 0 && count >= deleteConfirmThreshold,
+	}
+}
@@ -0,0 +1,416 @@
+// Docker handlers - structured helpers on top of the docker CLI.
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ultron/daemon/internal/crash"
+)
+
+// containerPattern matches docker container names and IDs.
+var containerPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+const defaultDockerCpTimeout = 5 * time.Minute
+
+// handleDockerCp copies files or directories between the host and a container.
+// Directories are copied recursively; file modes are kept, and archive=true
+// also keeps uid/gid.
+func handleDockerCp(params map[string]interface{}) map[string]interface{} {
+	container, _ := params["container"].(string)
+	containerPath, _ := params["container_path"].(string)
+	hostPath, _ := params["host_path"].(string)
+	direction, _ := params["direction"].(string)
+	archive, _ := params["archive"].(bool)
+	followLink, _ := params["follow_link"].(bool)
+	timeout, _ := params["timeout"].(float64)
+
+	if !containerPattern.MatchString(container) {
+		return map[string]interface{}{"success": false, "error": "invalid or missing container"}
+	}
+	if containerPath == "" || hostPath == "" {
+		return map[string]interface{}{"success": false, "error": "container_path and host_path required"}
+	}
+	absHost, err := filepath.Abs(hostPath)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": "invalid host_path: " + err.Error()}
+	}
+
+	var src, dst string
+	switch direction {
+	case "to_container":
+		if _, err := os.Stat(absHost); err != nil {
+			return map[string]interface{}{"success": false, "error": "host_path does not exist: " + absHost}
+		}
+		src, dst = absHost, container+":"+containerPath
+	case "from_container":
+		src, dst = container+":"+containerPath, absHost
+	default:
+		return map[string]interface{}{"success": false, "error": "direction must be to_container or from_container"}
+	}
+
+	args := []string{"cp"}
+	if archive {
+		args = append(args, "--archive")
+	}
+	if followLink {
+		args = append(args, "--follow-link")
+	}
+	args = append(args, src, dst)
+
+	if timeout <= 0 {
+		timeout = defaultDockerCpTimeout.Seconds()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout*float64(time.Second)))
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		if ctx.Err() != nil {
+			msg = fmt.Sprintf("docker cp timed out after %v", time.Duration(timeout*float64(time.Second)))
+		} else if msg == "" {
+			msg = err.Error()
+		}
+		return map[string]interface{}{"success": false, "error": msg}
+	}
+
+	result := map[string]interface{}{
+		"success":   true,
+		"direction": direction,
+		"source":    src,
+		"dest":      dst,
+	}
+	if direction == "from_container" {
+		// Where docker put it: into absHost if that was an existing directory, else at absHost
+		copied := absHost
+		if info, err := os.Stat(filepath.Join(absHost, filepath.Base(containerPath))); err == nil {
+			copied = filepath.Join(absHost, info.Name())
+		}
+		if info, err := os.Stat(copied); err == nil {
+			result["host_path"] = copied
+			result["is_dir"] = info.IsDir()
+			result["mode"] = info.Mode().String()
+			if !info.IsDir() {
+				result["size"] = info.Size()
+			}
+		}
+	}
+	return result
+}
+
+// dockerAPIVersion is old enough for every engine we care about.
+const dockerAPIVersion = "v1.41"
+
+// dockerAPIClient talks to the Docker Engine API on DOCKER_HOST (unix or tcp),
+// defaulting to /var/run/docker.sock.
+func dockerAPIClient() (*http.Client, string) {
+	host := os.Getenv("DOCKER_HOST")
+	if strings.HasPrefix(host, "tcp://") {
+		return &http.Client{}, "http://" + strings.TrimPrefix(host, "tcp://") + "/" + dockerAPIVersion
+	}
+	socket := strings.TrimPrefix(host, "unix://")
+	if socket == "" {
+		socket = "/var/run/docker.sock"
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &http.Client{Transport: transport}, "http://docker/" + dockerAPIVersion
+}
+
+// dockerGet issues a GET against the Docker API. The caller closes the body.
+func dockerGet(ctx context.Context, path string) (*http.Response, error) {
+	client, base := dockerAPIClient()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker API unavailable: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		return nil, fmt.Errorf("docker API: %s", apiErr.Message)
+	}
+	return resp, nil
+}
+
+// dockerStats is the subset of the /containers/{id}/stats payload we report.
+type dockerStats struct {
+	Read     time.Time `json:"read"`
+	Name     string    `json:"name"`
+	ID       string    `json:"id"`
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage  uint64   `json:"total_usage"`
+			PercpuUsage []uint64 `json:"percpu_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+		OnlineCPUs  uint32 `json:"online_cpus"`
+	} `json:"cpu_stats"`
+	PreCPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+	} `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+// ContainerSample is one resource usage reading for a container.
+type ContainerSample struct {
+	Container  string    `json:"container"`
+	Name       string    `json:"name"`
+	Timestamp  time.Time `json:"timestamp"`
+	CPUPercent float64   `json:"cpu_percent"`
+	MemUsage   uint64    `json:"mem_usage"`
+	MemLimit   uint64    `json:"mem_limit"`
+	MemPercent float64   `json:"mem_percent"`
+	NetRx      uint64    `json:"net_rx"`
+	NetTx      uint64    `json:"net_tx"`
+	BlockRead  uint64    `json:"block_read"`
+	BlockWrite uint64    `json:"block_write"`
+	PIDs       uint64    `json:"pids"`
+}
+
+// sample converts raw stats the same way `docker stats` does.
+func (s *dockerStats) sample() ContainerSample {
+	out := ContainerSample{
+		Container: s.ID,
+		Name:      strings.TrimPrefix(s.Name, "/"),
+		Timestamp: s.Read,
+		MemLimit:  s.MemoryStats.Limit,
+		PIDs:      s.PidsStats.Current,
+	}
+	if len(out.Container) > 12 {
+		out.Container = out.Container[:12]
+	}
+
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	sysDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	cpus := float64(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && sysDelta > 0 {
+		out.CPUPercent = cpuDelta / sysDelta * cpus * 100
+	}
+
+	// Page cache isn't pressure; cgroup v2 reports it as inactive_file, v1 as cache
+	out.MemUsage = s.MemoryStats.Usage
+	cache := s.MemoryStats.Stats["inactive_file"]
+	if cache == 0 {
+		cache = s.MemoryStats.Stats["cache"]
+	}
+	if cache < out.MemUsage {
+		out.MemUsage -= cache
+	}
+	if out.MemLimit > 0 {
+		out.MemPercent = float64(out.MemUsage) / float64(out.MemLimit) * 100
+	}
+
+	for _, n := range s.Networks {
+		out.NetRx += n.RxBytes
+		out.NetTx += n.TxBytes
+	}
+	for _, io := range s.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(io.Op) {
+		case "read":
+			out.BlockRead += io.Value
+		case "write":
+			out.BlockWrite += io.Value
+		}
+	}
+	return out
+}
+
+// runningContainers returns the IDs of all running containers.
+func runningContainers(ctx context.Context) ([]string, error) {
+	resp, err := dockerGet(ctx, "/containers/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var list []struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(list))
+	for _, c := range list {
+		ids = append(ids, c.ID)
+	}
+	return ids, nil
+}
+
+// handleDockerStatsStream streams per-container CPU, memory, network and block
+// IO samples every interval until duration elapses or Prime stops listening.
+func handleDockerStatsStream(params map[string]interface{}, stream StreamFunc) map[string]interface{} {
+	interval, _ := params["interval"].(float64)
+	duration, _ := params["duration"].(float64)
+	if interval <= 0 {
+		interval = 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(duration*float64(time.Second)))
+		defer cancel()
+	}
+
+	var containers []string
+	if list, ok := params["containers"].([]interface{}); ok {
+		for _, c := range list {
+			if s, ok := c.(string); ok && containerPattern.MatchString(s) {
+				containers = append(containers, s)
+			}
+		}
+	}
+	if len(containers) == 0 {
+		ids, err := runningContainers(ctx)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		if len(ids) == 0 {
+			return map[string]interface{}{"success": false, "error": "no running containers"}
+		}
+		containers = ids
+	}
+
+	// One stats stream per container; the ticker below reports the latest reading of each
+	var (
+		mu      sync.Mutex
+		latest  = make(map[string]ContainerSample)
+		errs    = make(map[string]string)
+		streams sync.WaitGroup
+	)
+	for _, c := range containers {
+		streams.Add(1)
+		go func(container string) {
+			defer streams.Done()
+			defer crash.Recover("docker stats " + container)
+			resp, err := dockerGet(ctx, "/containers/"+container+"/stats?stream=true")
+			if err != nil {
+				mu.Lock()
+				errs[container] = err.Error()
+				mu.Unlock()
+				return
+			}
+			defer resp.Body.Close()
+			dec := json.NewDecoder(resp.Body)
+			for {
+				var s dockerStats
+				if err := dec.Decode(&s); err != nil {
+					return // Container stopped or we were cancelled
+				}
+				mu.Lock()
+				latest[container] = s.sample()
+				mu.Unlock()
+			}
+		}(c)
+	}
+
+	allDone := make(chan struct{})
+	go func() {
+		streams.Wait()
+		close(allDone)
+	}()
+
+	batcher := newStreamBatcher(stream, "samples")
+	ticker := time.NewTicker(time.Duration(interval * float64(time.Second)))
+	defer ticker.Stop()
+	count := 0
+	var streamErr error
+
+loop:
+	for finished := false; !finished; {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-allDone:
+			finished = true // Every container stopped or failed; report their last readings
+		case <-ticker.C:
+		}
+		mu.Lock()
+		samples := make([]ContainerSample, 0, len(latest))
+		for _, s := range latest {
+			samples = append(samples, s)
+		}
+		latest = make(map[string]ContainerSample)
+		mu.Unlock()
+
+		for _, s := range samples {
+			if streamErr = batcher.Add(s, 256); streamErr != nil {
+				break loop
+			}
+			count++
+		}
+	}
+	if err := batcher.Flush(); streamErr == nil {
+		streamErr = err
+	}
+	cancel()
+	<-allDone
+
+	result := map[string]interface{}{
+		"success":    true,
+		"count":      count,
+		"containers": len(containers),
+		"followed":   true,
+	}
+	if len(errs) > 0 {
+		result["container_errors"] = errs
+		if len(errs) == len(containers) {
+			result["success"] = false
+			result["error"] = "no container stats available"
+		}
+	}
+	if streamErr != nil && duration > 0 {
+		// Without a duration the stream only ends when Prime goes away, which is the normal exit
+		result["success"] = false
+		result["error"] = streamErr.Error()
+	}
+	return result
+}
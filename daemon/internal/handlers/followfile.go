@@ -0,0 +1,162 @@
+// Binary follow - streams a file's bytes as it grows (a recording in
+// progress, a growing pcap), like tail -f but byte-oriented.
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ultron/daemon/internal/executor"
+)
+
+// follow_file defaults
+const (
+	followChunkSize    = 64 * 1024 // Raw bytes per chunk
+	followPollInterval = 250 * time.Millisecond
+	followIdleTimeout  = 30 * time.Second // Stop once the file stops growing this long
+)
+
+// handleFollowFile streams the bytes of path from offset (or from its current
+// end with from_end) as base64 chunks, then keeps polling for appended bytes.
+// Whatever a writer has flushed is sent, so a chunk may end mid-record; the
+// receiver reassembles by offset. It stops when the file hasn't grown for
+// idle_timeout seconds, after duration seconds, on cancel_command, or when
+// Prime stops accepting partial results. A file truncated below what was
+// already sent is followed again from the start, flagged with truncated.
+func handleFollowFile(params map[string]interface{}, stream StreamFunc) map[string]interface{} {
+	path, _ := params["path"].(string)
+	commandID, _ := params["command_id"].(string)
+	offset, _ := params["offset"].(float64)
+	fromEnd, _ := params["from_end"].(bool)
+	chunkSize, _ := params["chunk_size"].(float64)
+	duration, _ := params["duration"].(float64)
+	idleTimeout, _ := params["idle_timeout"].(float64)
+
+	if path == "" {
+		return map[string]interface{}{"success": false, "error": "no path provided"}
+	}
+	if chunkSize <= 0 {
+		chunkSize = followChunkSize
+	}
+	idle := followIdleTimeout
+	if idleTimeout > 0 {
+		idle = time.Duration(idleTimeout * float64(time.Second))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	if info.IsDir() {
+		return map[string]interface{}{"success": false, "error": path + " is a directory"}
+	}
+
+	pos := int64(offset)
+	if fromEnd {
+		pos = info.Size()
+	}
+	if _, err := f.Seek(pos, io.SeekStart); err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	ctx := context.Background()
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(duration*float64(time.Second)))
+		defer cancel()
+	}
+	// Track so Prime can stop following with cancel_command
+	ctx, release := executor.DefaultExecutor.Track(ctx, commandID)
+	defer release()
+
+	start := pos
+	var sent int64
+	hash := sha256.New()
+	truncated := false
+	lastGrowth := time.Now()
+	buf := make([]byte, int(chunkSize))
+
+	finish := func(stopped string, err error) map[string]interface{} {
+		result := map[string]interface{}{
+			"success":  err == nil,
+			"path":     path,
+			"start":    start,
+			"offset":   pos,
+			"bytes":    sent,
+			"stopped":  stopped,
+			"followed": true,
+		}
+		if !truncated {
+			// Only meaningful when the bytes sent are one contiguous range
+			result["sha256"] = hex.EncodeToString(hash.Sum(nil))
+		}
+		if err != nil {
+			result["error"] = err.Error()
+		}
+		return result
+	}
+
+	ticker := time.NewTicker(followPollInterval)
+	defer ticker.Stop()
+	for {
+		// Send everything written so far
+		for {
+			n, readErr := f.Read(buf)
+			if n > 0 {
+				hash.Write(buf[:n])
+				if err := stream(map[string]interface{}{
+					"offset": pos,
+					"data":   base64.StdEncoding.EncodeToString(buf[:n]),
+				}); err != nil {
+					return finish("stream_closed", err)
+				}
+				pos += int64(n)
+				sent += int64(n)
+				lastGrowth = time.Now()
+			}
+			if readErr != nil && readErr != io.EOF {
+				return finish("error", readErr)
+			}
+			if readErr == io.EOF || n == 0 {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return finish("duration", nil)
+			}
+			return finish("cancelled", nil)
+		case <-ticker.C:
+		}
+
+		if time.Since(lastGrowth) >= idle {
+			return finish("idle", nil)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return finish("error", err)
+		}
+		if info.Size() < pos {
+			// Truncated: start over from the beginning
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return finish("error", err)
+			}
+			pos, truncated = 0, true
+			if err := stream(map[string]interface{}{"offset": int64(0), "truncated": true}); err != nil {
+				return finish("stream_closed", err)
+			}
+		}
+	}
+}
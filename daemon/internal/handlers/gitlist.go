@@ -0,0 +1,188 @@
+// Directory listing with git status - one listing a repo file browser can
+// render without correlating list_files and git status itself.
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gitStatusTimeout bounds git status on large repositories.
+const gitStatusTimeout = 30 * time.Second
+
+// Git statuses from least to most notable; a directory shows the most
+// notable status of anything under it.
+var gitStatusRank = map[string]int{
+	"clean":      0,
+	"ignored":    1,
+	"untracked":  2,
+	"staged":     3,
+	"modified":   4,
+	"conflicted": 5,
+}
+
+// gitEntry is one path from git status --porcelain.
+type gitEntry struct {
+	index, worktree byte
+}
+
+func (e gitEntry) status() string {
+	x, y := e.index, e.worktree
+	switch {
+	case x == '?' && y == '?':
+		return "untracked"
+	case x == '!' && y == '!':
+		return "ignored"
+	case x == 'U' || y == 'U' || (x == 'A' && y == 'A') || (x == 'D' && y == 'D'):
+		return "conflicted"
+	case y != ' ':
+		return "modified"
+	default:
+		return "staged"
+	}
+}
+
+// handleListDirWithGit lists a directory like list_files and, when it's in a
+// git repository, adds each entry's git status: git_status (clean, staged,
+// modified, untracked, ignored or conflicted) and, for files git reports
+// directly, the git_index and git_worktree codes from git status --porcelain.
+// Directories show the most notable status of anything inside them. Tracked
+// files deleted from the directory are listed under deleted.
+func handleListDirWithGit(params map[string]interface{}) map[string]interface{} {
+	path, _ := params["path"].(string)
+	if path == "" {
+		path = "."
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	files := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		files = append(files, fileToMap(filepath.Join(path, entry.Name()), entry))
+	}
+
+	result := map[string]interface{}{
+		"success": true,
+		"path":    path,
+		"files":   files,
+		"count":   len(files),
+		"git":     false,
+	}
+	if !HasCapability("git") {
+		result["git_error"] = "git capability not enabled"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitStatusTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "git", "-C", path, "rev-parse", "--show-toplevel", "--show-prefix").Output()
+	if err != nil {
+		return result // Not in a repository (or no git)
+	}
+	lines := strings.SplitN(strings.TrimRight(string(out), "\n"), "\n", 2)
+	prefix := ""
+	if len(lines) == 2 {
+		prefix = lines[1]
+	}
+	result["repo_root"] = lines[0]
+
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "status", "--porcelain=v1", "-z", "--branch", "--ignored=matching", "--", ".")
+	out, err = cmd.Output()
+	if err != nil {
+		result["git_error"] = "git status: " + commandError(err)
+		return result
+	}
+	result["git"] = true
+
+	// Statuses by entry name: own for paths git reports directly, rolled up
+	// for paths below a directory entry
+	own := make(map[string]gitEntry)
+	rolled := make(map[string]string)
+	dirStatus := "" // Set when git reports the listed directory itself
+	records := bytes.Split(out, []byte{0})
+	for i := 0; i < len(records); i++ {
+		rec := string(records[i])
+		if strings.HasPrefix(rec, "## ") {
+			result["branch"] = parseGitBranch(rec[3:])
+			continue
+		}
+		if len(rec) < 4 {
+			continue
+		}
+		entry := gitEntry{index: rec[0], worktree: rec[1]}
+		if entry.index == 'R' || entry.index == 'C' {
+			i++ // The next record is the original path
+		}
+
+		rel := strings.TrimSuffix(strings.TrimPrefix(rec[3:], prefix), "/")
+		if rel == "" {
+			dirStatus = entry.status()
+			continue
+		}
+		name, below, _ := strings.Cut(rel, "/")
+		if below == "" {
+			own[name] = entry
+		}
+		if s := entry.status(); gitStatusRank[s] > gitStatusRank[rolled[name]] {
+			rolled[name] = s
+		}
+	}
+
+	listed := make(map[string]bool, len(files))
+	for _, file := range files {
+		name := file["name"].(string)
+		listed[name] = true
+		status := rolled[name]
+		if status == "" {
+			status = "clean"
+			if dirStatus != "" {
+				status = dirStatus
+			}
+		}
+		file["git_status"] = status
+		if entry, ok := own[name]; ok {
+			file["git_index"] = string(entry.index)
+			file["git_worktree"] = string(entry.worktree)
+		}
+	}
+
+	deleted := []string{}
+	for name, entry := range own {
+		if !listed[name] && (entry.index == 'D' || entry.worktree == 'D') {
+			deleted = append(deleted, name)
+		}
+	}
+	result["deleted"] = deleted
+	return result
+}
+
+// parseGitBranch reads the branch from git status --branch's header, e.g.
+// "main...origin/main [ahead 1]" or "No commits yet on main".
+func parseGitBranch(header string) string {
+	header = strings.TrimPrefix(header, "No commits yet on ")
+	header = strings.TrimPrefix(header, "Initial commit on ")
+	if branch, _, ok := strings.Cut(header, "..."); ok {
+		return branch
+	}
+	branch, _, _ := strings.Cut(header, " ")
+	return branch
+}
+
+// commandError describes a failed command, including what it wrote to stderr.
+func commandError(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return strings.TrimSpace(string(exitErr.Stderr))
+	}
+	return err.Error()
+}
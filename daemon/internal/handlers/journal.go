@@ -0,0 +1,185 @@
+// Journal handler - queries systemd's journald via journalctl.
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// JournalEntry is a single structured journald record.
+type JournalEntry struct {
+	Timestamp string `json:"timestamp"`
+	Unit      string `json:"unit"`
+	Priority  int    `json:"priority"`
+	Message   string `json:"message"`
+}
+
+func handleJournal(params map[string]interface{}, stream StreamFunc) map[string]interface{} {
+	unit, _ := params["unit"].(string)
+	since, _ := params["since"].(string)
+	until, _ := params["until"].(string)
+	priority, _ := params["priority"].(string)
+	grep, _ := params["grep"].(string)
+	lines, _ := params["lines"].(float64)
+	follow, _ := params["follow"].(bool)
+	duration, _ := params["duration"].(float64)
+
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "journalctl not found (journald is only available on systemd hosts)",
+		}
+	}
+
+	if lines == 0 {
+		lines = 100
+	}
+
+	args := []string{"--no-pager", "-o", "json"}
+	if unit != "" {
+		args = append(args, "-u", unit)
+	}
+	if since != "" {
+		args = append(args, "--since", since)
+	}
+	if until != "" {
+		args = append(args, "--until", until)
+	}
+	if priority != "" {
+		args = append(args, "-p", priority)
+	}
+	if grep != "" {
+		args = append(args, "-g", grep)
+	}
+	args = append(args, "-n", strconv.Itoa(int(lines)))
+
+	if follow {
+		return followJournal(args, duration, stream)
+	}
+
+	output, err := exec.Command("journalctl", args...).Output()
+	if err != nil {
+		result := map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result["output"] = string(exitErr.Stderr)
+		}
+		return result
+	}
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if entry, ok := parseJournalLine(scanner.Bytes()); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"entries": entries,
+		"count":   len(entries),
+	}
+}
+
+// followJournal streams new journal entries until duration elapses or
+// Prime stops accepting partial results.
+func followJournal(args []string, duration float64, stream StreamFunc) map[string]interface{} {
+	if duration == 0 {
+		duration = 60
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(duration)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "journalctl", append(args, "-f")...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	if err := cmd.Start(); err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	count := 0
+	var streamErr error
+	batcher := newStreamBatcher(stream, "entries")
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry, ok := parseJournalLine(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		if streamErr = batcher.Add(entry, len(entry.Message)); streamErr != nil {
+			cancel()
+			break
+		}
+		count++
+	}
+	cmd.Wait()
+	if err := batcher.Flush(); streamErr == nil {
+		streamErr = err
+	}
+
+	result := map[string]interface{}{
+		"success":  streamErr == nil,
+		"count":    count,
+		"followed": true,
+	}
+	if streamErr != nil {
+		result["error"] = streamErr.Error()
+	}
+	return result
+}
+
+// parseJournalLine converts one line of `journalctl -o json` output.
+func parseJournalLine(line []byte) (JournalEntry, bool) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return JournalEntry{}, false
+	}
+
+	entry := JournalEntry{}
+	if ts, ok := raw["__REALTIME_TIMESTAMP"].(string); ok {
+		if usec, err := strconv.ParseInt(ts, 10, 64); err == nil {
+			entry.Timestamp = time.UnixMicro(usec).UTC().Format(time.RFC3339Nano)
+		}
+	}
+	if unit, ok := raw["_SYSTEMD_UNIT"].(string); ok {
+		entry.Unit = unit
+	} else if ident, ok := raw["SYSLOG_IDENTIFIER"].(string); ok {
+		entry.Unit = ident
+	}
+	if p, ok := raw["PRIORITY"].(string); ok {
+		entry.Priority, _ = strconv.Atoi(p)
+	}
+
+	// journald encodes non-UTF-8 messages as an array of bytes
+	switch msg := raw["MESSAGE"].(type) {
+	case string:
+		entry.Message = msg
+	case []interface{}:
+		buf := make([]byte, 0, len(msg))
+		for _, b := range msg {
+			if f, ok := b.(float64); ok {
+				buf = append(buf, byte(f))
+			}
+		}
+		entry.Message = string(buf)
+	case nil:
+	default:
+		entry.Message = fmt.Sprint(msg)
+	}
+
+	return entry, true
+}
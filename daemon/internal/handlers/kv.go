@@ -0,0 +1,126 @@
+// KV handlers - small persistent state for scripts that span commands.
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ultron/daemon/internal/kvstore"
+)
+
+var (
+	kvPath  = "kv.json"
+	kvOnce  sync.Once
+	kvStore *kvstore.Store
+	kvErr   error
+)
+
+// SetKVPath sets the file backing the kv_* handlers. Call before the first kv command.
+func SetKVPath(path string) {
+	if path != "" {
+		kvPath = path
+	}
+}
+
+func openKV() (*kvstore.Store, error) {
+	kvOnce.Do(func() {
+		kvStore, kvErr = kvstore.Open(kvPath)
+	})
+	return kvStore, kvErr
+}
+
+func handleKVGet(params map[string]interface{}) map[string]interface{} {
+	key, _ := params["key"].(string)
+	if key == "" {
+		return map[string]interface{}{"success": false, "error": "key required"}
+	}
+
+	store, err := openKV()
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	entry, ok := store.Get(key)
+	if !ok {
+		return map[string]interface{}{"success": true, "key": key, "found": false}
+	}
+	resp := map[string]interface{}{
+		"success":    true,
+		"key":        key,
+		"found":      true,
+		"value":      entry.Value,
+		"updated_at": entry.UpdatedAt,
+	}
+	if entry.ExpiresAt != nil {
+		resp["expires_at"] = *entry.ExpiresAt
+	}
+	return resp
+}
+
+func handleKVSet(params map[string]interface{}) map[string]interface{} {
+	key, _ := params["key"].(string)
+	value, hasValue := params["value"]
+	ttl, _ := params["ttl"].(float64) // seconds, 0 = no expiry
+	if key == "" || !hasValue {
+		return map[string]interface{}{"success": false, "error": "key and value required"}
+	}
+	if ttl < 0 {
+		return map[string]interface{}{"success": false, "error": "ttl must be >= 0"}
+	}
+
+	store, err := openKV()
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	entry, err := store.Set(key, value, time.Duration(ttl*float64(time.Second)))
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	resp := map[string]interface{}{
+		"success": true,
+		"key":     key,
+	}
+	if entry.ExpiresAt != nil {
+		resp["expires_at"] = *entry.ExpiresAt
+	}
+	return resp
+}
+
+func handleKVDelete(params map[string]interface{}) map[string]interface{} {
+	key, _ := params["key"].(string)
+	if key == "" {
+		return map[string]interface{}{"success": false, "error": "key required"}
+	}
+
+	store, err := openKV()
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	deleted, err := store.Delete(key)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return map[string]interface{}{
+		"success": true,
+		"key":     key,
+		"deleted": deleted,
+	}
+}
+
+func handleKVList(params map[string]interface{}) map[string]interface{} {
+	prefix, _ := params["prefix"].(string)
+
+	store, err := openKV()
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	keys := store.List(prefix)
+	return map[string]interface{}{
+		"success": true,
+		"keys":    keys,
+		"count":   len(keys),
+	}
+}
@@ -0,0 +1,189 @@
+// Lock handlers - advisory file locks for coordinating across commands.
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultLockTTL = 5 * time.Minute
+
+// LockHolder is written into a lock file while it is held, so anyone who
+// finds it contended can see by whom.
+type LockHolder struct {
+	LockID     string    `json:"lock_id"`
+	Owner      string    `json:"owner,omitempty"`
+	Hostname   string    `json:"hostname"`
+	PID        int       `json:"pid"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// heldLock is a lock this daemon holds. The flock lives as long as file
+// stays open; expiry releases it if the holder never does.
+type heldLock struct {
+	path   string
+	file   *os.File
+	holder LockHolder
+	expiry *time.Timer
+}
+
+var (
+	locksMu sync.Mutex
+	locks   = make(map[string]*heldLock) // by absolute lock file path
+)
+
+// readLockHolder returns who holds the lock file at path, if it says.
+func readLockHolder(path string) *LockHolder {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var holder LockHolder
+	if json.Unmarshal(data, &holder) != nil {
+		return nil
+	}
+	return &holder
+}
+
+// handleAcquireLock takes an exclusive flock on path, waiting up to timeout
+// seconds (default: try once). The lock is released by release_lock with the
+// returned lock_id, or automatically after ttl seconds (default 300) so a
+// crashed holder can't keep it forever.
+func handleAcquireLock(params map[string]interface{}) map[string]interface{} {
+	path, _ := params["path"].(string)
+	owner, _ := params["owner"].(string)
+	timeout, _ := params["timeout"].(float64)
+	ttlSecs, _ := params["ttl"].(float64)
+
+	if path == "" {
+		return map[string]interface{}{"success": false, "error": "no path provided"}
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	ttl := defaultLockTTL
+	if ttlSecs > 0 {
+		ttl = time.Duration(ttlSecs * float64(time.Second))
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	deadline := time.Now().Add(time.Duration(timeout * float64(time.Second)))
+	for {
+		acquired, err := tryFlock(file)
+		if err != nil {
+			file.Close()
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			result := map[string]interface{}{
+				"success":  false,
+				"acquired": false,
+				"path":     path,
+				"error":    "lock is held",
+			}
+			if holder := readLockHolder(path); holder != nil {
+				result["holder"] = holder
+				result["error"] = fmt.Sprintf("lock is held by %s (pid %d on %s) until %s",
+					holderName(holder), holder.PID, holder.Hostname, holder.ExpiresAt.Format(time.RFC3339))
+			}
+			return result
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	holder := LockHolder{
+		LockID:     fmt.Sprintf("lock-%d", now.UnixNano()),
+		Owner:      owner,
+		Hostname:   hostname,
+		PID:        os.Getpid(),
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if data, err := json.Marshal(holder); err == nil {
+		file.Truncate(0)
+		file.WriteAt(data, 0)
+	}
+
+	lock := &heldLock{path: path, file: file, holder: holder}
+	locksMu.Lock()
+	locks[path] = lock
+	lock.expiry = time.AfterFunc(ttl, func() {
+		if releaseLock(path, holder.LockID) == nil {
+			slog.Warn("Lock expired and released", "path", path, "holder", holderName(&holder), "ttl", ttl)
+		}
+	})
+	locksMu.Unlock()
+
+	return map[string]interface{}{
+		"success":    true,
+		"acquired":   true,
+		"path":       path,
+		"lock_id":    holder.LockID,
+		"expires_at": holder.ExpiresAt,
+	}
+}
+
+func holderName(h *LockHolder) string {
+	if h.Owner != "" {
+		return h.Owner
+	}
+	return h.LockID
+}
+
+// releaseLock drops a lock this daemon holds, if lockID still matches.
+func releaseLock(path, lockID string) error {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+
+	lock, ok := locks[path]
+	if !ok {
+		return fmt.Errorf("lock %s is not held by this daemon", path)
+	}
+	if lock.holder.LockID != lockID {
+		return fmt.Errorf("lock %s is held under a different lock_id", path)
+	}
+	delete(locks, path)
+	lock.expiry.Stop()
+
+	// Clear the holder before unlocking so the next reader doesn't see a stale one
+	lock.file.Truncate(0)
+	err := unflock(lock.file)
+	if closeErr := lock.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func handleReleaseLock(params map[string]interface{}) map[string]interface{} {
+	path, _ := params["path"].(string)
+	lockID, _ := params["lock_id"].(string)
+
+	if path == "" || lockID == "" {
+		return map[string]interface{}{"success": false, "error": "path and lock_id required"}
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	if err := releaseLock(path, lockID); err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return map[string]interface{}{"success": true, "path": path, "released": true}
+}
@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func tryFlock(f *os.File) (bool, error) {
+	return false, fmt.Errorf("file locks not supported on %s", runtime.GOOS)
+}
+
+func unflock(f *os.File) error {
+	return nil
+}
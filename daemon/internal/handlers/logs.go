@@ -0,0 +1,70 @@
+// Log handlers - expose the daemon's own recent logs to Prime.
+package handlers
+
+import (
+	"log/slog"
+
+	"github.com/ultron/daemon/internal/logging"
+)
+
+func handleGetLogs(params map[string]interface{}) map[string]interface{} {
+	levelName, _ := params["level"].(string)
+	lines, _ := params["lines"].(float64)
+
+	minLevel := slog.LevelDebug
+	if levelName != "" {
+		level, err := logging.ParseLevel(levelName)
+		if err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			}
+		}
+		minLevel = level
+	}
+
+	if lines == 0 {
+		lines = 100
+	}
+
+	records := logging.Recent(minLevel, int(lines))
+	return map[string]interface{}{
+		"success": true,
+		"logs":    records,
+		"count":   len(records),
+	}
+}
+
+func handleGetLogLevel(params map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"success": true,
+		"level":   logging.Level().String(),
+	}
+}
+
+func handleSetLogLevel(params map[string]interface{}) map[string]interface{} {
+	levelName, _ := params["level"].(string)
+	if levelName == "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "no level provided",
+		}
+	}
+
+	level, err := logging.ParseLevel(levelName)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+
+	previous := logging.SetLevel(level)
+	slog.Info("Log level changed", "from", previous.String(), "to", level.String())
+
+	return map[string]interface{}{
+		"success":  true,
+		"level":    level.String(),
+		"previous": previous.String(),
+	}
+}
@@ -0,0 +1,227 @@
+// Mount handlers - mount and unmount filesystems via mount(8)/umount(8).
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const mountTimeout = 60 * time.Second
+
+var (
+	fstypePattern       = regexp.MustCompile(`^[a-z0-9._]+$`)
+	mountOptionsPattern = regexp.MustCompile(`^[A-Za-z0-9_.,=:/@+-]+$`)
+)
+
+// protectedMounts are never unmounted; losing them takes the machine down with it.
+var protectedMounts = map[string]bool{
+	"/": true, "/proc": true, "/sys": true, "/dev": true, "/run": true, "/boot": true,
+}
+
+// MountInfo describes one entry in /proc/mounts.
+type MountInfo struct {
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	FSType  string `json:"fstype"`
+	Options string `json:"options"`
+}
+
+// findMount returns the mount at target, or nil if nothing is mounted there.
+// When several mounts are stacked on target, the topmost one wins.
+func findMount(target string) (*MountInfo, error) {
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var found *MountInfo
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || unescapeMountPath(fields[1]) != target {
+			continue
+		}
+		found = &MountInfo{
+			Source:  unescapeMountPath(fields[0]),
+			Target:  target,
+			FSType:  fields[2],
+			Options: fields[3],
+		}
+	}
+	return found, scanner.Err()
+}
+
+// unescapeMountPath decodes the octal escapes /proc/mounts uses for spaces etc.
+func unescapeMountPath(s string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(s)
+}
+
+// mountResult reports the state of target after a mount or unmount.
+func mountResult(target string, output []byte) map[string]interface{} {
+	mount, err := findMount(target)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	result := map[string]interface{}{
+		"success": true,
+		"target":  target,
+		"mounted": mount != nil,
+		"output":  strings.TrimSpace(string(output)),
+	}
+	if mount != nil {
+		result["mount"] = mount
+	}
+	return result
+}
+
+func handleMount(params map[string]interface{}) map[string]interface{} {
+	if resp := requireProc(); resp != nil {
+		return resp
+	}
+
+	source, _ := params["source"].(string)
+	target, _ := params["target"].(string)
+	fstype, _ := params["fstype"].(string)
+	options, _ := params["options"].(string)
+	readOnly, _ := params["read_only"].(bool)
+
+	if source == "" || target == "" {
+		return map[string]interface{}{"success": false, "error": "source and target required"}
+	}
+	if strings.HasPrefix(source, "-") {
+		return map[string]interface{}{"success": false, "error": "invalid source: " + source}
+	}
+	if !filepath.IsAbs(target) {
+		return map[string]interface{}{"success": false, "error": "target must be an absolute path"}
+	}
+	target = filepath.Clean(target)
+	if err := checkProtectedFor(target, "mount over"); err != nil {
+		return map[string]interface{}{
+			"success":   false,
+			"error":     err.Error(),
+			"protected": true,
+		}
+	}
+	if info, err := os.Stat(target); err != nil || !info.IsDir() {
+		return map[string]interface{}{"success": false, "error": "target is not an existing directory: " + target}
+	}
+	if fstype != "" && !fstypePattern.MatchString(fstype) {
+		return map[string]interface{}{"success": false, "error": "invalid fstype: " + fstype}
+	}
+	if options != "" && !mountOptionsPattern.MatchString(options) {
+		return map[string]interface{}{"success": false, "error": "invalid mount options: " + options}
+	}
+	// Block devices and image files must exist; network sources (host:/export, //host/share) can't be checked
+	if strings.HasPrefix(source, "/") && !strings.HasPrefix(source, "//") {
+		if _, err := os.Stat(source); err != nil {
+			return map[string]interface{}{"success": false, "error": "source does not exist: " + source}
+		}
+	}
+
+	if mount, _ := findMount(target); mount != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("%s is already mounted (%s from %s)", target, mount.FSType, mount.Source),
+			"mount":   mount,
+		}
+	}
+
+	args := []string{}
+	if fstype != "" {
+		args = append(args, "-t", fstype)
+	}
+	if readOnly {
+		if options != "" {
+			options += ","
+		}
+		options += "ro"
+	}
+	if options != "" {
+		args = append(args, "-o", options)
+	}
+	args = append(args, "--", source, target)
+
+	ctx, cancel := context.WithTimeout(context.Background(), mountTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "mount", args...).CombinedOutput()
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("mount failed: %s", strings.TrimSpace(string(output))),
+			"target":  target,
+		}
+	}
+	return mountResult(target, output)
+}
+
+func handleUnmount(params map[string]interface{}) map[string]interface{} {
+	if resp := requireProc(); resp != nil {
+		return resp
+	}
+
+	target, _ := params["target"].(string)
+	lazy, _ := params["lazy"].(bool)
+	force, _ := params["force"].(bool)
+	confirm, _ := params["confirm"].(bool)
+
+	if target == "" || !filepath.IsAbs(target) {
+		return map[string]interface{}{"success": false, "error": "target must be an absolute path"}
+	}
+	target = filepath.Clean(target)
+	if protectedMounts[target] {
+		return map[string]interface{}{"success": false, "error": "refusing to unmount " + target}
+	}
+	if (lazy || force) && !confirm {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "lazy or forced unmount detaches a filesystem that is still in use; set confirm=true to proceed",
+		}
+	}
+
+	mount, err := findMount(target)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	if mount == nil {
+		return map[string]interface{}{"success": false, "error": target + " is not a mount point"}
+	}
+
+	args := []string{}
+	if lazy {
+		args = append(args, "-l")
+	}
+	if force {
+		args = append(args, "-f")
+	}
+	args = append(args, "--", target)
+
+	ctx, cancel := context.WithTimeout(context.Background(), mountTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "umount", args...).CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		result := map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("unmount failed: %s", msg),
+			"target":  target,
+		}
+		if strings.Contains(msg, "busy") {
+			// Show who is holding it so the caller can decide whether to stop them or force it
+			if holders, _, err := findOpenFiles(target); err == nil {
+				result["busy"] = true
+				result["holders"] = holders
+				result["hint"] = "stop the processes holding the filesystem, or retry with lazy=true and confirm=true"
+			}
+		}
+		return result
+	}
+	return mountResult(target, output)
+}
@@ -0,0 +1,197 @@
+// Process inspection handlers - environment and open files, read from /proc.
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ultron/daemon/internal/executor"
+)
+
+// procError turns a /proc read failure into a message the operator can act on.
+func procError(pid int, err error) map[string]interface{} {
+	msg := err.Error()
+	switch {
+	case os.IsNotExist(err):
+		msg = fmt.Sprintf("no such process: %d", pid)
+	case os.IsPermission(err):
+		msg = fmt.Sprintf("permission denied reading process %d: it belongs to another user; run the daemon as root or as that user", pid)
+	}
+	return map[string]interface{}{"success": false, "error": msg}
+}
+
+func requireProc() map[string]interface{} {
+	if runtime.GOOS != "linux" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("not supported on %s (requires /proc)", runtime.GOOS),
+		}
+	}
+	return nil
+}
+
+func handleProcessEnv(params map[string]interface{}) map[string]interface{} {
+	pid, _ := params["pid"].(float64)
+	if pid <= 0 {
+		return map[string]interface{}{"success": false, "error": "pid required"}
+	}
+	if resp := requireProc(); resp != nil {
+		return resp
+	}
+
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", int(pid)))
+	if err != nil {
+		return procError(int(pid), err)
+	}
+
+	var entries []string
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		entries = append(entries, string(entry))
+	}
+	env, redacted := executor.RedactEnv(executor.ParseEnv(entries))
+
+	return map[string]interface{}{
+		"success":  true,
+		"pid":      int(pid),
+		"env":      env,
+		"count":    len(env),
+		"redacted": redacted,
+	}
+}
+
+// OpenFile is one entry from /proc/<pid>/fd.
+type OpenFile struct {
+	PID    int    `json:"pid,omitempty"`
+	Name   string `json:"name,omitempty"` // Process name, set for path lookups
+	FD     int    `json:"fd"`
+	Type   string `json:"type"` // file, socket, pipe, anon_inode
+	Target string `json:"target"`
+}
+
+// readOpenFiles resolves every descriptor a process has open.
+func readOpenFiles(pid int) ([]OpenFile, error) {
+	dir := fmt.Sprintf("/proc/%d/fd", pid)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]OpenFile, 0, len(entries))
+	for _, entry := range entries {
+		fd, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue // Closed while we were reading
+		}
+		files = append(files, OpenFile{FD: fd, Type: fdType(target), Target: target})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].FD < files[j].FD })
+	return files, nil
+}
+
+// fdType classifies a /proc fd link target, e.g. "socket:[1234]" or "/var/log/syslog".
+func fdType(target string) string {
+	switch {
+	case strings.HasPrefix(target, "socket:"):
+		return "socket"
+	case strings.HasPrefix(target, "pipe:"):
+		return "pipe"
+	case strings.HasPrefix(target, "anon_inode:"):
+		return "anon_inode"
+	default:
+		return "file"
+	}
+}
+
+func handleProcessOpenFiles(params map[string]interface{}) map[string]interface{} {
+	pid, _ := params["pid"].(float64)
+	path, _ := params["path"].(string)
+	if pid <= 0 && path == "" {
+		return map[string]interface{}{"success": false, "error": "pid or path required"}
+	}
+	if resp := requireProc(); resp != nil {
+		return resp
+	}
+
+	if pid > 0 {
+		files, err := readOpenFiles(int(pid))
+		if err != nil {
+			return procError(int(pid), err)
+		}
+		return map[string]interface{}{
+			"success": true,
+			"pid":     int(pid),
+			"files":   files,
+			"count":   len(files),
+		}
+	}
+
+	// Reverse lookup: which processes hold path (or anything under it) open
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	matches, skipped, err := findOpenFiles(absPath)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	result := map[string]interface{}{
+		"success": true,
+		"path":    absPath,
+		"files":   matches,
+		"count":   len(matches),
+	}
+	if skipped > 0 {
+		// Without root, other users' processes can't be inspected
+		result["skipped"] = skipped
+	}
+	return result
+}
+
+// findOpenFiles lists descriptors, across all processes, that refer to absPath
+// or anything under it. skipped counts processes we weren't allowed to inspect.
+func findOpenFiles(absPath string) (matches []OpenFile, skipped int, err error) {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matches = []OpenFile{}
+	for _, proc := range procs {
+		p, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+		files, err := readOpenFiles(p)
+		if err != nil {
+			if os.IsPermission(err) {
+				skipped++
+			}
+			continue
+		}
+		var name string
+		for _, f := range files {
+			target := strings.TrimSuffix(f.Target, " (deleted)")
+			if f.Type != "file" || (target != absPath && !strings.HasPrefix(target, strings.TrimSuffix(absPath, "/")+"/")) {
+				continue
+			}
+			if name == "" {
+				comm, _ := os.ReadFile(fmt.Sprintf("/proc/%d/comm", p))
+				name = strings.TrimSpace(string(comm))
+			}
+			f.PID, f.Name = p, name
+			matches = append(matches, f)
+		}
+	}
+	return matches, skipped, nil
+}
@@ -0,0 +1,120 @@
+// Protected paths - deletes refuse to remove critical system directories or
+// anything in them, the Ultron installation or the daemon's own executable.
+// Mounts refuse to cover them for the same reason.
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// protectedPaths may not be deleted, nor may anything in or containing them.
+// Entries may be globs ("/home/*").
+var protectedPaths []string
+
+// deletablePaths are directories inside protected paths whose contents may
+// still be deleted (home directories, /var/tmp). Entries may be globs.
+var deletablePaths []string
+
+// SetProtectedPaths sets the paths delete operations refuse to touch. The
+// daemon's executable is always protected as well.
+func SetProtectedPaths(paths []string) {
+	protectedPaths = cleanPaths(paths)
+}
+
+// SetDeletablePaths sets the directories under protected paths whose
+// contents deletes may remove; the directories themselves stay protected.
+func SetDeletablePaths(paths []string) {
+	deletablePaths = cleanPaths(paths)
+}
+
+func cleanPaths(paths []string) []string {
+	cleaned := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			cleaned = append(cleaned, filepath.Clean(p))
+		}
+	}
+	return cleaned
+}
+
+// checkProtected returns an error if deleting path would remove a protected
+// path or something in one, unless it's inside a deletable directory that is
+// itself within that protected path. Symlinks are resolved too, so a link
+// can't be used to reach one.
+func checkProtected(path string) error {
+	return checkProtectedFor(path, "delete")
+}
+
+// checkProtectedFor is checkProtected for an operation other than delete
+// that would equally destroy or hide what's at path; action names it in
+// the error ("mount over").
+func checkProtectedFor(path, action string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	candidates := []string{abs}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil && resolved != abs {
+		candidates = append(candidates, resolved)
+	}
+
+	protected := protectedPaths
+	if exe, err := os.Executable(); err == nil {
+		protected = append(protected[:len(protected):len(protected)], exe)
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			protected = append(protected, resolved)
+		}
+	}
+
+	for _, target := range candidates {
+		if target == filepath.Dir(target) {
+			return fmt.Errorf("refusing to %s %s: it is the filesystem root", action, path)
+		}
+		for _, p := range protected {
+			if matched, _ := filepath.Match(p, target); matched || withinPath(p, target) {
+				return fmt.Errorf("refusing to %s %s: it is or contains protected path %s (see DAEMON_PROTECTED_PATHS)", action, path, p)
+			}
+			if root, ok := matchedAncestor(target, p); ok && !deletableWithin(target, root) {
+				return fmt.Errorf("refusing to %s %s: it is inside protected path %s (see DAEMON_PROTECTED_PATHS and DAEMON_DELETABLE_PATHS)", action, path, p)
+			}
+		}
+	}
+	return nil
+}
+
+// deletableWithin reports whether target is strictly inside a deletable
+// directory that lies within the protected directory root. A deletable
+// entry outside root (home, say, around a protected ULTRON_ROOT) doesn't
+// lift root's protection.
+func deletableWithin(target, root string) bool {
+	for _, d := range deletablePaths {
+		dir, ok := matchedAncestor(filepath.Dir(target), d)
+		if ok && withinPath(dir, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchedAncestor returns the closest of path and its parents that pattern
+// matches.
+func matchedAncestor(path, pattern string) (string, bool) {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if matched, _ := filepath.Match(pattern, dir); matched {
+			return dir, true
+		}
+		if dir == filepath.Dir(dir) {
+			return "", false
+		}
+	}
+}
+
+// withinPath reports whether path is dir or somewhere under it. A glob path
+// counts as under the directories its matches would be in.
+func withinPath(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
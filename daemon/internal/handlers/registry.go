@@ -3,38 +3,113 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
+
+	"github.com/ultron/daemon/internal/executor"
 )
 
 // Handler is a function that handles a command and returns a result.
 type Handler func(params map[string]interface{}) map[string]interface{}
 
+// StreamFunc sends a partial result to Prime while a command is still running.
+// It returns an error once the receiver is gone, so handlers know to stop.
+type StreamFunc func(chunk map[string]interface{}) error
+
+// StreamHandler is a handler that can send partial results (e.g. followed
+// log lines) before returning its final result.
+type StreamHandler func(params map[string]interface{}, stream StreamFunc) map[string]interface{}
+
 // Registry manages command handlers.
 type Registry struct {
-	handlers map[string]Handler
-	mu       sync.RWMutex
+	handlers   map[string]StreamHandler
+	idempotent map[string]bool         // Safe to retry without explicit opt-in
+	streaming  map[string]bool         // Registered with RegisterStream
+	readSafe   map[string]bool         // Allowed in read-only mode besides idempotent types
+	readOnly   atomic.Bool             // Refuse everything that could change the host
+	limits     map[string]*typeLimiter // See SetConcurrency
+	active     atomic.Int64            // Handler calls currently running
+	mu         sync.RWMutex
 }
 
 // NewRegistry creates a new handler registry.
 func NewRegistry() *Registry {
 	return &Registry{
-		handlers: make(map[string]Handler),
+		handlers:   make(map[string]StreamHandler),
+		idempotent: make(map[string]bool),
+		streaming:  make(map[string]bool),
+		readSafe:   make(map[string]bool),
+		limits:     make(map[string]*typeLimiter),
 	}
 }
 
 // Register adds a handler for a command type.
 // This is how you extend the daemon's capabilities without changing core code.
 func (r *Registry) Register(cmdType string, handler Handler) {
+	r.register(cmdType, func(params map[string]interface{}, _ StreamFunc) map[string]interface{} {
+		return handler(params)
+	}, false)
+}
+
+// RegisterStream adds a streaming handler for a command type.
+func (r *Registry) RegisterStream(cmdType string, handler StreamHandler) {
+	r.register(cmdType, handler, true)
+}
+
+func (r *Registry) register(cmdType string, handler StreamHandler, streaming bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.handlers[cmdType] = handler
+	r.streaming[cmdType] = streaming
+}
+
+// MarkIdempotent declares command types that are safe to retry. Other types
+// are only retried when the retry spec sets allow_mutating.
+func (r *Registry) MarkIdempotent(cmdTypes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range cmdTypes {
+		r.idempotent[t] = true
+	}
+}
+
+// MarkReadOnly declares command types that never change the host but aren't
+// idempotent (such as followed streams), so read-only mode still allows them.
+func (r *Registry) MarkReadOnly(cmdTypes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range cmdTypes {
+		r.readSafe[t] = true
+	}
+}
+
+// SetReadOnly turns read-only mode on or off. While on, only idempotent and
+// MarkReadOnly command types run; everything else fails without running.
+func (r *Registry) SetReadOnly(readOnly bool) {
+	r.readOnly.Store(readOnly)
+}
+
+// ReadOnly reports whether read-only mode is on.
+func (r *Registry) ReadOnly() bool {
+	return r.readOnly.Load()
 }
 
 // Handle executes the handler for the given command type.
 func (r *Registry) Handle(cmdType string, params map[string]interface{}) map[string]interface{} {
+	return r.HandleStream(cmdType, params, nil)
+}
+
+// HandleStream executes the handler for the given command type, passing it
+// stream for partial results. A nil stream makes streaming sends fail.
+func (r *Registry) HandleStream(cmdType string, params map[string]interface{}, stream StreamFunc) map[string]interface{} {
 	r.mu.RLock()
 	handler, exists := r.handlers[cmdType]
+	idempotent := r.idempotent[cmdType]
+	streaming := r.streaming[cmdType]
+	readSafe := r.readSafe[cmdType]
+	limiter := r.limits[cmdType]
 	r.mu.RUnlock()
 
 	if !exists {
@@ -43,8 +118,84 @@ func (r *Registry) Handle(cmdType string, params map[string]interface{}) map[str
 			"error":   fmt.Sprintf("unknown command type: %s", cmdType),
 		}
 	}
+	if r.readOnly.Load() && !idempotent && !readSafe {
+		return map[string]interface{}{
+			"success":   false,
+			"error":     fmt.Sprintf("%s is not allowed: daemon is read-only (DAEMON_READONLY)", cmdType),
+			"read_only": true,
+		}
+	}
+
+	if stream == nil {
+		stream = func(map[string]interface{}) error {
+			return fmt.Errorf("streaming not supported for this caller")
+		}
+	}
+
+	// Count the handler as active for as long as it actually runs, which may
+	// outlast the watchdog
+	registered := handler
+	handler = func(params map[string]interface{}, stream StreamFunc) map[string]interface{} {
+		r.active.Add(1)
+		defer r.active.Add(-1)
+		return registered(params, stream)
+	}
 
-	return handler(params)
+	policy, err := parseRetryPolicy(params)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		}
+	}
+	// Each attempt gets its own deadline so a hung handler can't hold the caller forever
+	deadline := watchdogDeadline(params, streaming)
+	run := func() map[string]interface{} {
+		if limiter == nil {
+			return runWithWatchdog(cmdType, deadline, stream, handler, params)
+		}
+		// Queue for a slot, and hold it until the handler really returns,
+		// even if the watchdog has given up on it
+		waited, err := limiter.acquire(cmdType, deadline)
+		if err != nil {
+			return map[string]interface{}{
+				"success":   false,
+				"error":     err.Error(),
+				"timed_out": true,
+			}
+		}
+		limited := func(params map[string]interface{}, stream StreamFunc) map[string]interface{} {
+			defer limiter.release()
+			return handler(params, stream)
+		}
+		result := runWithWatchdog(cmdType, deadline, stream, limited, params)
+		if waited > 0 && result != nil {
+			result["queued_ms"] = waited.Milliseconds()
+		}
+		return result
+	}
+
+	if policy == nil {
+		return run()
+	}
+	if !idempotent && !policy.AllowMutating {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("%s is not idempotent; set retry.allow_mutating to retry it", cmdType),
+		}
+	}
+
+	// Track the whole retry loop so cancel_command also stops a pending retry
+	commandID, _ := params["command_id"].(string)
+	ctx, release := executor.DefaultExecutor.Track(context.Background(), commandID)
+	defer release()
+	return runWithRetry(ctx, cmdType, policy, run)
+}
+
+// ActiveTasks returns how many handler calls are running right now. Commands
+// waiting for a concurrency slot aren't counted.
+func (r *Registry) ActiveTasks() int {
+	return int(r.active.Load())
 }
 
 // HasHandler checks if a handler exists for the command type.
@@ -75,7 +226,42 @@ func Register(cmdType string, handler Handler) {
 	DefaultRegistry.Register(cmdType, handler)
 }
 
+// RegisterStream is a convenience function to register a streaming handler with the default registry.
+func RegisterStream(cmdType string, handler StreamHandler) {
+	DefaultRegistry.RegisterStream(cmdType, handler)
+}
+
+// MarkIdempotent is a convenience function to mark command types idempotent in the default registry.
+func MarkIdempotent(cmdTypes ...string) {
+	DefaultRegistry.MarkIdempotent(cmdTypes...)
+}
+
+// MarkReadOnly is a convenience function to mark command types read-only in the default registry.
+func MarkReadOnly(cmdTypes ...string) {
+	DefaultRegistry.MarkReadOnly(cmdTypes...)
+}
+
+// SetReadOnly is a convenience function for the default registry.
+func SetReadOnly(readOnly bool) {
+	DefaultRegistry.SetReadOnly(readOnly)
+}
+
+// ReadOnly is a convenience function for the default registry.
+func ReadOnly() bool {
+	return DefaultRegistry.ReadOnly()
+}
+
+// ActiveTasks is a convenience function for the default registry.
+func ActiveTasks() int {
+	return DefaultRegistry.ActiveTasks()
+}
+
 // Handle is a convenience function to handle with the default registry.
 func Handle(cmdType string, params map[string]interface{}) map[string]interface{} {
 	return DefaultRegistry.Handle(cmdType, params)
 }
+
+// HandleStream is a convenience function to handle a streaming command with the default registry.
+func HandleStream(cmdType string, params map[string]interface{}, stream StreamFunc) map[string]interface{} {
+	return DefaultRegistry.HandleStream(cmdType, params, stream)
+}
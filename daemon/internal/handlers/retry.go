@@ -0,0 +1,132 @@
+// Retry - re-runs handlers that fail transiently.
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Retry limits
+const (
+	maxRetryAttempts  = 10
+	defaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 30 * time.Second // Cap on each wait, however far backoff has doubled
+)
+
+// RetryPolicy re-runs a handler on transient failures. It is read from a
+// command's optional "retry" param:
+//
+//	{"max_attempts": 3, "backoff_ms": 500, "retry_on_codes": [125], "allow_mutating": false}
+//
+// Backoff doubles after each attempt, up to maxRetryDelay. With no
+// retry_on_codes any failure is retried; otherwise only failures whose
+// exit_code is listed.
+type RetryPolicy struct {
+	MaxAttempts   int
+	Backoff       time.Duration
+	RetryOnCodes  []int
+	AllowMutating bool // Required to retry command types not marked idempotent
+}
+
+// parseRetryPolicy reads params["retry"]. It returns nil when no retry was requested.
+func parseRetryPolicy(params map[string]interface{}) (*RetryPolicy, error) {
+	raw, ok := params["retry"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	attempts, _ := raw["max_attempts"].(float64)
+	backoffMs, _ := raw["backoff_ms"].(float64)
+	allowMutating, _ := raw["allow_mutating"].(bool)
+	if attempts < 1 || attempts > maxRetryAttempts {
+		return nil, fmt.Errorf("retry.max_attempts must be between 1 and %d", maxRetryAttempts)
+	}
+
+	policy := &RetryPolicy{
+		MaxAttempts:   int(attempts),
+		Backoff:       time.Duration(backoffMs) * time.Millisecond,
+		AllowMutating: allowMutating,
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultRetryDelay
+	}
+	if backoffMs > float64(maxRetryDelay.Milliseconds()) {
+		policy.Backoff = maxRetryDelay
+	}
+	if codes, ok := raw["retry_on_codes"].([]interface{}); ok {
+		for _, c := range codes {
+			if code, ok := c.(float64); ok {
+				policy.RetryOnCodes = append(policy.RetryOnCodes, int(code))
+			}
+		}
+	}
+	return policy, nil
+}
+
+// shouldRetry reports whether result is a failure the policy covers.
+func (p *RetryPolicy) shouldRetry(result map[string]interface{}) bool {
+	if success, _ := result["success"].(bool); success {
+		return false
+	}
+	if len(p.RetryOnCodes) == 0 {
+		return true
+	}
+
+	var code int
+	switch v := result["exit_code"].(type) {
+	case int:
+		code = v
+	case float64:
+		code = int(v)
+	default:
+		return false
+	}
+	for _, c := range p.RetryOnCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// runWithRetry calls run until it succeeds, the failure doesn't qualify,
+// attempts run out or ctx is done (the command was cancelled). The final
+// result carries an "attempts" count.
+func runWithRetry(ctx context.Context, cmdType string, policy *RetryPolicy, run func() map[string]interface{}) map[string]interface{} {
+	delay := policy.Backoff
+	var result map[string]interface{}
+	attempt := 1
+	for ; ; attempt++ {
+		result = run()
+		if result == nil {
+			result = map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("%s returned no result", cmdType),
+			}
+		}
+		if attempt >= policy.MaxAttempts || !policy.shouldRetry(result) || ctx.Err() != nil {
+			break
+		}
+		slog.Warn("Command failed, retrying", "type", cmdType, "attempt", attempt,
+			"max_attempts", policy.MaxAttempts, "delay", delay, "error", result["error"])
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			result["cancelled"] = true
+			break
+		}
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+	result["attempts"] = attempt
+	return result
+}
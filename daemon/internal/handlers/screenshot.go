@@ -0,0 +1,79 @@
+// Screenshot shrinking - scaling and recompressing computer-use and browser
+// screenshots on the daemon, so less has to travel to Prime and to the model.
+package handlers
+
+import (
+	"encoding/base64"
+	"os"
+
+	"github.com/ultron/daemon/internal/computer"
+)
+
+// screenshotDefaults apply when a command doesn't set max_dimension or
+// jpeg_quality itself.
+var screenshotDefaults computer.ImageOptions
+
+// SetScreenshotDefaults sets how screenshots are shrunk by default (see
+// DAEMON_SCREENSHOT_MAX_DIMENSION and DAEMON_SCREENSHOT_JPEG_QUALITY).
+func SetScreenshotDefaults(maxDimension, jpegQuality int) {
+	screenshotDefaults = computer.ImageOptions{MaxDimension: maxDimension, JPEGQuality: jpegQuality}
+}
+
+// screenshotOptions reads max_dimension and jpeg_quality from params over the
+// defaults; 0 turns either off for this command.
+func screenshotOptions(params map[string]interface{}) computer.ImageOptions {
+	opts := screenshotDefaults
+	if v, ok := params["max_dimension"].(float64); ok {
+		opts.MaxDimension = int(v)
+	}
+	if v, ok := params["jpeg_quality"].(float64); ok {
+		opts.JPEGQuality = int(v)
+	}
+	return opts
+}
+
+// shrinkScreenshot shrinks a base64 screenshot per opts and records the
+// result in resp: base64_image, media_type, and the size before and after.
+// On failure the screenshot is passed on as it was, with shrink_error.
+func shrinkScreenshot(b64 string, opts computer.ImageOptions, resp map[string]interface{}) {
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		resp["base64_image"] = b64
+		resp["shrink_error"] = err.Error()
+		return
+	}
+	if err := shrinkImageInto(data, opts, resp); err != nil {
+		resp["base64_image"] = b64
+		resp["shrink_error"] = err.Error()
+	}
+}
+
+// shrinkScreenshotFile adds the screenshot at path, shrunk per opts, to resp;
+// the file itself is left as it is.
+func shrinkScreenshotFile(path string, opts computer.ImageOptions, resp map[string]interface{}) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = shrinkImageInto(data, opts, resp)
+	}
+	if err != nil {
+		resp["shrink_error"] = err.Error()
+	}
+}
+
+func shrinkImageInto(data []byte, opts computer.ImageOptions, resp map[string]interface{}) error {
+	shrunk, info, err := computer.ShrinkImage(data, opts)
+	if err != nil {
+		return err
+	}
+	resp["base64_image"] = base64.StdEncoding.EncodeToString(shrunk)
+	resp["media_type"] = info.MediaType
+	resp["image_width"] = info.Width
+	resp["image_height"] = info.Height
+	if info.Width != info.OriginalWidth {
+		// Positions in the image scale by this to the original's
+		resp["image_scale"] = float64(info.OriginalWidth) / float64(info.Width)
+	}
+	resp["original_bytes"] = info.OriginalBytes
+	resp["image_bytes"] = info.Bytes
+	return nil
+}
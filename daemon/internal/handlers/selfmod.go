@@ -0,0 +1,190 @@
+// Self-modification handler - lets Prime edit, rebuild and restart the soul daemon.
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ultron/daemon/internal/executor"
+)
+
+const rebuildTimeout = 10 * time.Minute
+
+// restoreProgressInterval is the least time between restore_backup progress updates.
+const restoreProgressInterval = 250 * time.Millisecond
+
+var (
+	// selfMod is only set on the soul daemon; everywhere else self_modify refuses.
+	selfMod *executor.SelfModification
+	// daemonRoot mirrors selfMod's daemon directory so file paths can be
+	// checked before they're handed over.
+	daemonRoot string
+)
+
+// EnableSelfModify turns on self_modify for the soul daemon, operating on the
+// Ultron checkout at ultronRoot.
+func EnableSelfModify(ultronRoot string) {
+	selfMod = executor.NewSelfModification(ultronRoot)
+	daemonRoot = filepath.Join(ultronRoot, "daemon")
+}
+
+// daemonFilePath validates a path relative to the daemon source tree.
+func daemonFilePath(rel string) (string, error) {
+	if rel == "" {
+		return "", fmt.Errorf("file_path required")
+	}
+	if filepath.IsAbs(rel) {
+		return "", fmt.Errorf("file_path must be relative to the daemon source tree")
+	}
+	clean := filepath.Clean(rel)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file_path escapes the daemon source tree: %s", rel)
+	}
+	return filepath.Join(daemonRoot, clean), nil
+}
+
+// handleSelfModify dispatches on operation: modify_daemon, create_daemon_file,
+// restore_backup, rebuild_daemon or restart_daemon. Edits report the backup
+// they made so every change can be traced and rolled back.
+func handleSelfModify(params map[string]interface{}, stream StreamFunc) map[string]interface{} {
+	if selfMod == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "self_modify is only available on the soul daemon",
+		}
+	}
+
+	operation, _ := params["operation"].(string)
+	filePath, _ := params["file_path"].(string)
+
+	switch operation {
+	case "modify_daemon":
+		oldContent, _ := params["old_content"].(string)
+		newContent, _ := params["new_content"].(string)
+		if _, err := daemonFilePath(filePath); err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		if oldContent == "" {
+			return map[string]interface{}{"success": false, "error": "old_content required"}
+		}
+		backup, err := selfMod.ModifyDaemonCode(context.Background(), filePath, oldContent, newContent)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		return map[string]interface{}{
+			"success":     true,
+			"operation":   operation,
+			"file_path":   filePath,
+			"backup_path": backup,
+		}
+
+	case "create_daemon_file":
+		content, _ := params["content"].(string)
+		fullPath, err := daemonFilePath(filePath)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		// Overwriting an existing file gets the same backup as an edit
+		backup := ""
+		if _, err := os.Stat(fullPath); err == nil {
+			if backup, err = selfMod.BackupFile(fullPath); err != nil {
+				return map[string]interface{}{"success": false, "error": fmt.Sprintf("backup failed: %v", err)}
+			}
+		}
+		if err := selfMod.CreateDaemonFile(context.Background(), filePath, content); err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		result := map[string]interface{}{
+			"success":   true,
+			"operation": operation,
+			"file_path": filePath,
+		}
+		if backup != "" {
+			result["backup_path"] = backup
+		}
+		return result
+
+	case "restore_backup":
+		// Copies a backup (a directory name under the backup dir, as in a
+		// backup_path) back into the daemon tree, streaming progress
+		backupName, _ := params["backup_name"].(string)
+		if backupName == "" {
+			return map[string]interface{}{"success": false, "error": "backup_name required"}
+		}
+		if filePath == "" {
+			filePath = "."
+		}
+		target, err := daemonFilePath(filePath)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		var last executor.RestoreProgress
+		var lastSent time.Time
+		err = selfMod.RestoreBackupProgress(context.Background(), backupName, target, func(p executor.RestoreProgress) {
+			last = p
+			if p.FilesDone < p.FilesTotal && time.Since(lastSent) < restoreProgressInterval {
+				return
+			}
+			lastSent = time.Now()
+			// Progress is best effort; callers that can't stream just get the result
+			stream(map[string]interface{}{
+				"files_done":  p.FilesDone,
+				"files_total": p.FilesTotal,
+				"bytes_done":  p.BytesDone,
+				"bytes_total": p.BytesTotal,
+			})
+		})
+		result := map[string]interface{}{
+			"success":        err == nil,
+			"operation":      operation,
+			"backup_name":    backupName,
+			"file_path":      filePath,
+			"files_restored": last.FilesDone,
+			"bytes_restored": last.BytesDone,
+		}
+		if err != nil {
+			result["error"] = err.Error()
+		}
+		return result
+
+	case "rebuild_daemon":
+		ctx, cancel := context.WithTimeout(context.Background(), rebuildTimeout)
+		defer cancel()
+		res, err := selfMod.RebuildDaemon(ctx)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		result := map[string]interface{}{
+			"success":   res.ExitCode == 0,
+			"operation": operation,
+			"stdout":    res.Stdout,
+			"stderr":    res.Stderr,
+			"exit_code": res.ExitCode,
+		}
+		if res.ExitCode != 0 {
+			result["error"] = "build failed"
+		}
+		return result
+
+	case "restart_daemon":
+		// Exits this process about a second from now, after the result is sent
+		if err := selfMod.RestartDaemon(context.Background()); err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		return map[string]interface{}{
+			"success":   true,
+			"operation": operation,
+			"message":   "daemon restarting",
+		}
+
+	default:
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("unknown self_modify operation: %q (want modify_daemon, create_daemon_file, rebuild_daemon or restart_daemon)", operation),
+		}
+	}
+}
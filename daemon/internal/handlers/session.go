@@ -0,0 +1,211 @@
+// Session handlers - persistent tmux sessions for long-running work.
+package handlers
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ultron/daemon/internal/executor"
+	"github.com/ultron/daemon/internal/redact"
+	"github.com/ultron/daemon/internal/session"
+)
+
+func sessionInfo(s *session.Session) map[string]interface{} {
+	return map[string]interface{}{
+		"session_id":  s.ID,
+		"name":        s.Name,
+		"command":     s.Command,
+		"working_dir": s.WorkingDir,
+		"created_at":  s.CreatedAt,
+		"running":     s.IsRunning,
+	}
+}
+
+// handleSession manages tmux sessions. action is one of create, list, send,
+// broadcast (send to every running session, optionally filtered by
+// name_prefix), output (the last lines of the session's log), wait_for
+// (block until output matches pattern), kill, env (show a session's
+// environment) or set_env.
+func handleSession(params map[string]interface{}) map[string]interface{} {
+	action, _ := params["action"].(string)
+	sessionID, _ := params["session_id"].(string)
+
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return map[string]interface{}{"success": false, "error": "tmux not found"}
+	}
+
+	switch action {
+	case "create":
+		name, _ := params["name"].(string)
+		command, _ := params["command"].(string)
+		workDir, _ := params["working_directory"].(string)
+		if name == "" {
+			name = "session"
+		}
+		env, err := parseEnv(params["env"])
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		s, err := session.DefaultManager.Create(name, command, workDir, env)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		result := sessionInfo(s)
+		result["success"] = true
+		return result
+
+	case "list":
+		sessions := session.DefaultManager.List()
+		list := make([]map[string]interface{}, 0, len(sessions))
+		for _, s := range sessions {
+			list = append(list, sessionInfo(s))
+		}
+		return map[string]interface{}{"success": true, "sessions": list, "count": len(list)}
+
+	case "send":
+		command, _ := params["command"].(string)
+		if command == "" {
+			return map[string]interface{}{"success": false, "error": "no command provided"}
+		}
+		if err := session.DefaultManager.SendCommand(sessionID, command); err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		return map[string]interface{}{"success": true, "session_id": sessionID}
+
+	case "broadcast":
+		command, _ := params["command"].(string)
+		prefix, _ := params["name_prefix"].(string)
+		if command == "" {
+			return map[string]interface{}{"success": false, "error": "no command provided"}
+		}
+		results := session.DefaultManager.BroadcastCommand(command, prefix)
+		failed := 0
+		for _, r := range results {
+			if !r.Success {
+				failed++
+			}
+		}
+		result := map[string]interface{}{
+			"success":  failed == 0,
+			"results":  results,
+			"sessions": len(results),
+			"failed":   failed,
+		}
+		if failed > 0 {
+			result["error"] = fmt.Sprintf("command failed in %d of %d sessions", failed, len(results))
+		}
+		return result
+
+	case "output":
+		lines, _ := params["lines"].(float64)
+		if lines <= 0 {
+			lines = 100
+		}
+		tail, err := session.DefaultManager.Tail(sessionID, int(lines))
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		for i, line := range tail {
+			tail[i] = redact.String(line)
+		}
+		return map[string]interface{}{
+			"success":    true,
+			"session_id": sessionID,
+			"output":     strings.Join(tail, "\n"),
+			"lines":      len(tail),
+		}
+
+	case "wait_for":
+		pattern, _ := params["pattern"].(string)
+		timeout, _ := params["timeout"].(float64)
+		if pattern == "" {
+			return map[string]interface{}{"success": false, "error": "no pattern provided"}
+		}
+		if timeout <= 0 {
+			timeout = 60
+		}
+		start := time.Now()
+		line, err := session.DefaultManager.WaitForOutput(sessionID, pattern, time.Duration(timeout*float64(time.Second)))
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error(), "session_id": sessionID}
+		}
+		return map[string]interface{}{
+			"success":    true,
+			"session_id": sessionID,
+			"line":       line,
+			"waited_ms":  time.Since(start).Milliseconds(),
+		}
+
+	case "kill":
+		if err := session.DefaultManager.Kill(sessionID); err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		return map[string]interface{}{"success": true, "session_id": sessionID}
+
+	case "env":
+		env, err := session.DefaultManager.Environment(sessionID)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		redacted, _ := executor.RedactEnv(env)
+		return map[string]interface{}{"success": true, "session_id": sessionID, "env": redacted}
+
+	case "set_env":
+		set, err := parseEnv(params["env"])
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		var unset []string
+		if list, ok := params["unset"].([]interface{}); ok {
+			for _, k := range list {
+				if s, ok := k.(string); ok {
+					unset = append(unset, s)
+				}
+			}
+		}
+		if err := session.DefaultManager.SetEnvironment(sessionID, set, unset); err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		return map[string]interface{}{
+			"success":    true,
+			"session_id": sessionID,
+			"note":       "applies to windows created from now on; the running shell is unchanged",
+		}
+
+	default:
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("unknown session action: %q (want create, list, send, broadcast, output, wait_for, kill, env or set_env)", action),
+		}
+	}
+}
+
+// handleSessionHistory returns the commands sent to a session, oldest first.
+func handleSessionHistory(params map[string]interface{}) map[string]interface{} {
+	sessionID, _ := params["session_id"].(string)
+	limit, _ := params["limit"].(float64)
+	if sessionID == "" {
+		return map[string]interface{}{"success": false, "error": "session_id required"}
+	}
+
+	history, err := session.DefaultManager.History(sessionID)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	if limit > 0 && int(limit) < len(history) {
+		history = history[len(history)-int(limit):]
+	}
+	// Commands can carry credentials
+	for i := range history {
+		history[i].Command = redact.String(history[i].Command)
+	}
+
+	return map[string]interface{}{
+		"success":    true,
+		"session_id": sessionID,
+		"history":    history,
+		"count":      len(history),
+	}
+}
@@ -0,0 +1,88 @@
+// Stream batching - groups many small partial results into fewer messages.
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// Batching defaults, overridable with SetStreamBatching.
+var (
+	streamBatchBytes    = 4096
+	streamFlushInterval = 100 * time.Millisecond
+)
+
+// SetStreamBatching configures how partial results are batched: a batch is
+// flushed once it holds maxBytes of data or flushInterval has passed since
+// its first item, whichever comes first.
+func SetStreamBatching(maxBytes int, flushInterval time.Duration) {
+	if maxBytes > 0 {
+		streamBatchBytes = maxBytes
+	}
+	if flushInterval > 0 {
+		streamFlushInterval = flushInterval
+	}
+}
+
+// streamBatcher accumulates items and sends them as {field: [items...]}.
+type streamBatcher struct {
+	stream StreamFunc
+	field  string
+	mu     sync.Mutex
+	items  []interface{}
+	size   int
+	timer  *time.Timer
+	err    error
+}
+
+func newStreamBatcher(stream StreamFunc, field string) *streamBatcher {
+	return &streamBatcher{stream: stream, field: field}
+}
+
+// Add queues an item of roughly size bytes. It returns the first error the
+// stream reported, so callers can stop producing once Prime is gone.
+func (b *streamBatcher) Add(item interface{}, size int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.err != nil {
+		return b.err
+	}
+
+	b.items = append(b.items, item)
+	b.size += size
+
+	if b.size >= streamBatchBytes {
+		return b.flushLocked()
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(streamFlushInterval, func() {
+			b.Flush()
+		})
+	}
+	return nil
+}
+
+// Flush sends any queued items immediately.
+func (b *streamBatcher) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked()
+}
+
+func (b *streamBatcher) flushLocked() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.err != nil || len(b.items) == 0 {
+		return b.err
+	}
+
+	items := b.items
+	b.items = nil
+	b.size = 0
+
+	b.err = b.stream(map[string]interface{}{b.field: items})
+	return b.err
+}
@@ -0,0 +1,246 @@
+// Systemd unit installer - writes .service files and registers them with systemd.
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// systemdUnitDir is where install_service writes unit files.
+const systemdUnitDir = "/etc/systemd/system"
+
+var validUnitName = regexp.MustCompile(`^[a-zA-Z0-9:_.@-]+$`)
+
+var validEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var validRestartPolicies = map[string]bool{
+	"no": true, "always": true, "on-success": true, "on-failure": true,
+	"on-abnormal": true, "on-abort": true, "on-watchdog": true,
+}
+
+func handleInstallService(params map[string]interface{}) map[string]interface{} {
+	name, _ := params["name"].(string)
+	execStart, _ := params["exec_start"].(string)
+	description, _ := params["description"].(string)
+	user, _ := params["user"].(string)
+	workDir, _ := params["working_directory"].(string)
+	restart, _ := params["restart"].(string)
+	env, _ := params["environment"].(map[string]interface{})
+	enable, _ := params["enable"].(bool)
+	start, _ := params["start"].(bool)
+
+	if name == "" || execStart == "" {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "name and exec_start are required",
+		}
+	}
+
+	name = strings.TrimSuffix(name, ".service")
+	if !validUnitName.MatchString(name) {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("invalid unit name: %s", name),
+		}
+	}
+
+	if restart == "" {
+		restart = "on-failure"
+	}
+	if !validRestartPolicies[restart] {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("invalid restart policy: %s", restart),
+		}
+	}
+
+	// A newline would start a new directive (a second ExecStart, User=root)
+	fields := map[string]string{
+		"description":       description,
+		"exec_start":        execStart,
+		"user":              user,
+		"working_directory": workDir,
+	}
+	for k, v := range env {
+		if !validEnvName.MatchString(k) {
+			return map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("invalid environment variable name: %q", k),
+			}
+		}
+		fields["environment "+k] = fmt.Sprint(v)
+	}
+	for field, value := range fields {
+		if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("%s contains a control character", field),
+			}
+		}
+	}
+
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   "systemctl not found (install_service requires systemd)",
+		}
+	}
+
+	unitName := name + ".service"
+	unitPath := filepath.Join(systemdUnitDir, unitName)
+	unit := renderUnit(description, execStart, user, workDir, restart, env)
+
+	// Back up any existing unit so we can roll back
+	previous, readErr := os.ReadFile(unitPath)
+	hadPrevious := readErr == nil
+	backupPath := ""
+	if hadPrevious {
+		backupPath = fmt.Sprintf("%s.bak-%s", unitPath, time.Now().Format("20060102-150405"))
+		if err := writeSystemFile(backupPath, previous); err != nil {
+			return map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("failed to back up existing unit: %v", err),
+			}
+		}
+	}
+
+	rollback := func() {
+		if hadPrevious {
+			writeSystemFile(unitPath, previous)
+		} else {
+			asRoot("rm", "-f", unitPath).Run()
+		}
+		runSystemctl("daemon-reload")
+	}
+
+	if err := writeSystemFile(unitPath, []byte(unit)); err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("failed to write unit file: %v", err),
+		}
+	}
+
+	steps := [][]string{{"daemon-reload"}}
+	if enable {
+		steps = append(steps, []string{"enable", unitName})
+	}
+	if start {
+		steps = append(steps, []string{"restart", unitName})
+	}
+
+	var outputs []string
+	for _, step := range steps {
+		output, err := runSystemctl(step...)
+		outputs = append(outputs, output)
+		if err != nil {
+			rollback()
+			return map[string]interface{}{
+				"success":     false,
+				"error":       fmt.Sprintf("systemctl %s failed: %v", strings.Join(step, " "), err),
+				"output":      strings.Join(outputs, ""),
+				"rolled_back": true,
+			}
+		}
+	}
+
+	result := map[string]interface{}{
+		"success":   true,
+		"unit":      unitName,
+		"unit_path": unitPath,
+		"content":   unit,
+		"enabled":   enable,
+		"started":   start,
+		"output":    strings.Join(outputs, ""),
+	}
+	if backupPath != "" {
+		result["backup_path"] = backupPath
+	}
+	return result
+}
+
+// renderUnit builds the contents of a simple .service unit file. Values have
+// been checked for control characters, so each stays on its own line.
+func renderUnit(description, execStart, user, workDir, restart string, env map[string]interface{}) string {
+	if description == "" {
+		description = execStart
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", strings.ReplaceAll(description, "%", "%%"))
+	b.WriteString("After=network.target\n\n")
+
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", execStart)
+	if user != "" {
+		fmt.Fprintf(&b, "User=%s\n", user)
+	}
+	if workDir != "" {
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", workDir)
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "Environment=%s\n", quoteSystemd(fmt.Sprintf("%s=%v", k, env[k])))
+	}
+	fmt.Fprintf(&b, "Restart=%s\n\n", restart)
+
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+	return b.String()
+}
+
+// quoteSystemd double-quotes s as systemd.exec expects for Environment=:
+// backslashes and quotes are escaped, and % is doubled so it isn't taken
+// for a specifier.
+func quoteSystemd(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "%", "%%")
+	return `"` + s + `"`
+}
+
+// asRoot returns a command that runs as root: directly when the daemon is
+// root, otherwise through sudo. Every privileged step of install_service
+// goes through it, so they all need the same access.
+func asRoot(name string, args ...string) *exec.Cmd {
+	if os.Geteuid() == 0 {
+		return exec.Command(name, args...)
+	}
+	return exec.Command("sudo", append([]string{"-n", name}, args...)...)
+}
+
+// writeSystemFile writes data to a root-owned path, mode 0644.
+func writeSystemFile(path string, data []byte) error {
+	cmd := asRoot("install", "-m", "0644", "/dev/stdin", path)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = io.Discard
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// runSystemctl runs systemctl as root.
+func runSystemctl(args ...string) (string, error) {
+	output, err := asRoot("systemctl", args...).CombinedOutput()
+	return string(output), err
+}
@@ -0,0 +1,310 @@
+// Route tracing - traceroute to Prime, for pinpointing where the path from
+// this daemon breaks or slows down.
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// primeAddress is where trace_prime traces to.
+var primeAddress string
+
+// SetPrimeAddress sets the Prime host:port trace_prime traces to.
+func SetPrimeAddress(addr string) {
+	primeAddress = addr
+}
+
+// trace_prime defaults
+const (
+	traceMaxHops = 30
+	traceQueries = 3 // Probes per hop
+	traceWait    = time.Second
+)
+
+// TraceHop is one hop of a traced route.
+type TraceHop struct {
+	Hop         int       `json:"hop"`
+	Address     string    `json:"address,omitempty"` // Empty if no probe was answered
+	RTTs        []float64 `json:"rtt_ms"`            // One per answered probe
+	Lost        int       `json:"lost"`
+	Unreachable bool      `json:"unreachable,omitempty"` // The hop reported the destination unreachable
+}
+
+// errTraceNeedsPrivileges means raw ICMP sockets aren't available to us.
+var errTraceNeedsPrivileges = errors.New("raw ICMP socket unavailable")
+
+// handleTracePrime traces the route to Prime's host with increasing-TTL ICMP
+// echo probes. Raw sockets need root (or CAP_NET_RAW); without them it falls
+// back to the system traceroute (tracert on Windows).
+func handleTracePrime(params map[string]interface{}) map[string]interface{} {
+	maxHops, _ := params["max_hops"].(float64)
+	queries, _ := params["queries"].(float64)
+	wait, _ := params["wait"].(float64)
+
+	if primeAddress == "" {
+		return map[string]interface{}{"success": false, "error": "Prime address not configured"}
+	}
+	host, _, err := net.SplitHostPort(primeAddress)
+	if err != nil {
+		host = primeAddress
+	}
+	if maxHops <= 0 || maxHops > 64 {
+		maxHops = traceMaxHops
+	}
+	if queries <= 0 || queries > 10 {
+		queries = traceQueries
+	}
+	probeWait := traceWait
+	if wait > 0 {
+		probeWait = time.Duration(wait * float64(time.Second))
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": fmt.Sprintf("resolve %s: %v", host, err)}
+	}
+	var target net.IP
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			target = ip4
+			break
+		}
+	}
+
+	result := map[string]interface{}{"target": host}
+	var hops []TraceHop
+	var reached bool
+	if target != nil {
+		result["address"] = target.String()
+		hops, reached, err = traceICMP(target, int(maxHops), int(queries), probeWait)
+		result["method"] = "icmp"
+	}
+	if target == nil || errors.Is(err, errTraceNeedsPrivileges) {
+		// No IPv4 address or no raw sockets: let the system tool do it
+		icmpErr := err
+		var output string
+		hops, reached, output, err = traceCommand(host, int(maxHops), int(queries), probeWait)
+		result["method"] = "command"
+		result["output"] = output
+		if err != nil && icmpErr != nil {
+			err = fmt.Errorf("%v (run the daemon as root or grant CAP_NET_RAW); %v", icmpErr, err)
+		}
+	}
+	if err != nil {
+		result["success"] = false
+		result["error"] = err.Error()
+		return result
+	}
+
+	result["success"] = true
+	result["hops"] = hops
+	result["reached"] = reached
+	return result
+}
+
+// traceICMP sends queries echo requests per TTL from 1 until target answers
+// or maxHops is reached.
+func traceICMP(target net.IP, maxHops, queries int, wait time.Duration) ([]TraceHop, bool, error) {
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", errTraceNeedsPrivileges, err)
+	}
+	defer conn.Close()
+	pconn := conn.IPv4PacketConn()
+
+	// Raw sockets see every ICMP packet on the host; the ID tells ours apart
+	id := rand.Intn(0xffff) + 1
+	seq := 0
+	buf := make([]byte, 1500)
+
+	var hops []TraceHop
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		if err := pconn.SetTTL(ttl); err != nil {
+			return hops, false, err
+		}
+		hop := TraceHop{Hop: ttl, RTTs: []float64{}}
+		reached := false
+		for q := 0; q < queries; q++ {
+			seq++
+			msg := icmp.Message{
+				Type: ipv4.ICMPTypeEcho,
+				Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("ultron-trace")},
+			}
+			packet, err := msg.Marshal(nil)
+			if err != nil {
+				return hops, false, err
+			}
+			start := time.Now()
+			if _, err := conn.WriteTo(packet, &net.IPAddr{IP: target}); err != nil {
+				return hops, false, err
+			}
+
+			peer, kind := awaitTraceReply(conn, buf, id, seq, start.Add(wait))
+			if peer == "" {
+				hop.Lost++
+				continue
+			}
+			hop.Address = peer
+			hop.RTTs = append(hop.RTTs, float64(time.Since(start).Microseconds())/1000)
+			switch kind {
+			case ipv4.ICMPTypeEchoReply:
+				reached = true
+			case ipv4.ICMPTypeDestinationUnreachable:
+				hop.Unreachable = true
+			}
+		}
+		hops = append(hops, hop)
+		if reached || hop.Unreachable {
+			return hops, reached, nil
+		}
+	}
+	return hops, false, nil
+}
+
+// awaitTraceReply reads until the reply to probe id/seq arrives or deadline
+// passes, returning who answered and how ("" on timeout).
+func awaitTraceReply(conn *icmp.PacketConn, buf []byte, id, seq int, deadline time.Time) (string, ipv4.ICMPType) {
+	conn.SetReadDeadline(deadline)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", 0
+		}
+		msg, err := icmp.ParseMessage(ipv4.ICMPTypeEcho.Protocol(), buf[:n])
+		if err != nil {
+			continue
+		}
+		switch body := msg.Body.(type) {
+		case *icmp.Echo:
+			if msg.Type == ipv4.ICMPTypeEchoReply && body.ID == id && body.Seq == seq {
+				return peerIP(peer), ipv4.ICMPTypeEchoReply
+			}
+		case *icmp.TimeExceeded:
+			if quotesProbe(body.Data, id, seq) {
+				return peerIP(peer), ipv4.ICMPTypeTimeExceeded
+			}
+		case *icmp.DstUnreach:
+			if quotesProbe(body.Data, id, seq) {
+				return peerIP(peer), ipv4.ICMPTypeDestinationUnreachable
+			}
+		}
+	}
+}
+
+// quotesProbe reports whether an ICMP error quotes our echo request: its
+// data is the original IP header followed by the first 8 bytes of the echo.
+func quotesProbe(data []byte, id, seq int) bool {
+	header, err := ipv4.ParseHeader(data)
+	if err != nil || len(data) < header.Len+8 {
+		return false
+	}
+	echo := data[header.Len:]
+	return echo[0] == byte(ipv4.ICMPTypeEcho) &&
+		int(echo[4])<<8|int(echo[5]) == id &&
+		int(echo[6])<<8|int(echo[7]) == seq
+}
+
+func peerIP(addr net.Addr) string {
+	if ip, ok := addr.(*net.IPAddr); ok {
+		return ip.IP.String()
+	}
+	return addr.String()
+}
+
+// traceCommand runs traceroute (tracert on Windows) and parses its hops.
+func traceCommand(host string, maxHops, queries int, wait time.Duration) ([]TraceHop, bool, string, error) {
+	var name string
+	var args []string
+	if runtime.GOOS == "windows" {
+		name = "tracert"
+		args = []string{"-d", "-h", strconv.Itoa(maxHops), "-w", strconv.Itoa(int(wait.Milliseconds())), host}
+	} else {
+		name = "traceroute"
+		args = []string{"-n", "-m", strconv.Itoa(maxHops), "-q", strconv.Itoa(queries), "-w", strconv.Itoa(int(wait.Seconds() + 0.5)), host}
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, false, "", fmt.Errorf("%s not found", name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(maxHops*queries)*wait+30*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	output := string(out)
+	hops := parseTraceOutput(output)
+	if err != nil && len(hops) == 0 {
+		return nil, false, output, fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	reached := false
+	if len(hops) > 0 {
+		last := hops[len(hops)-1].Address
+		for _, ip := range lookupAddrs(host) {
+			if ip == last {
+				reached = true
+			}
+		}
+	}
+	return hops, reached, output, nil
+}
+
+// parseTraceOutput reads hop lines from traceroute or tracert output, e.g.
+// " 3  10.0.0.1  1.234 ms  1.100 ms *" or "  3    <1 ms    2 ms     *     10.0.0.1".
+func parseTraceOutput(output string) []TraceHop {
+	var hops []TraceHop
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		hop := TraceHop{Hop: n, RTTs: []float64{}}
+		for i, f := range fields[1:] {
+			switch {
+			case f == "*":
+				hop.Lost++
+			case f == "ms":
+			case net.ParseIP(strings.Trim(f, "()[]")) != nil:
+				if hop.Address == "" {
+					hop.Address = strings.Trim(f, "()[]")
+				}
+			case strings.HasPrefix(f, "!"):
+				hop.Unreachable = true // traceroute's !H, !N, ...
+			default:
+				// A latency is a number followed by "ms" (tracert writes "<1")
+				next := ""
+				if i+2 < len(fields) {
+					next = fields[i+2]
+				}
+				v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(f, "<"), "ms"), 64)
+				if err == nil && (next == "ms" || strings.HasSuffix(f, "ms")) {
+					hop.RTTs = append(hop.RTTs, v)
+				}
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+func lookupAddrs(host string) []string {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}
+	}
+	addrs, _ := net.LookupHost(host)
+	return addrs
+}
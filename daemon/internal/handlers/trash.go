@@ -0,0 +1,238 @@
+// Trash handlers - recoverable deletes. delete_file moves things here instead
+// of removing them (by default for recursive deletes), with a manifest
+// recording where each came from so it can be put back.
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ultron/daemon/internal/executor"
+)
+
+var (
+	trashDir = "trash"
+	trashMu  sync.Mutex
+)
+
+// SetTrashDir sets where deleted files are quarantined.
+func SetTrashDir(dir string) {
+	if dir != "" {
+		trashDir = dir
+	}
+}
+
+// Each trash entry is a directory named by its ID holding the manifest and
+// the trashed file or directory itself.
+const (
+	trashManifest = "manifest.json"
+	trashItem     = "item"
+)
+
+// TrashEntry is one trashed file or directory.
+type TrashEntry struct {
+	ID           string    `json:"trash_id"`
+	OriginalPath string    `json:"original_path"`
+	TrashedAt    time.Time `json:"trashed_at"`
+	IsDir        bool      `json:"is_dir"`
+}
+
+// useTrash reports whether a delete should go to the trash: recursive deletes
+// do unless trash is explicitly false, others only when it is true.
+func useTrash(params map[string]interface{}, recursive bool) bool {
+	if trash, ok := params["trash"].(bool); ok {
+		return trash
+	}
+	return recursive
+}
+
+// moveToTrash moves current into a new trash entry, recording original as
+// where it came from (they differ when a bulk delete has moved it aside).
+func moveToTrash(original, current string) (*TrashEntry, error) {
+	info, err := os.Lstat(current)
+	if err != nil {
+		return nil, err
+	}
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	if err := os.MkdirAll(trashDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create trash dir: %w", err)
+	}
+	now := time.Now()
+	id := now.Format(backupIDFormat)
+	dir := filepath.Join(trashDir, id)
+	for n := 1; ; n++ {
+		err := os.Mkdir(dir, 0700)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create trash entry: %w", err)
+		}
+		id = fmt.Sprintf("%s-%d", now.Format(backupIDFormat), n)
+		dir = filepath.Join(trashDir, id)
+	}
+
+	entry := &TrashEntry{ID: id, OriginalPath: original, TrashedAt: now, IsDir: info.IsDir()}
+	manifest, _ := json.MarshalIndent(entry, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, trashManifest), manifest, 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to write trash manifest: %w", err)
+	}
+	if err := executor.DefaultExecutor.MoveFile(current, filepath.Join(dir, trashItem), false); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to move to trash: %w", err)
+	}
+	return entry, nil
+}
+
+// readTrashEntry loads the manifest of trash entry id.
+func readTrashEntry(id string) (*TrashEntry, error) {
+	if id == "" || id == "." || id == ".." || filepath.Base(id) != id {
+		return nil, fmt.Errorf("invalid trash_id: %s", id)
+	}
+	data, err := os.ReadFile(filepath.Join(trashDir, id, trashManifest))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("trash entry %s not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry TrashEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("corrupt manifest for %s: %w", id, err)
+	}
+	entry.ID = id
+	return &entry, nil
+}
+
+// listTrash returns every trash entry, newest first.
+func listTrash() ([]TrashEntry, error) {
+	dirs, err := os.ReadDir(trashDir)
+	if os.IsNotExist(err) {
+		return []TrashEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]TrashEntry, 0, len(dirs))
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		if entry, err := readTrashEntry(d.Name()); err == nil {
+			entries = append(entries, *entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	return entries, nil
+}
+
+func handleListTrash(params map[string]interface{}) map[string]interface{} {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	entries, err := listTrash()
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	return map[string]interface{}{"success": true, "entries": entries, "count": len(entries)}
+}
+
+// handleRestoreFromTrash moves trash entry trash_id back to its original
+// path, or to path if given. It never overwrites: the destination must not
+// exist.
+func handleRestoreFromTrash(params map[string]interface{}) map[string]interface{} {
+	id, _ := params["trash_id"].(string)
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	entry, err := readTrashEntry(id)
+	if err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	dest := entry.OriginalPath
+	if p, _ := params["path"].(string); p != "" {
+		if dest, err = absPath(p); err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("%s already exists; restore to another path or remove it first", dest),
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	dir := filepath.Join(trashDir, id)
+	if err := executor.DefaultExecutor.MoveFile(filepath.Join(dir, trashItem), dest, false); err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error()}
+	}
+	os.RemoveAll(dir)
+	return map[string]interface{}{
+		"success":       true,
+		"trash_id":      id,
+		"path":          dest,
+		"original_path": entry.OriginalPath,
+	}
+}
+
+// handleEmptyTrash permanently removes trash_id, or every entry trashed more
+// than older_than seconds ago, or (with neither) the whole trash.
+func handleEmptyTrash(params map[string]interface{}) map[string]interface{} {
+	id, _ := params["trash_id"].(string)
+	olderThan, _ := params["older_than"].(float64)
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	var targets []TrashEntry
+	if id != "" {
+		entry, err := readTrashEntry(id)
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		targets = []TrashEntry{*entry}
+	} else {
+		entries, err := listTrash()
+		if err != nil {
+			return map[string]interface{}{"success": false, "error": err.Error()}
+		}
+		cutoff := time.Now().Add(-time.Duration(olderThan * float64(time.Second)))
+		for _, e := range entries {
+			if olderThan <= 0 || e.TrashedAt.Before(cutoff) {
+				targets = append(targets, e)
+			}
+		}
+	}
+
+	removed := []string{}
+	var failed []string
+	for _, e := range targets {
+		if err := os.RemoveAll(filepath.Join(trashDir, e.ID)); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", e.ID, err))
+			continue
+		}
+		removed = append(removed, e.ID)
+	}
+	result := map[string]interface{}{
+		"success": len(failed) == 0,
+		"removed": removed,
+		"count":   len(removed),
+	}
+	if len(failed) > 0 {
+		result["error"] = fmt.Sprintf("failed to remove %d entries: %v", len(failed), failed)
+	}
+	return result
+}
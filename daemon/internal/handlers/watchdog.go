@@ -0,0 +1,99 @@
+// Watchdog - caps how long the caller waits on a handler, whatever it does.
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ultron/daemon/internal/crash"
+)
+
+// watchdogGrace is added to a command's own timeout or duration so the
+// handler gets to report its own timeout before the watchdog fires.
+const watchdogGrace = 30 * time.Second
+
+// Handler deadline, overridable with SetHandlerTimeout.
+var handlerTimeout = 10 * time.Minute
+
+// SetHandlerTimeout sets how long a handler may run before the registry
+// gives up on it. Commands asking for a longer timeout or duration get that
+// plus a grace period instead.
+func SetHandlerTimeout(d time.Duration) {
+	if d > 0 {
+		handlerTimeout = d
+	}
+}
+
+// watchdogDeadline picks the hard deadline for one handler call. Streaming
+// handlers without a timeout or duration run until Prime goes away, so they
+// get none.
+func watchdogDeadline(params map[string]interface{}, streaming bool) time.Duration {
+	requested := 0.0
+	for _, key := range []string{"timeout", "duration"} {
+		if v, ok := params[key].(float64); ok && v > requested {
+			requested = v
+		}
+	}
+	if requested == 0 {
+		if streaming {
+			return 0
+		}
+		return handlerTimeout
+	}
+	deadline := time.Duration(requested*float64(time.Second)) + watchdogGrace
+	if deadline < handlerTimeout {
+		deadline = handlerTimeout
+	}
+	return deadline
+}
+
+// runWithWatchdog runs handler in its own goroutine and returns a timeout
+// result if it hasn't finished within deadline. A Go routine can't be
+// killed, so a runaway handler is left to finish in the background; its
+// late partial results are discarded.
+func runWithWatchdog(cmdType string, deadline time.Duration, stream StreamFunc, handler StreamHandler, params map[string]interface{}) map[string]interface{} {
+	if deadline <= 0 {
+		return handler(params, stream)
+	}
+
+	var mu sync.Mutex
+	abandoned := false
+	guarded := func(chunk map[string]interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if abandoned {
+			return fmt.Errorf("%s timed out", cmdType)
+		}
+		return stream(chunk)
+	}
+
+	done := make(chan map[string]interface{}, 1)
+	start := time.Now()
+	go func() {
+		defer crash.Recover("handler " + cmdType)
+		done <- handler(params, guarded)
+		if elapsed := time.Since(start); elapsed > deadline {
+			slog.Warn("Runaway handler finished", "type", cmdType, "elapsed", elapsed.Round(time.Second))
+		}
+	}()
+
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+
+	select {
+	case result := <-done:
+		return result
+	case <-timer.C:
+		mu.Lock()
+		abandoned = true
+		mu.Unlock()
+		slog.Warn("Handler did not finish in time; returning timeout and leaving it running", "type", cmdType, "deadline", deadline)
+		return map[string]interface{}{
+			"success":   false,
+			"error":     fmt.Sprintf("handler %s did not finish within %v", cmdType, deadline),
+			"timed_out": true,
+		}
+	}
+}
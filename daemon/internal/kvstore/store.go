@@ -0,0 +1,141 @@
+// Package kvstore is a small persistent key-value store for daemon-local state
+// (counters, flags, last-run timestamps). Entries live in a single JSON file
+// that is rewritten atomically on every change.
+package kvstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a stored value with an optional expiry.
+type Entry struct {
+	Value     interface{} `json:"value"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+}
+
+func (e Entry) expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
+
+// Store is a JSON-file backed key-value store, safe for concurrent use.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// Open loads the store at path, creating an empty one if the file doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, entries: make(map[string]Entry)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kv store: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.entries); err != nil {
+			return nil, fmt.Errorf("failed to parse kv store %s: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+// Get returns the entry for key, if present and not expired.
+func (s *Store) Get(key string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.expired(time.Now()) {
+		return Entry{}, false
+	}
+	return e, true
+}
+
+// Set stores value under key. A ttl of 0 means the key never expires.
+func (s *Store) Set(key string, value interface{}, ttl time.Duration) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	e := Entry{Value: value, UpdatedAt: now}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		e.ExpiresAt = &expires
+	}
+	s.entries[key] = e
+	return e, s.saveLocked()
+}
+
+// Delete removes key, reporting whether it existed.
+func (s *Store) Delete(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return false, nil
+	}
+	delete(s.entries, key)
+	return !e.expired(time.Now()), s.saveLocked()
+}
+
+// List returns the live keys starting with prefix, sorted.
+func (s *Store) List(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.entries))
+	for k, e := range s.entries {
+		if strings.HasPrefix(k, prefix) && !e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// saveLocked drops expired entries and atomically rewrites the file.
+func (s *Store) saveLocked() error {
+	now := time.Now()
+	for k, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, k)
+		}
+	}
+
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".kv-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,190 @@
+// Package logging sets up the daemon's logger.
+// Records are written to stderr in the familiar log format and kept in an
+// in-memory ring buffer so Prime can fetch recent logs (see get_logs).
+// Existing log.Printf calls are routed through the same handler at Info, so
+// warnings, errors and debug detail must be logged with slog at their level.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCapacity is the number of records kept when Setup is given 0.
+const DefaultCapacity = 1000
+
+// Record is a captured log entry.
+type Record struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+
+	level slog.Level
+}
+
+// Ring is a fixed-size buffer of the most recent records.
+type Ring struct {
+	mu      sync.Mutex
+	records []Record
+	next    int
+	full    bool
+}
+
+func newRing(capacity int) *Ring {
+	return &Ring{records: make([]Record, capacity)}
+}
+
+func (r *Ring) add(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records[r.next] = rec
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// recent returns up to n records at or above minLevel, oldest first.
+func (r *Ring) recent(minLevel slog.Level, n int) []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ordered []Record
+	if r.full {
+		ordered = append(ordered, r.records[r.next:]...)
+	}
+	ordered = append(ordered, r.records[:r.next]...)
+
+	matched := make([]Record, 0, len(ordered))
+	for _, rec := range ordered {
+		if rec.level >= minLevel {
+			matched = append(matched, rec)
+		}
+	}
+	if n > 0 && len(matched) > n {
+		matched = matched[len(matched)-n:]
+	}
+	return matched
+}
+
+var (
+	ring  = newRing(DefaultCapacity)
+	level = new(slog.LevelVar) // Info by default; adjustable at runtime
+)
+
+// Setup installs the ring-buffered handler as the default slog and log output.
+func Setup(capacity int) {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	ring = newRing(capacity)
+
+	slog.SetDefault(slog.New(&handler{
+		out:  log.New(os.Stderr, "", log.LstdFlags),
+		ring: ring,
+	}))
+}
+
+// Recent returns up to n buffered records at or above minLevel, oldest first.
+func Recent(minLevel slog.Level, n int) []Record {
+	return ring.recent(minLevel, n)
+}
+
+// Level returns the current minimum log level.
+func Level() slog.Level {
+	return level.Level()
+}
+
+// SetLevel changes the minimum log level and returns the previous one.
+func SetLevel(l slog.Level) slog.Level {
+	previous := level.Level()
+	level.Set(l)
+	return previous
+}
+
+// ParseLevel converts a level name (debug, info, warn, error) to a slog.Level.
+func ParseLevel(name string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid log level: %q", name)
+	}
+	return l, nil
+}
+
+// handler writes records to the console and the ring buffer.
+type handler struct {
+	out    *log.Logger
+	ring   *Ring
+	attrs  []slog.Attr
+	prefix string
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	attrs := make(map[string]interface{})
+	for _, a := range h.attrs {
+		attrs[a.Key] = a.Value.Any()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[h.prefix+a.Key] = a.Value.Any()
+		return true
+	})
+
+	var line strings.Builder
+	if r.Level != slog.LevelInfo {
+		line.WriteString(r.Level.String() + " ")
+	}
+	line.WriteString(r.Message)
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&line, " %s=%v", k, attrs[k])
+	}
+	h.out.Print(line.String())
+
+	rec := Record{
+		Time:    r.Time.UTC(),
+		Level:   r.Level.String(),
+		Message: r.Message,
+		level:   r.Level,
+	}
+	if len(attrs) > 0 {
+		rec.Attrs = attrs
+	}
+	h.ring.add(rec)
+	return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		clone.attrs = append(clone.attrs, a)
+	}
+	return &clone
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
@@ -3,20 +3,26 @@
 package primeclient
 
 import (
-	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"os"
-	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ultron/daemon/internal/crash"
+	"github.com/ultron/daemon/internal/executor"
 	"github.com/ultron/daemon/internal/handlers"
+	"github.com/ultron/daemon/internal/redact"
 )
 
 // Client manages the bidirectional connection to Ultron Prime.
@@ -29,11 +35,53 @@ type Client struct {
 	capabilities    []string
 	isSoulDaemon    bool
 	ultronRoot      string
+	tlsConfig       *tls.Config  // nil dials plain TCP
+	macKey          []byte       // Signs and verifies every frame when set (see mac.go)
+	sourceAddr      *net.TCPAddr // Local address to dial Prime from (nil = OS choice)
+	wsURL           string       // Connect over WebSocket to this URL instead of TCP (see websocket.go)
+	proxy           *Proxy       // Proxy to reach Prime through (nil = direct); see proxy.go
 
 	// Connection state
 	conn     net.Conn
 	daemonID string
 	mu       sync.RWMutex
+	writeMu  sync.Mutex
+	mux      *muxWriter // Non-nil when Prime agreed to stream multiplexing
+
+	// MAC sequence numbers for this connection (see mac.go). frameMu keeps
+	// frames on the wire in sendSeq order; recvSeq is the message loop's.
+	frameMu sync.Mutex
+	sendSeq uint64
+	recvSeq uint64
+
+	// Prime agreed to receive partial_result frames for running commands
+	partialResults bool
+
+	// Shutdown: once draining, new commands are refused while running ones finish
+	draining atomic.Bool
+	running  sync.WaitGroup
+
+	// Bounds simultaneous commands (nil = unlimited); see admit
+	slots   chan struct{}
+	pending atomic.Int32 // Limited commands running or queued
+
+	// Port forwarding tunnels (see tunnel.go)
+	tunnels   map[string]*tunnel
+	tunnelsMu sync.Mutex
+
+	// Timeouts
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	// Message size limits
+	maxRecvBytes int
+	maxSendBytes int
+
+	// Liveness: TCP keepalive plus heartbeat acks from Prime
+	keepAlive        time.Duration
+	maxMissedAcks    int32
+	heartbeatAcked   atomic.Bool  // Prime has acked at least once, so misses count
+	missedHeartbeats atomic.Int32 // Heartbeats sent since the last ack
 
 	// Reconnection
 	reconnectDelay time.Duration
@@ -49,15 +97,41 @@ type Config struct {
 	Capabilities    []string
 	IsSoulDaemon    bool
 	UltronRoot      string
+	ReadTimeout     time.Duration // Read deadline per message (default 60s)
+	WriteTimeout    time.Duration // Write deadline per frame (default 30s)
+	KeepAlive       time.Duration // TCP keepalive probe interval (default 15s)
+	MaxMissedAcks   int           // Reconnect after this many unacked heartbeats (default 2)
+	MaxRecvBytes    int           // Largest message accepted from Prime (default 64MB)
+	MaxSendBytes    int           // Largest message sent to Prime (default 64MB)
+	MaxConcurrent   int           // Commands run at once; as many again may queue (0 = unlimited)
+	TLS             *tls.Config   // Verify Prime over TLS (nil = plain TCP, dev only); see LoadTLSConfig
+	MessageMAC      bool          // HMAC every frame with a key derived from RegistrationKey
+	SourceAddr      *net.TCPAddr  // Local address to dial Prime from (nil = OS choice); see ResolveSourceAddr
+	WebSocketURL    string        // Connect over WebSocket (ws:// or wss://) instead of raw TCP to PrimeAddress
+	Proxy           *Proxy        // HTTP or SOCKS5 proxy to reach Prime through (nil = direct); see LoadProxy
 }
 
+// DefaultMaxMessageBytes is the default limit on a single message in either direction.
+const DefaultMaxMessageBytes = 64 * 1024 * 1024
+
+// ErrMessageTooLarge is returned by sendMessage when a message exceeds MaxSendBytes.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// errPartialFrame is returned by readMessage when a read fails after part of
+// a frame has arrived. Unlike a timeout between frames it can't be retried:
+// the next read would take the rest of the frame for a length prefix.
+var errPartialFrame = errors.New("read failed mid-frame")
+
 // Core message types (protocol level)
 const (
 	TypeRegistration    = "registration"
 	TypeRegistrationAck = "registration_ack"
 	TypeHeartbeat       = "heartbeat"
+	TypeHeartbeatAck    = "heartbeat_ack"
 	TypeResult          = "result"
-	TypeEvent           = "event"  // For proactive events from daemon
+	TypePartialResult   = "partial_result" // Incremental output for a running command
+	TypeEvent           = "event"          // For proactive events from daemon
+	TypeStatus          = "status"         // Daemon lifecycle changes, e.g. draining on shutdown
 	TypePing            = "ping"
 )
 
@@ -79,6 +153,49 @@ func NewClient(cfg Config) *Client {
 		hostname, _ = os.Hostname()
 	}
 
+	readTimeout := cfg.ReadTimeout
+	if readTimeout <= 0 {
+		readTimeout = 60 * time.Second
+	}
+	writeTimeout := cfg.WriteTimeout
+	if writeTimeout <= 0 {
+		writeTimeout = 30 * time.Second
+	}
+	keepAlive := cfg.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = 15 * time.Second
+	}
+	maxMissedAcks := cfg.MaxMissedAcks
+	if maxMissedAcks <= 0 {
+		maxMissedAcks = 2
+	}
+	maxRecvBytes := cfg.MaxRecvBytes
+	if maxRecvBytes <= 0 {
+		maxRecvBytes = DefaultMaxMessageBytes
+	}
+	maxSendBytes := cfg.MaxSendBytes
+	if maxSendBytes <= 0 {
+		maxSendBytes = DefaultMaxMessageBytes
+	}
+
+	if cfg.WebSocketURL != "" {
+		if strings.HasPrefix(cfg.WebSocketURL, "ws://") {
+			slog.Warn("PRIME_WS_URL is ws://; commands, output and file contents travel in plaintext. Use wss:// outside development.")
+		}
+	} else if cfg.TLS == nil {
+		slog.Warn("TLS to Prime is disabled; commands, output and file contents travel in plaintext. Set PRIME_TLS=true outside development.")
+	}
+
+	var macKey []byte
+	if cfg.MessageMAC {
+		macKey = deriveMACKey(cfg.RegistrationKey)
+	}
+
+	var slots chan struct{}
+	if cfg.MaxConcurrent > 0 {
+		slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+
 	return &Client{
 		primeAddress:    cfg.PrimeAddress,
 		registrationKey: cfg.RegistrationKey,
@@ -87,6 +204,19 @@ func NewClient(cfg Config) *Client {
 		capabilities:    cfg.Capabilities,
 		isSoulDaemon:    cfg.IsSoulDaemon,
 		ultronRoot:      cfg.UltronRoot,
+		tlsConfig:       cfg.TLS,
+		sourceAddr:      cfg.SourceAddr,
+		wsURL:           cfg.WebSocketURL,
+		proxy:           cfg.Proxy,
+		macKey:          macKey,
+		tunnels:         make(map[string]*tunnel),
+		readTimeout:     readTimeout,
+		writeTimeout:    writeTimeout,
+		keepAlive:       keepAlive,
+		maxMissedAcks:   int32(maxMissedAcks),
+		maxRecvBytes:    maxRecvBytes,
+		maxSendBytes:    maxSendBytes,
+		slots:           slots,
 		reconnectDelay:  1 * time.Second,
 		maxReconnect:    60 * time.Second,
 	}
@@ -103,7 +233,7 @@ func (c *Client) Connect(ctx context.Context) error {
 
 		err := c.connectOnce(ctx)
 		if err != nil {
-			log.Printf("Connection error: %v", err)
+			slog.Error("Connection error", "error", err)
 		}
 
 		// Reconnect with backoff
@@ -122,22 +252,45 @@ func (c *Client) Connect(ctx context.Context) error {
 }
 
 func (c *Client) connectOnce(ctx context.Context) error {
-	log.Printf("Connecting to Prime at %s...", c.primeAddress)
+	if c.wsURL != "" {
+		log.Printf("Connecting to Prime at %s...", c.wsURL)
+	} else {
+		log.Printf("Connecting to Prime at %s...", c.primeAddress)
+	}
 
-	// Dial with context
-	var d net.Dialer
-	conn, err := d.DialContext(ctx, "tcp", c.primeAddress)
+	// Dial with context; TCP keepalive catches half-open connections at the OS level
+	var conn net.Conn
+	var err error
+	if c.wsURL != "" {
+		conn, err = c.dialWebSocket(ctx)
+	} else {
+		conn, err = c.dialPrime(ctx, c.primeAddress)
+	}
 	if err != nil {
 		return fmt.Errorf("dial failed: %w", err)
 	}
+	if c.tlsConfig != nil && c.wsURL == "" {
+		if conn, err = c.handshakeTLS(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	c.frameMu.Lock()
+	c.sendSeq, c.recvSeq = 0, 0
+	c.frameMu.Unlock()
 
 	c.mu.Lock()
 	c.conn = conn
 	c.mu.Unlock()
 
 	defer func() {
+		c.closeAllTunnels()
 		conn.Close()
 		c.mu.Lock()
+		if c.mux != nil {
+			c.mux.stop(fmt.Errorf("connection closed"))
+			c.mux = nil
+		}
 		c.conn = nil
 		c.mu.Unlock()
 	}()
@@ -153,6 +306,8 @@ func (c *Client) connectOnce(ctx context.Context) error {
 	}
 
 	// Start heartbeat goroutine
+	c.heartbeatAcked.Store(false)
+	c.missedHeartbeats.Store(0)
 	heartbeatCtx, cancelHeartbeat := context.WithCancel(ctx)
 	defer cancelHeartbeat()
 	go c.heartbeatLoop(heartbeatCtx)
@@ -161,6 +316,29 @@ func (c *Client) connectOnce(ctx context.Context) error {
 	return c.messageLoop(ctx)
 }
 
+// handshakeTLS wraps conn in TLS and verifies Prime's certificate. Without a
+// pinned server name, the certificate must match the host in PrimeAddress.
+func (c *Client) handshakeTLS(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	cfg := c.tlsConfig
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(c.primeAddress)
+		if err != nil {
+			host = c.primeAddress
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	state := tlsConn.ConnectionState()
+	log.Printf("TLS established with %s (%s)", cfg.ServerName, tls.VersionName(state.Version))
+	return tlsConn, nil
+}
+
 func (c *Client) sendRegistration() error {
 	msg := map[string]interface{}{
 		"type":             TypeRegistration,
@@ -170,6 +348,10 @@ func (c *Client) sendRegistration() error {
 		"capabilities":     c.capabilities,
 		"is_soul_daemon":   c.isSoulDaemon,
 		"ultron_root":      c.ultronRoot,
+		"multiplex":        true,
+		"partial_results":  true,
+		"max_concurrent":   cap(c.slots), // 0 = unlimited
+		"read_only":        handlers.ReadOnly(),
 	}
 
 	if err := c.sendMessage(msg); err != nil {
@@ -177,6 +359,7 @@ func (c *Client) sendRegistration() error {
 	}
 
 	// Wait for registration ack
+	c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
 	ack, err := c.readMessage()
 	if err != nil {
 		return fmt.Errorf("reading ack: %w", err)
@@ -194,11 +377,28 @@ func (c *Client) sendRegistration() error {
 		c.daemonID = id
 	}
 
+	// Prime opts in to multiplexed framing (see mux.go)
+	if multiplex, _ := ack["multiplex"].(bool); multiplex {
+		c.mu.Lock()
+		c.mux = newMuxWriter(c.conn, c.writeFrameWithDeadline)
+		c.mu.Unlock()
+		log.Printf("   Stream multiplexing enabled")
+	}
+
+	// Prime opts in to streamed results: partial_result frames tagged with
+	// command_id and seq, then the final result marked complete
+	if partial, _ := ack["partial_results"].(bool); partial {
+		c.partialResults = true
+		log.Printf("   Partial results enabled")
+	}
+
 	log.Printf("✓ Registered as %s (%s)", c.daemonID, c.name)
 	return nil
 }
 
 func (c *Client) heartbeatLoop(ctx context.Context) {
+	defer crash.Recover("heartbeat")
+
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
@@ -207,31 +407,37 @@ func (c *Client) heartbeatLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			// Only count misses once Prime has shown it sends acks
+			if c.heartbeatAcked.Load() && c.missedHeartbeats.Load() >= c.maxMissedAcks {
+				slog.Warn("No heartbeat ack from Prime, reconnecting", "missed", c.missedHeartbeats.Load())
+				c.mu.RLock()
+				if c.conn != nil {
+					c.conn.Close()
+				}
+				c.mu.RUnlock()
+				return
+			}
+			c.missedHeartbeats.Add(1)
 			c.sendHeartbeat()
 		}
 	}
 }
 
 func (c *Client) sendHeartbeat() {
-	// Collect system stats
-	var memPercent, cpuPercent, diskPercent float64
-
-	// Simple approximations (could use gopsutil for more accurate stats)
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	memPercent = float64(m.Alloc) / float64(m.Sys) * 100
+	stats := executor.GetHostStats()
 
 	msg := map[string]interface{}{
-		"type":           TypeHeartbeat,
-		"daemon_id":      c.daemonID,
-		"cpu_percent":    cpuPercent,
-		"memory_percent": memPercent,
-		"disk_percent":   diskPercent,
-		"active_tasks":   0,
+		"type":              TypeHeartbeat,
+		"daemon_id":         c.daemonID,
+		"cpu_percent":       stats.CPUPercent,
+		"memory_percent":    stats.MemoryPercent,
+		"disk_percent":      stats.DiskPercent,
+		"active_tasks":      handlers.ActiveTasks(),
+		"inflight_commands": executor.DefaultExecutor.InFlight(),
 	}
 
 	if err := c.sendMessage(msg); err != nil {
-		log.Printf("Heartbeat failed: %v", err)
+		slog.Error("Heartbeat failed", "error", err)
 	}
 }
 
@@ -244,7 +450,7 @@ func (c *Client) messageLoop(ctx context.Context) error {
 		}
 
 		// Set read deadline
-		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
 
 		msg, err := c.readMessage()
 		if err != nil {
@@ -252,18 +458,45 @@ func (c *Client) messageLoop(ctx context.Context) error {
 				return fmt.Errorf("connection closed")
 			}
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				// Read timeout, continue
+				// Read timeout between frames, continue
 				continue
 			}
 			return fmt.Errorf("read error: %w", err)
 		}
 
+		if msgType, _ := msg["type"].(string); msgType == TypeHeartbeatAck {
+			c.heartbeatAcked.Store(true)
+			c.missedHeartbeats.Store(0)
+			continue
+		}
+
+		// Tunnel frames are handled inline to preserve their order
+		if c.handleTunnelMessage(msg) {
+			continue
+		}
+
 		// Process message
-		go c.handleMessage(msg)
+		if c.draining.Load() {
+			c.rejectDraining(msg)
+			continue
+		}
+		if !c.admit(msg) {
+			c.rejectBusy(msg)
+			continue
+		}
+		c.running.Add(1)
+		go func() {
+			defer c.running.Done()
+			release := c.acquire(msg)
+			defer release()
+			c.handleMessage(msg)
+		}()
 	}
 }
 
 func (c *Client) handleMessage(msg map[string]interface{}) {
+	defer crash.Recover("command handler")
+
 	msgType, _ := msg["type"].(string)
 	commandID, _ := msg["command_id"].(string)
 
@@ -271,13 +504,27 @@ func (c *Client) handleMessage(msg map[string]interface{}) {
 	log.Printf("📥 Command from Prime: type=%s, id=%s", msgType, commandID)
 	if msgType == "shell" {
 		if cmd, ok := msg["command"].(string); ok {
-			log.Printf("   Shell: %s", cmd)
+			slog.Debug("   Shell command", "id", commandID, "command", cmd)
 		}
 	}
 
+	// Refuse command types whose capability this daemon wasn't configured with
+	result := handlers.CheckCapability(msgType)
+
 	// Use the handler registry - all command types are handled there
 	// This makes the daemon extensible without modifying this code
-	result := handlers.Handle(msgType, msg)
+	// Stream only if Prime negotiated it and didn't opt out for this command;
+	// otherwise handlers buffer into the final result (follow-style handlers fail)
+	var stream handlers.StreamFunc
+	if wantStream, ok := msg["stream"].(bool); c.partialResults && (!ok || wantStream) {
+		stream = c.partialResultStream(commandID)
+	}
+	if result == nil {
+		result = handlers.HandleStream(msgType, msg, stream)
+	}
+
+	// Mask secrets before the output is logged or sent
+	redact.Result(result)
 
 	// Log result
 	success, _ := result["success"].(bool)
@@ -288,14 +535,47 @@ func (c *Client) handleMessage(msg map[string]interface{}) {
 		log.Printf("❌ Command %s failed: %s", commandID, errMsg)
 	}
 
-	// Add command_id and daemon_id to result
+	// Add command_id and daemon_id to result. complete marks the end of any
+	// partial_result messages sent for this command.
 	result["command_id"] = commandID
 	result["daemon_id"] = c.daemonID
 	result["type"] = TypeResult
+	result["complete"] = true
 
 	// Send result back to Prime
-	if err := c.sendMessage(result); err != nil {
-		log.Printf("Failed to send result: %v", err)
+	err := c.sendMessage(result)
+	if errors.Is(err, ErrMessageTooLarge) {
+		// Tell Prime why instead of leaving the command hanging
+		err = c.sendMessage(map[string]interface{}{
+			"type":       TypeResult,
+			"command_id": commandID,
+			"daemon_id":  c.daemonID,
+			"complete":   true,
+			"success":    false,
+			"error":      fmt.Sprintf("result not sent: %v; use a streaming or ranged variant for large output", err),
+		})
+	}
+	if err != nil {
+		slog.Error("Failed to send result", "error", err)
+	}
+}
+
+// partialResultStream returns a stream that forwards a handler's partial
+// results to Prime as numbered partial_result messages for commandID.
+func (c *Client) partialResultStream(commandID string) handlers.StreamFunc {
+	var mu sync.Mutex
+	seq := 0
+	return func(chunk map[string]interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		seq++
+		redact.Result(chunk)
+		chunk["type"] = TypePartialResult
+		chunk["command_id"] = commandID
+		chunk["daemon_id"] = c.daemonID
+		chunk["seq"] = seq
+		return c.sendMessage(chunk)
 	}
 }
 
@@ -333,6 +613,7 @@ func (c *Client) SendAlert(alertType, message, severity string, metadata map[str
 func (c *Client) sendMessage(msg map[string]interface{}) error {
 	c.mu.RLock()
 	conn := c.conn
+	mux := c.mux
 	c.mu.RUnlock()
 
 	if conn == nil {
@@ -343,19 +624,61 @@ func (c *Client) sendMessage(msg map[string]interface{}) error {
 	if err != nil {
 		return fmt.Errorf("marshal: %w", err)
 	}
+	if len(data) > c.maxSendBytes {
+		return fmt.Errorf("%w: %d bytes exceeds limit of %d", ErrMessageTooLarge, len(data), c.maxSendBytes)
+	}
 
-	// Write length prefix (4 bytes, big-endian)
-	length := make([]byte, 4)
-	binary.BigEndian.PutUint32(length, uint32(len(data)))
+	if mux != nil {
+		return mux.send(data)
+	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.writeFrameWithDeadline(conn, data); err != nil {
+		// A partially written frame leaves the stream unusable; closing the
+		// connection makes the message loop fail and reconnect.
+		conn.Close()
+		return err
+	}
+	return nil
+}
 
-	if _, err := c.conn.Write(length); err != nil {
-		return fmt.Errorf("write length: %w", err)
+// writeFrameWithDeadline writes a frame, failing instead of blocking forever
+// if the connection is half-open and the write can't complete in time. Every
+// frame goes out through here, so this is also where the MAC is added.
+func (c *Client) writeFrameWithDeadline(w io.Writer, data []byte) error {
+	if c.macKey != nil {
+		c.frameMu.Lock()
+		defer c.frameMu.Unlock()
+		c.sendSeq++
+		data = signPayload(c.macKey, macDaemonToPrime, c.sendSeq, data)
 	}
-	if _, err := c.conn.Write(data); err != nil {
-		return fmt.Errorf("write data: %w", err)
+	if conn, ok := w.(net.Conn); ok {
+		conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	return writeFrame(w, data)
+}
+
+// writeFrame writes one length-prefixed frame to w. The prefix and payload go
+// out as a single buffer, and short writes are retried until the whole frame
+// is written so a partial frame never desyncs the stream.
+func writeFrame(w io.Writer, data []byte) error {
+	// Length prefix (4 bytes, big-endian) followed by the payload
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	for written := 0; written < len(frame); {
+		n, err := w.Write(frame[written:])
+		written += n
+		if err != nil {
+			return fmt.Errorf("write frame (%d/%d bytes): %w", written, len(frame), err)
+		}
+		if n == 0 {
+			return fmt.Errorf("write frame (%d/%d bytes): %w", written, len(frame), io.ErrShortWrite)
+		}
 	}
 
 	return nil
@@ -370,19 +693,34 @@ func (c *Client) readMessage() (map[string]interface{}, error) {
 		return nil, fmt.Errorf("not connected")
 	}
 
-	reader := bufio.NewReader(conn)
-
+	// Read straight from the conn: a per-call buffered reader could swallow
+	// the start of the next frame.
 	// Read length prefix (4 bytes, big-endian)
 	lengthBuf := make([]byte, 4)
-	if _, err := io.ReadFull(reader, lengthBuf); err != nil {
+	if n, err := io.ReadFull(conn, lengthBuf); err != nil {
+		if n > 0 {
+			return nil, fmt.Errorf("%w (%d of 4 length bytes): %v", errPartialFrame, n, err)
+		}
 		return nil, err
 	}
 	length := binary.BigEndian.Uint32(lengthBuf)
+	if int64(length) > int64(c.maxRecvBytes) {
+		// The stream can't be resynchronised without reading the frame, so fail and reconnect
+		return nil, fmt.Errorf("%w: incoming frame of %d bytes exceeds limit of %d", ErrMessageTooLarge, length, c.maxRecvBytes)
+	}
 
 	// Read message data
 	data := make([]byte, length)
-	if _, err := io.ReadFull(reader, data); err != nil {
-		return nil, err
+	if n, err := io.ReadFull(conn, data); err != nil {
+		return nil, fmt.Errorf("%w (%d of %d bytes): %v", errPartialFrame, n, length, err)
+	}
+	if c.macKey != nil {
+		// The stream may have been tampered with, so fail and reconnect
+		var err error
+		if data, err = verifyPayload(c.macKey, macPrimeToDaemon, c.recvSeq, data); err != nil {
+			return nil, err
+		}
+		c.recvSeq++
 	}
 
 	var msg map[string]interface{}
@@ -404,6 +742,115 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// Shutdown stops accepting commands, tells Prime the daemon is draining, and
+// waits for running commands to send their results before closing the
+// connection. If ctx ends first, the connection is closed anyway and the
+// remaining results are lost.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.draining.Store(true)
+
+	if c.IsConnected() {
+		if err := c.sendMessage(map[string]interface{}{
+			"type":         TypeStatus,
+			"daemon_id":    c.daemonID,
+			"status":       "draining",
+			"active_tasks": handlers.ActiveTasks(),
+		}); err != nil {
+			slog.Error("Failed to send draining status", "error", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.running.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+		log.Printf("All commands finished")
+	case <-ctx.Done():
+		err = fmt.Errorf("gave up waiting for running commands: %w", ctx.Err())
+	}
+
+	if closeErr := c.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// unlimitedTypes bypass MaxConcurrent: they're cheap, and cancel_command has
+// to get through precisely when the daemon is busy.
+var unlimitedTypes = map[string]bool{
+	"cancel_command": true,
+	TypePing:         true,
+}
+
+// limited reports whether msg counts against MaxConcurrent.
+func (c *Client) limited(msg map[string]interface{}) bool {
+	msgType, _ := msg["type"].(string)
+	return c.slots != nil && !unlimitedTypes[msgType]
+}
+
+// admit reserves a place for msg under MaxConcurrent: up to MaxConcurrent
+// commands run at once and as many again wait their turn. Beyond that it
+// returns false and the command should be refused.
+func (c *Client) admit(msg map[string]interface{}) bool {
+	if !c.limited(msg) {
+		return true
+	}
+	if int(c.pending.Add(1)) > 2*cap(c.slots) {
+		c.pending.Add(-1)
+		return false
+	}
+	return true
+}
+
+// acquire waits for a free slot for an admitted msg. It runs in the command's
+// own goroutine so the read loop never blocks. The returned func releases it.
+func (c *Client) acquire(msg map[string]interface{}) func() {
+	if !c.limited(msg) {
+		return func() {}
+	}
+	c.slots <- struct{}{}
+	return func() {
+		<-c.slots
+		c.pending.Add(-1)
+	}
+}
+
+// rejectBusy answers a command refused because too many are already running
+// or queued.
+func (c *Client) rejectBusy(msg map[string]interface{}) {
+	c.rejectCommand(msg, fmt.Sprintf("daemon busy: %d commands running and %d queued; retry later", cap(c.slots), cap(c.slots)))
+}
+
+// rejectDraining answers a command that arrived during shutdown, so Prime
+// doesn't wait on it until it times out.
+func (c *Client) rejectDraining(msg map[string]interface{}) {
+	c.rejectCommand(msg, "daemon is shutting down")
+}
+
+// rejectCommand sends a failed result for a command that won't be run.
+func (c *Client) rejectCommand(msg map[string]interface{}, reason string) {
+	commandID, _ := msg["command_id"].(string)
+	if commandID == "" {
+		return
+	}
+	err := c.sendMessage(map[string]interface{}{
+		"type":       TypeResult,
+		"command_id": commandID,
+		"daemon_id":  c.daemonID,
+		"complete":   true,
+		"success":    false,
+		"error":      reason,
+	})
+	if err != nil {
+		slog.Error("Failed to reject command", "id", commandID, "error", err)
+	}
+}
+
 // DaemonID returns the assigned daemon ID.
 func (c *Client) DaemonID() string {
 	return c.daemonID
@@ -0,0 +1,178 @@
+// Stream multiplexing - keeps a large result from head-of-line blocking
+// heartbeats and other results on the single Prime connection.
+//
+// When Prime acks registration with "multiplex": true, every outgoing message
+// goes through a muxWriter. Messages up to muxChunkSize are sent whole and
+// take priority. Larger messages are split into stream_frame messages:
+//
+//	{"type":"stream_frame", "stream_id":7, "seq":0, "final":false, "data":"<base64>"}
+//
+// Prime concatenates the decoded data of a stream's frames in seq order and
+// parses the result as one ordinary message once it sees "final": true.
+// Frames of concurrent large messages are interleaved round-robin.
+package primeclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/ultron/daemon/internal/crash"
+)
+
+// TypeStreamFrame carries one chunk of a multiplexed large message.
+const TypeStreamFrame = "stream_frame"
+
+// muxChunkSize is the largest payload sent as a single frame.
+const muxChunkSize = 64 * 1024
+
+// muxMessage is a queued outgoing message.
+type muxMessage struct {
+	data     []byte
+	streamID uint64
+	offset   int
+	seq      int
+	done     chan error
+}
+
+// muxWriter owns all writes to the connection while multiplexing is on.
+type muxWriter struct {
+	conn     net.Conn
+	write    func(w io.Writer, data []byte) error
+	mu       sync.Mutex
+	control  []*muxMessage
+	streams  []*muxMessage
+	nextID   uint64
+	notify   chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+	err      error
+}
+
+func newMuxWriter(conn net.Conn, write func(w io.Writer, data []byte) error) *muxWriter {
+	m := &muxWriter{
+		conn:    conn,
+		write:   write,
+		notify:  make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// send queues data and blocks until it has been fully written.
+func (m *muxWriter) send(data []byte) error {
+	msg := &muxMessage{data: data, done: make(chan error, 1)}
+
+	m.mu.Lock()
+	if m.err != nil {
+		err := m.err
+		m.mu.Unlock()
+		return err
+	}
+	if len(data) <= muxChunkSize {
+		m.control = append(m.control, msg)
+	} else {
+		m.nextID++
+		msg.streamID = m.nextID
+		m.streams = append(m.streams, msg)
+	}
+	m.mu.Unlock()
+
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+
+	return <-msg.done
+}
+
+// stop fails any queued messages and ends the writer goroutine.
+func (m *muxWriter) stop(reason error) {
+	m.stopOnce.Do(func() {
+		m.mu.Lock()
+		m.err = reason
+		pending := append(m.control, m.streams...)
+		m.control, m.streams = nil, nil
+		m.mu.Unlock()
+
+		for _, msg := range pending {
+			msg.done <- reason
+		}
+		close(m.stopped)
+	})
+}
+
+func (m *muxWriter) run() {
+	defer crash.Recover("mux writer")
+
+	for {
+		frame, msg, finished := m.next()
+		if msg == nil {
+			select {
+			case <-m.stopped:
+				return
+			case <-m.notify:
+			}
+			continue
+		}
+
+		if err := m.write(m.conn, frame); err != nil {
+			// Unfinished streams are still queued and get failed by stop
+			if finished {
+				msg.done <- err
+			}
+			m.stop(fmt.Errorf("connection write failed: %w", err))
+			m.conn.Close() // Force the message loop to reconnect
+			return
+		}
+		if finished {
+			msg.done <- nil
+		}
+	}
+}
+
+// next picks the next frame to write: control messages first, then one chunk
+// from the stream at the head of the round-robin queue.
+func (m *muxWriter) next() ([]byte, *muxMessage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.control) > 0 {
+		msg := m.control[0]
+		m.control = m.control[1:]
+		return msg.data, msg, true
+	}
+
+	if len(m.streams) == 0 {
+		return nil, nil, false
+	}
+
+	msg := m.streams[0]
+	m.streams = m.streams[1:]
+
+	end := msg.offset + muxChunkSize
+	if end > len(msg.data) {
+		end = len(msg.data)
+	}
+	final := end == len(msg.data)
+
+	frame, _ := json.Marshal(map[string]interface{}{
+		"type":      TypeStreamFrame,
+		"stream_id": msg.streamID,
+		"seq":       msg.seq,
+		"final":     final,
+		"data":      base64.StdEncoding.EncodeToString(msg.data[msg.offset:end]),
+	})
+
+	msg.offset = end
+	msg.seq++
+	if !final {
+		m.streams = append(m.streams, msg)
+	}
+
+	return frame, msg, final
+}
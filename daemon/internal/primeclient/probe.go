@@ -0,0 +1,87 @@
+package primeclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// probeTimeout bounds each stage of the startup probe.
+const probeTimeout = 10 * time.Second
+
+// ProbeError describes which stage of reaching Prime failed.
+type ProbeError struct {
+	Stage string // "address", "dns", "connect"
+	Hint  string // What the operator should check
+	Err   error
+}
+
+func (e *ProbeError) Error() string {
+	return fmt.Sprintf("%s failed: %v (%s)", e.Stage, e.Err, e.Hint)
+}
+
+func (e *ProbeError) Unwrap() error {
+	return e.Err
+}
+
+// Probe checks that Prime is reachable, distinguishing DNS failures from
+// refused or timed-out connections so misconfiguration is easy to spot.
+// It does not register; the connection is closed immediately.
+func (c *Client) Probe(ctx context.Context) error {
+	target := c.primeAddress
+	if c.wsURL != "" {
+		hostPort, err := wsHostPort(c.wsURL)
+		if err != nil {
+			return &ProbeError{Stage: "address", Hint: "PRIME_WS_URL must be a ws:// or wss:// URL", Err: err}
+		}
+		target = hostPort
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return &ProbeError{Stage: "address", Hint: "PRIME_ADDRESS must be host:port", Err: err}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	// Through a proxy, it's the proxy's name that must resolve here
+	proxyURL, err := c.proxy.For(c.primeScheme(), net.JoinHostPort(host, port))
+	if err != nil {
+		return &ProbeError{Stage: "proxy", Hint: "check DAEMON_PROXY, HTTPS_PROXY and ALL_PROXY", Err: err}
+	}
+	if proxyURL != nil {
+		host = proxyURL.Hostname()
+	}
+
+	if net.ParseIP(host) == nil {
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			return &ProbeError{Stage: "dns", Hint: fmt.Sprintf("check that %q resolves from this host", host), Err: err}
+		}
+	}
+
+	conn, err := c.dialPrime(ctx, target)
+	if err != nil {
+		hint := "check network connectivity and firewalls"
+		switch {
+		case errors.Is(err, errProxyRefused):
+			hint = "the proxy wouldn't open a tunnel to Prime - check its credentials and that it allows CONNECT to this port"
+		case proxyURL != nil && errors.Is(err, syscall.ECONNREFUSED):
+			hint = fmt.Sprintf("nothing is listening on the proxy at %s - check DAEMON_PROXY or HTTPS_PROXY", proxyURL.Host)
+		case errors.Is(err, syscall.ECONNREFUSED):
+			hint = fmt.Sprintf("nothing is listening on %s - is Prime running and DAEMON_PORT correct?", target)
+		case errors.Is(err, context.DeadlineExceeded):
+			hint = "connection timed out - a firewall or security group may be dropping traffic"
+		case errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EHOSTUNREACH):
+			hint = "no route to Prime - check routing/VPN"
+		case errors.Is(err, syscall.EADDRNOTAVAIL), errors.Is(err, syscall.EADDRINUSE):
+			hint = "can't bind DAEMON_SOURCE_ADDR - check the address, and leave the port out unless it's free"
+		}
+		return &ProbeError{Stage: "connect", Hint: hint, Err: err}
+	}
+	conn.Close()
+
+	return nil
+}
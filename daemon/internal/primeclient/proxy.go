@@ -0,0 +1,222 @@
+// Outbound proxies - reaching Prime from networks that only let traffic out
+// through an HTTP (CONNECT) or SOCKS5 proxy.
+package primeclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// proxyHandshakeTimeout bounds connecting to a proxy and setting up the tunnel.
+const proxyHandshakeTimeout = 30 * time.Second
+
+// errProxyRefused means the proxy answered but wouldn't open the tunnel.
+var errProxyRefused = errors.New("proxy refused the connection")
+
+// Proxy picks the proxy for a connection to Prime: the explicit URL if one is
+// configured, otherwise HTTPS_PROXY, HTTP_PROXY and ALL_PROXY from the
+// environment. Hosts matching NO_PROXY, localhost and loopback addresses are
+// always reached directly.
+type Proxy struct {
+	find func(*url.URL) (*url.URL, error)
+}
+
+// LoadProxy builds the Proxy for explicit (http://, https://, socks5:// or
+// socks5h:// URL; empty = the environment). Malformed proxy URLs are reported
+// here rather than on every reconnect.
+func LoadProxy(explicit string) (*Proxy, error) {
+	cfg := httpproxy.FromEnvironment()
+	if explicit != "" {
+		cfg.HTTPProxy, cfg.HTTPSProxy = explicit, explicit
+	} else {
+		all := os.Getenv("ALL_PROXY")
+		if all == "" {
+			all = os.Getenv("all_proxy")
+		}
+		if cfg.HTTPSProxy == "" {
+			cfg.HTTPSProxy = all
+		}
+		if cfg.HTTPProxy == "" {
+			cfg.HTTPProxy = all
+		}
+	}
+	for _, raw := range []string{cfg.HTTPProxy, cfg.HTTPSProxy} {
+		if raw == "" {
+			continue
+		}
+		if _, err := parseProxyURL(raw); err != nil {
+			return nil, err
+		}
+	}
+	return &Proxy{find: cfg.ProxyFunc()}, nil
+}
+
+// For returns the proxy for a scheme ("http" or "https") connection to
+// hostPort, or nil to connect directly.
+func (p *Proxy) For(scheme, hostPort string) (*url.URL, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return p.find(&url.URL{Scheme: scheme, Host: hostPort})
+}
+
+// ForRequest is For as an http.Transport Proxy function.
+func (p *Proxy) ForRequest(req *http.Request) (*url.URL, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return p.find(req.URL)
+}
+
+// parseProxyURL parses a proxy URL, treating a bare host:port as http://.
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		if u, err = url.Parse("http://" + raw); err != nil {
+			return nil, fmt.Errorf("invalid proxy address %q: %w", raw, err)
+		}
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q in %q (use http, https, socks5 or socks5h)", u.Scheme, u.Redacted())
+}
+
+// primeScheme is the scheme proxies are chosen by for the connection to Prime:
+// https for TLS (and for the raw TCP stream, which needs a CONNECT tunnel
+// either way), http for ws:// without it.
+func (c *Client) primeScheme() string {
+	if u, err := url.Parse(c.wsURL); err == nil && u.Scheme == "ws" {
+		return "http"
+	}
+	return "https"
+}
+
+// ProxyURL returns the proxy connections to Prime go through, or nil if they
+// connect directly.
+func (c *Client) ProxyURL() *url.URL {
+	addr := c.primeAddress
+	if c.wsURL != "" {
+		addr, _ = wsHostPort(c.wsURL)
+	}
+	proxyURL, _ := c.proxy.For(c.primeScheme(), addr)
+	return proxyURL
+}
+
+// dialPrime connects to addr, through the proxy if one applies.
+func (c *Client) dialPrime(ctx context.Context, addr string) (net.Conn, error) {
+	d := c.dialer()
+	proxyURL, err := c.proxy.For(c.primeScheme(), addr)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	return dialViaProxy(ctx, d, proxyURL, addr)
+}
+
+// dialViaProxy opens a tunnel to addr through proxyURL.
+func dialViaProxy(ctx context.Context, d net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, proxyHandshakeTimeout)
+	defer cancel()
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(proxyURL, &d)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("SOCKS proxy %s: %w", proxyURL.Host, err)
+		}
+		return conn, nil
+	default:
+		return dialConnect(ctx, d, proxyURL, addr)
+	}
+}
+
+// dialConnect opens a tunnel to addr with an HTTP CONNECT request.
+func dialConnect(ctx context.Context, d net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP proxy %s: %w", proxyAddr, err)
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("HTTP proxy %s: TLS handshake: %w", proxyAddr, err)
+		}
+		conn = tlsConn
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("HTTP proxy %s: %w", proxyAddr, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("HTTP proxy %s: %w", proxyAddr, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		conn.Close()
+		return nil, fmt.Errorf("%w: HTTP proxy %s answered CONNECT %s with %s", errProxyRefused, proxyAddr, addr, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	if br.Buffered() > 0 {
+		// Prime spoke first and the bytes landed in the response buffer
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads what the CONNECT response reader buffered before the
+// rest of the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
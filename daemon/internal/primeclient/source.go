@@ -0,0 +1,47 @@
+package primeclient
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// ResolveSourceAddr parses the local address outbound connections to Prime
+// should originate from: an IP, or IP:port to pin the port too. The IP must
+// be assigned to one of this host's interfaces, so a typo fails at startup
+// rather than on every reconnect.
+func ResolveSourceAddr(addr string) (*net.TCPAddr, error) {
+	host, port := addr, 0
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > 65535 {
+			return nil, fmt.Errorf("invalid source port in %q", addr)
+		}
+		host, port = h, n
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("source address %q is not an IP address", addr)
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("list interface addresses: %w", err)
+	}
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return &net.TCPAddr{IP: ip, Port: port}, nil
+		}
+	}
+	return nil, fmt.Errorf("source address %s is not assigned to any local interface", ip)
+}
+
+// dialer returns the dialer for connections to Prime, bound to the source
+// address if one is configured.
+func (c *Client) dialer() net.Dialer {
+	d := net.Dialer{KeepAlive: c.keepAlive}
+	if c.sourceAddr != nil {
+		d.LocalAddr = c.sourceAddr
+	}
+	return d
+}
@@ -0,0 +1,257 @@
+// Port forwarding - proxies a host:port reachable from the daemon back through
+// the Prime connection, so Prime can reach services on the daemon's network.
+//
+// Framing (all messages use the normal length-prefixed JSON envelope):
+//
+//	Prime  -> daemon  {"type":"tunnel_open",  "command_id":..., "tunnel_id":..., "target":"db.internal:5432"}
+//	daemon -> Prime   {"type":"result",       "command_id":..., "tunnel_id":..., "success":true}
+//	either -> either  {"type":"tunnel_data",  "tunnel_id":..., "data":"<base64>"}
+//	either -> either  {"type":"tunnel_close", "tunnel_id":..., "error":"..."}
+//
+// Prime must wait for the open result before sending data frames. Data frames
+// for a tunnel are delivered in order; tunnels are multiplexed by
+// tunnel_id and all of them are torn down when the Prime connection drops.
+// A target that falls tunnelWriteQueue frames behind gets its tunnel closed,
+// rather than stalling every other message on the connection.
+package primeclient
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/ultron/daemon/internal/handlers"
+)
+
+// Tunnel message types
+const (
+	TypeTunnelOpen  = "tunnel_open"
+	TypeTunnelData  = "tunnel_data"
+	TypeTunnelClose = "tunnel_close"
+)
+
+const (
+	tunnelChunkSize   = 32 * 1024
+	tunnelDialTimeout = 10 * time.Second
+	tunnelWriteQueue  = 64
+)
+
+// tunnel is a single forwarded connection.
+type tunnel struct {
+	id     string
+	target string
+	conn   net.Conn // Nil until the dial succeeds; set under tunnelsMu
+	writes chan []byte
+	done   chan struct{}
+}
+
+// handleTunnelMessage processes tunnel frames. It runs on the read loop so
+// data frames keep their order; it returns false for non-tunnel messages.
+func (c *Client) handleTunnelMessage(msg map[string]interface{}) bool {
+	msgType, _ := msg["type"].(string)
+	tunnelID, _ := msg["tunnel_id"].(string)
+
+	switch msgType {
+	case TypeTunnelOpen:
+		commandID, _ := msg["command_id"].(string)
+		target, _ := msg["target"].(string)
+		if tunnelID == "" {
+			tunnelID = commandID
+		}
+		go c.openTunnel(commandID, tunnelID, target)
+	case TypeTunnelData:
+		data, _ := msg["data"].(string)
+		c.writeTunnel(tunnelID, data)
+	case TypeTunnelClose:
+		c.closeTunnel(tunnelID, false, nil)
+	default:
+		return false
+	}
+	return true
+}
+
+func (c *Client) openTunnel(commandID, tunnelID, target string) {
+	result := map[string]interface{}{
+		"type":       TypeResult,
+		"command_id": commandID,
+		"daemon_id":  c.daemonID,
+		"tunnel_id":  tunnelID,
+		"target":     target,
+	}
+
+	err := func() error {
+		if !handlers.HasCapability("network") {
+			return fmt.Errorf(`capability not enabled: %s needs "network" (add it to DAEMON_CAPABILITIES)`, TypeTunnelOpen)
+		}
+		if tunnelID == "" || target == "" {
+			return fmt.Errorf("tunnel_id and target are required")
+		}
+
+		// Reserve the ID before dialing so a second open with it fails
+		t := &tunnel{
+			id:     tunnelID,
+			target: target,
+			writes: make(chan []byte, tunnelWriteQueue),
+			done:   make(chan struct{}),
+		}
+		c.tunnelsMu.Lock()
+		_, exists := c.tunnels[tunnelID]
+		if !exists {
+			c.tunnels[tunnelID] = t
+		}
+		c.tunnelsMu.Unlock()
+		if exists {
+			return fmt.Errorf("tunnel already open: %s", tunnelID)
+		}
+
+		conn, err := net.DialTimeout("tcp", target, tunnelDialTimeout)
+
+		c.tunnelsMu.Lock()
+		open := c.tunnels[tunnelID] == t // Prime may have closed it while we dialed
+		switch {
+		case err != nil && open:
+			delete(c.tunnels, tunnelID)
+		case err == nil && open:
+			t.conn = conn
+		}
+		c.tunnelsMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("dial %s: %w", target, err)
+		}
+		if !open {
+			conn.Close()
+			return fmt.Errorf("tunnel closed while connecting: %s", tunnelID)
+		}
+
+		go c.tunnelWriter(t)
+		go c.tunnelReader(t)
+		return nil
+	}()
+
+	result["success"] = err == nil
+	if err != nil {
+		result["error"] = err.Error()
+	} else {
+		log.Printf("🔀 Tunnel %s opened to %s", tunnelID, target)
+	}
+
+	if err := c.sendMessage(result); err != nil {
+		slog.Error("Failed to send tunnel result", "tunnel", tunnelID, "error", err)
+		c.closeTunnel(tunnelID, false, nil)
+	}
+}
+
+// tunnelReader copies data from the target to Prime.
+func (c *Client) tunnelReader(t *tunnel) {
+	buf := make([]byte, tunnelChunkSize)
+	for {
+		n, err := t.conn.Read(buf)
+		if n > 0 {
+			sendErr := c.sendMessage(map[string]interface{}{
+				"type":      TypeTunnelData,
+				"tunnel_id": t.id,
+				"data":      base64.StdEncoding.EncodeToString(buf[:n]),
+			})
+			if sendErr != nil {
+				c.closeTunnel(t.id, false, sendErr)
+				return
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			c.closeTunnel(t.id, true, err)
+			return
+		}
+	}
+}
+
+// tunnelWriter copies data from Prime to the target, in arrival order.
+func (c *Client) tunnelWriter(t *tunnel) {
+	for {
+		select {
+		case <-t.done:
+			return
+		case data := <-t.writes:
+			if _, err := t.conn.Write(data); err != nil {
+				c.closeTunnel(t.id, true, err)
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) writeTunnel(tunnelID, encoded string) {
+	c.tunnelsMu.Lock()
+	t, ok := c.tunnels[tunnelID]
+	c.tunnelsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		c.closeTunnel(tunnelID, true, fmt.Errorf("invalid tunnel data: %w", err))
+		return
+	}
+
+	// This runs on the read loop, so never wait for a slow target
+	select {
+	case t.writes <- data:
+	case <-t.done:
+	default:
+		c.closeTunnel(tunnelID, true, fmt.Errorf("target %s is not keeping up (%d writes queued)", t.target, tunnelWriteQueue))
+	}
+}
+
+// closeTunnel tears down a tunnel, optionally telling Prime why.
+func (c *Client) closeTunnel(tunnelID string, notify bool, reason error) {
+	c.tunnelsMu.Lock()
+	t, ok := c.tunnels[tunnelID]
+	var conn net.Conn
+	if ok {
+		delete(c.tunnels, tunnelID)
+		conn = t.conn
+	}
+	c.tunnelsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	close(t.done)
+	if conn == nil {
+		return // Still dialing; openTunnel sees it's gone and hangs up
+	}
+	conn.Close()
+	log.Printf("🔀 Tunnel %s to %s closed", t.id, t.target)
+
+	if notify {
+		msg := map[string]interface{}{
+			"type":      TypeTunnelClose,
+			"tunnel_id": t.id,
+		}
+		if reason != nil {
+			msg["error"] = reason.Error()
+		}
+		c.sendMessage(msg)
+	}
+}
+
+// closeAllTunnels drops every tunnel; used when the Prime connection ends.
+func (c *Client) closeAllTunnels() {
+	c.tunnelsMu.Lock()
+	ids := make([]string, 0, len(c.tunnels))
+	for id := range c.tunnels {
+		ids = append(ids, id)
+	}
+	c.tunnelsMu.Unlock()
+
+	for _, id := range ids {
+		c.closeTunnel(id, false, nil)
+	}
+}
@@ -0,0 +1,220 @@
+// WebSocket transport - the same length-prefixed frames, carried in binary
+// WebSocket messages, for networks that only let HTTP(S) out.
+//
+// With PRIME_TRANSPORT=websocket the daemon dials PRIME_WS_URL (ws:// or
+// wss://, e.g. wss://prime.example.com/api/daemon/ws) instead of the raw TCP
+// port. The handshake honours HTTPS_PROXY/HTTP_PROXY, and everything above the
+// connection (registration, heartbeats, MAC, multiplexing) is unchanged.
+// Proxies are the client's (see proxy.go), so HTTPS_PROXY and friends apply.
+package primeclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// Transports for the Prime connection.
+const (
+	TransportTCP       = "tcp"
+	TransportWebSocket = "websocket"
+)
+
+// dialWebSocket opens the WebSocket connection to Prime and adapts it to a
+// net.Conn carrying the frame stream.
+func (c *Client) dialWebSocket(ctx context.Context) (net.Conn, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// dialPrime tunnels through the proxy itself, for ws:// as well as wss://
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return c.dialPrime(ctx, addr)
+	}
+	if c.tlsConfig != nil {
+		transport.TLSClientConfig = c.tlsConfig
+	}
+
+	ws, _, err := websocket.Dial(ctx, c.wsURL, &websocket.DialOptions{
+		HTTPClient: &http.Client{Transport: transport},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Every frame is one message: the length prefix plus the (signed) payload
+	ws.SetReadLimit(int64(c.maxRecvBytes) + 4 + macSize)
+	return newWSConn(ws, c.wsURL), nil
+}
+
+// wsHostPort returns the host:port of Prime's WebSocket URL.
+func wsHostPort(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	switch u.Scheme {
+	case "ws":
+		if port == "" {
+			port = "80"
+		}
+	case "wss":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return "", fmt.Errorf("PRIME_WS_URL must start with ws:// or wss://")
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// wsConn is a net.Conn over a WebSocket. Messages are read in the background
+// so a read deadline can expire without tearing the connection down, as it
+// doesn't for TCP.
+type wsConn struct {
+	ws     *websocket.Conn
+	addr   wsAddr
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	messages chan []byte
+	readErr  error // Set before messages is closed
+	pending  []byte
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	writeMu       sync.Mutex
+}
+
+func newWSConn(ws *websocket.Conn, rawURL string) *wsConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &wsConn{
+		ws:       ws,
+		addr:     wsAddr(rawURL),
+		ctx:      ctx,
+		cancel:   cancel,
+		messages: make(chan []byte, 16),
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *wsConn) readLoop() {
+	defer close(c.messages)
+	for {
+		typ, data, err := c.ws.Read(c.ctx)
+		if err != nil {
+			switch websocket.CloseStatus(err) {
+			case websocket.StatusNormalClosure, websocket.StatusGoingAway:
+				c.readErr = io.EOF
+			default:
+				c.readErr = err
+			}
+			return
+		}
+		if typ != websocket.MessageBinary {
+			continue
+		}
+		select {
+		case c.messages <- data:
+		case <-c.ctx.Done():
+			c.readErr = net.ErrClosed
+			return
+		}
+	}
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		c.mu.Lock()
+		deadline := c.readDeadline
+		c.mu.Unlock()
+
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case data, ok := <-c.messages:
+			if !ok {
+				return 0, c.readErr
+			}
+			c.pending = data
+		case <-timeout:
+			return 0, wsTimeoutError{}
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends p as one binary message. A write that misses its deadline
+// closes the connection, which the client treats as dead anyway.
+func (c *wsConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+
+	ctx := c.ctx
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	if err := c.ws.Write(ctx, websocket.MessageBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) Close() error {
+	c.cancel()
+	return c.ws.Close(websocket.StatusNormalClosure, "")
+}
+
+func (c *wsConn) LocalAddr() net.Addr  { return c.addr }
+func (c *wsConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+// wsAddr is the URL a wsConn was dialed to.
+type wsAddr string
+
+func (a wsAddr) Network() string { return "websocket" }
+func (a wsAddr) String() string  { return string(a) }
+
+// wsTimeoutError is returned by Read when the read deadline passes.
+type wsTimeoutError struct{}
+
+func (wsTimeoutError) Error() string   { return "i/o timeout" }
+func (wsTimeoutError) Timeout() bool   { return true }
+func (wsTimeoutError) Temporary() bool { return true }
@@ -0,0 +1,145 @@
+// Package redact masks secrets in command output before it leaves the daemon.
+package redact
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+)
+
+// Placeholder replaces every match.
+const Placeholder = "[REDACTED]"
+
+// DefaultPatterns catch common credentials that scripts print by accident.
+var DefaultPatterns = []string{
+	`\b(AKIA|ASIA)[0-9A-Z]{16}\b`,                                                    // AWS access key IDs
+	`(?i)aws_secret_access_key\s*[=:]\s*["']?[A-Za-z0-9/+=]{40}`,                     // AWS secret keys
+	`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`,                                           // Bearer tokens
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,                                                 // GitHub tokens
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----|$)`, // PEM private keys
+}
+
+// Result fields that carry command output. Besides strings they may hold
+// batches of records (shell lines, journal entries, console messages), whose
+// text is redacted wherever it is nested.
+var outputFields = []string{"output", "stdout", "stderr", "error", "entries", "console", "samples"}
+
+var (
+	mu       sync.RWMutex
+	patterns = mustCompile(DefaultPatterns)
+)
+
+// SetPatterns replaces the active patterns. Invalid patterns are reported
+// and the previous set is kept.
+func SetPatterns(exprs []string) error {
+	compiled := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid redaction pattern %q: %w", expr, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	patterns = compiled
+	return nil
+}
+
+// String replaces every pattern match in s with Placeholder.
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, re := range patterns {
+		s = re.ReplaceAllString(s, Placeholder)
+	}
+	return s
+}
+
+// Result redacts the output fields of a handler result in place. Slices,
+// maps and structs in them are replaced by redacted copies, so records the
+// handler still holds are left alone.
+func Result(result map[string]interface{}) {
+	for _, field := range outputFields {
+		switch v := result[field].(type) {
+		case nil:
+		case string:
+			if v != "" {
+				result[field] = String(v)
+			}
+		default:
+			result[field] = value(reflect.ValueOf(v)).Interface()
+		}
+	}
+}
+
+// value returns a copy of v with every string in it redacted, including
+// those in slice and array elements, map values and exported struct fields.
+func value(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.String:
+		out := reflect.New(v.Type()).Elem()
+		out.SetString(String(v.String()))
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(value(v.Elem()))
+		return out
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(value(v.Elem()))
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(value(v.Index(i)))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(value(v.Index(i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), value(iter.Value()))
+		}
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if out.Field(i).CanSet() {
+				out.Field(i).Set(value(v.Field(i)))
+			}
+		}
+		return out
+	}
+	return v
+}
+
+func mustCompile(exprs []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, len(exprs))
+	for i, expr := range exprs {
+		compiled[i] = regexp.MustCompile(expr)
+	}
+	return compiled
+}
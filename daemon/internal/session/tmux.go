@@ -3,10 +3,15 @@ package session
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,8 +22,15 @@ type Manager struct {
 	mu       sync.RWMutex
 	sessions map[string]*Session
 	logDir   string
+
+	// Limits (see SetLimits)
+	maxSessions int  // Running sessions allowed at once; 0 means no limit
+	evictIdle   bool // At the limit, kill the least recently used session instead of failing
 }
 
+// DefaultMaxSessions is the session limit until SetLimits is called.
+const DefaultMaxSessions = 20
+
 // Session represents a tmux session
 type Session struct {
 	ID          string
@@ -28,25 +40,95 @@ type Session struct {
 	CreatedAt   time.Time
 	IsRunning   bool
 	LogFile     string
+	Env         map[string]string // Variables set for this session only
+	HistoryFile string            // Commands sent to the session, as JSON lines
+	history     []HistoryEntry
+	lastUsed    time.Time // Creation or last command sent
+	sentOffset  int64     // Log size when the last command was sent
+	sentCommand string    // ...and the command itself
 	lastChecked time.Time
 }
 
+// HistoryEntry is one command sent to a session.
+type HistoryEntry struct {
+	Command string    `json:"command"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// MaxHistory caps how many commands are kept per session; older ones are dropped.
+const MaxHistory = 500
+
 // NewManager creates a new session manager
 func NewManager() *Manager {
 	logDir := filepath.Join(os.TempDir(), "ultron-sessions")
 	os.MkdirAll(logDir, 0755)
 
 	return &Manager{
-		sessions: make(map[string]*Session),
-		logDir:   logDir,
+		sessions:    make(map[string]*Session),
+		logDir:      logDir,
+		maxSessions: DefaultMaxSessions,
+	}
+}
+
+// SetLimits caps how many sessions may run at once (0 for no limit). With
+// evictIdle, creating a session at the cap kills the least recently used
+// one instead of failing.
+func (m *Manager) SetLimits(maxSessions int, evictIdle bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxSessions = maxSessions
+	m.evictIdle = evictIdle
+}
+
+// makeRoomLocked enforces maxSessions before a new session is created.
+func (m *Manager) makeRoomLocked() error {
+	if m.maxSessions <= 0 {
+		return nil
 	}
+	m.refreshFromTmux()
+
+	var running []*Session
+	for _, s := range m.sessions {
+		if s.IsRunning {
+			running = append(running, s)
+		}
+	}
+	if len(running) < m.maxSessions {
+		return nil
+	}
+	if !m.evictIdle {
+		return fmt.Errorf("session limit reached (%d running); kill a session first", len(running))
+	}
+
+	sort.Slice(running, func(i, j int) bool { return running[i].lastUsed.Before(running[j].lastUsed) })
+	for _, s := range running[:len(running)-m.maxSessions+1] {
+		log.Printf("Session limit reached, evicting least recently used session %s", s.ID)
+		if err := m.killLocked(s); err != nil {
+			return fmt.Errorf("session limit reached and evicting %s failed: %w", s.ID, err)
+		}
+	}
+	return nil
 }
 
-// Create creates a new tmux session
-func (m *Manager) Create(name, command, workingDir string) (*Session, error) {
+// Global manager instance
+var DefaultManager = NewManager()
+
+// Create creates a new tmux session. env is set for this session only, on
+// top of the daemon's environment.
+func (m *Manager) Create(name, command, workingDir string, env map[string]string) (*Session, error) {
+	for k := range env {
+		if !envNamePattern.MatchString(k) {
+			return nil, fmt.Errorf("invalid environment variable name: %q", k)
+		}
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if err := m.makeRoomLocked(); err != nil {
+		return nil, err
+	}
+
 	// Generate session ID
 	sessionID := fmt.Sprintf("ultron-%s-%d", name, time.Now().UnixNano())
 
@@ -54,14 +136,32 @@ func (m *Manager) Create(name, command, workingDir string) (*Session, error) {
 	logFile := filepath.Join(m.logDir, sessionID+".log")
 
 	// Build tmux command
-	var tmuxCmd *exec.Cmd
+	args := []string{"new-session", "-d", "-s", sessionID, "-c", workingDir}
+	if len(env) > 0 {
+		if tmuxSupportsEnvFlag() {
+			// tmux 3.2+ puts these in the session environment, so later windows get them too
+			for _, k := range sortedKeys(env) {
+				args = append(args, "-e", k+"="+env[k])
+			}
+		} else {
+			// Older tmux: wrap the first window's command in env(1)
+			if command == "" {
+				command = "${SHELL:-/bin/sh}"
+			} else {
+				command = "sh -c " + shellQuote(command)
+			}
+			prefix := []string{"env"}
+			for _, k := range sortedKeys(env) {
+				prefix = append(prefix, shellQuote(k+"="+env[k]))
+			}
+			command = strings.Join(prefix, " ") + " " + command
+		}
+	}
 	if command != "" {
 		// Create session with initial command
-		tmuxCmd = exec.Command("tmux", "new-session", "-d", "-s", sessionID, "-c", workingDir, command)
-	} else {
-		// Create session with shell
-		tmuxCmd = exec.Command("tmux", "new-session", "-d", "-s", sessionID, "-c", workingDir)
+		args = append(args, command)
 	}
+	tmuxCmd := exec.Command("tmux", args...)
 
 	if workingDir == "" {
 		workingDir, _ = os.Getwd()
@@ -84,6 +184,9 @@ func (m *Manager) Create(name, command, workingDir string) (*Session, error) {
 		CreatedAt:   time.Now(),
 		IsRunning:   true,
 		LogFile:     logFile,
+		Env:         env,
+		HistoryFile: filepath.Join(m.logDir, sessionID+".history.jsonl"),
+		lastUsed:    time.Now(),
 		lastChecked: time.Now(),
 	}
 
@@ -152,9 +255,154 @@ func (m *Manager) SendCommand(sessionID, command string) error {
 		return fmt.Errorf("session is not running: %s", sessionID)
 	}
 
+	// Output from here on belongs to this command (see WaitForOutput)
+	var offset int64
+	if info, err := os.Stat(session.LogFile); err == nil {
+		offset = info.Size()
+	}
+
 	// Send keys to tmux session
 	cmd := exec.Command("tmux", "send-keys", "-t", sessionID, command, "Enter")
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	m.recordCommand(session, command, offset)
+	return nil
+}
+
+// BroadcastResult is the outcome of sending a broadcast command to one session.
+type BroadcastResult struct {
+	SessionID string `json:"session_id"`
+	Name      string `json:"name"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BroadcastCommand sends command to every running session whose name starts
+// with namePrefix (all running sessions when it's empty), like tmux's
+// synchronize-panes. One session failing doesn't stop the rest.
+func (m *Manager) BroadcastCommand(command, namePrefix string) []BroadcastResult {
+	m.mu.Lock()
+	m.refreshFromTmux()
+	var targets []*Session
+	for _, s := range m.sessions {
+		if s.IsRunning && strings.HasPrefix(s.Name, namePrefix) {
+			targets = append(targets, s)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].CreatedAt.Before(targets[j].CreatedAt) })
+
+	results := make([]BroadcastResult, 0, len(targets))
+	for _, s := range targets {
+		result := BroadcastResult{SessionID: s.ID, Name: s.Name, Success: true}
+		if err := m.SendCommand(s.ID, command); err != nil {
+			result.Success = false
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// recordCommand appends command to the session's history, in memory and on disk.
+func (m *Manager) recordCommand(session *Session, command string, offset int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session.sentOffset = offset
+	session.sentCommand = command
+	session.lastUsed = time.Now()
+	session.history = append(session.history, HistoryEntry{Command: command, SentAt: session.lastUsed})
+	if len(session.history) > MaxHistory {
+		session.history = session.history[len(session.history)-MaxHistory:]
+		// Rewrite the file so it stays capped too
+		writeHistory(session.HistoryFile, session.history)
+		return
+	}
+
+	f, err := os.OpenFile(session.HistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	json.NewEncoder(f).Encode(session.history[len(session.history)-1])
+}
+
+func writeHistory(path string, history []HistoryEntry) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, entry := range history {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// History returns the commands sent to a session, oldest first. Sessions
+// from before a daemon restart are read back from their history file.
+func (m *Manager) History(sessionID string) ([]HistoryEntry, error) {
+	m.mu.RLock()
+	session, ok := m.sessions[sessionID]
+	var history []HistoryEntry
+	if ok {
+		history = append(history, session.history...)
+	}
+	m.mu.RUnlock()
+
+	if ok && len(history) > 0 {
+		return history, nil
+	}
+
+	var path string
+	if ok {
+		path = session.HistoryFile
+	} else {
+		// The ID becomes a file name under logDir; refuse anything that
+		// would resolve somewhere else
+		if sessionID == "" || filepath.Base(sessionID) != sessionID || sessionID == ".." {
+			return nil, fmt.Errorf("invalid session id: %q", sessionID)
+		}
+		path = filepath.Join(m.logDir, sessionID+".history.jsonl")
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		if ok {
+			return []HistoryEntry{}, nil
+		}
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	history = []HistoryEntry{}
+	dec := json.NewDecoder(f)
+	for {
+		var entry HistoryEntry
+		if err := dec.Decode(&entry); err != nil {
+			break
+		}
+		history = append(history, entry)
+	}
+	if len(history) > MaxHistory {
+		history = history[len(history)-MaxHistory:]
+	}
+	return history, nil
 }
 
 // GetOutput returns the current output from a session's log file
@@ -211,6 +459,130 @@ func (m *Manager) GetOutput(sessionID string, follow bool) (<-chan string, error
 	return output, nil
 }
 
+// maxTailBytes bounds how much of a session log Tail reads.
+const maxTailBytes = 1 << 20
+
+// Tail returns up to the last n lines of a session's log as the terminal
+// showed them, oldest first.
+func (m *Manager) Tail(sessionID string, n int) ([]string, error) {
+	m.mu.RLock()
+	session, ok := m.sessions[sessionID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	file, err := os.Open(session.LogFile)
+	if err != nil {
+		return nil, fmt.Errorf("opening session log: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	start := info.Size() - maxTailBytes
+	if start < 0 {
+		start = 0
+	}
+	data := make([]byte, info.Size()-start)
+	if _, err := file.ReadAt(data, start); err != nil {
+		return nil, err
+	}
+
+	raw := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if start > 0 && len(raw) > 1 {
+		raw = raw[1:] // first line was cut mid-way
+	}
+	lines := make([]string, 0, len(raw))
+	for _, r := range raw {
+		lines = append(lines, cleanLine(r))
+	}
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// ansiPattern matches terminal escape sequences in captured pane output.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]|\x1b\][^\x07]*\x07`)
+
+// WaitForOutput blocks until a line of session output matches pattern and
+// returns that line, e.g. waiting for "Server listening on" after starting a
+// server. Output is searched from when the last command was sent, so a
+// match printed before the call isn't missed.
+func (m *Manager) WaitForOutput(sessionID, pattern string, timeout time.Duration) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	m.mu.RLock()
+	session, ok := m.sessions[sessionID]
+	var offset int64
+	var echoed string
+	if ok {
+		offset, echoed = session.sentOffset, session.sentCommand
+	}
+	m.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	file, err := os.Open(session.LogFile)
+	if err != nil {
+		return "", fmt.Errorf("opening session log: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, 0); err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(timeout)
+	reader := bufio.NewReader(file)
+	var partial string
+	for {
+		chunk, err := reader.ReadString('\n')
+		partial += chunk
+		if err == nil {
+			line := cleanLine(partial)
+			partial = ""
+			// The terminal echoes the command line itself (sometimes twice); don't match on that
+			if echoed != "" && strings.HasSuffix(line, echoed) {
+				continue
+			}
+			if re.MatchString(line) {
+				return line, nil
+			}
+			continue
+		}
+
+		// At the end of the log; a prompt or progress line may never get its newline
+		if line := cleanLine(partial); line != "" && (echoed == "" || !strings.HasSuffix(line, echoed)) && re.MatchString(line) {
+			return line, nil
+		}
+
+		m.mu.RLock()
+		running := session.IsRunning
+		m.mu.RUnlock()
+		if !running {
+			return "", fmt.Errorf("session ended before output matched %q", pattern)
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out after %v waiting for output matching %q", timeout, pattern)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// cleanLine turns a raw line of pane output into what the terminal showed:
+// escape sequences dropped and text before a carriage return overwritten.
+func cleanLine(raw string) string {
+	line := strings.TrimRight(ansiPattern.ReplaceAllString(raw, ""), "\r\n")
+	return line[strings.LastIndex(line, "\r")+1:]
+}
+
 // Kill terminates a session
 func (m *Manager) Kill(sessionID string) error {
 	m.mu.Lock()
@@ -220,9 +592,12 @@ func (m *Manager) Kill(sessionID string) error {
 	if !ok {
 		return fmt.Errorf("session not found: %s", sessionID)
 	}
+	return m.killLocked(session)
+}
 
+func (m *Manager) killLocked(session *Session) error {
 	// Kill tmux session
-	cmd := exec.Command("tmux", "kill-session", "-t", sessionID)
+	cmd := exec.Command("tmux", "kill-session", "-t", session.ID)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to kill session: %w", err)
 	}
@@ -238,7 +613,7 @@ func (m *Manager) Kill(sessionID string) error {
 // RunInSession runs a command in a session and waits for completion
 func (m *Manager) RunInSession(ctx context.Context, sessionID, command string, output chan<- string) (int, error) {
 	m.mu.RLock()
-	session, ok := m.sessions[sessionID]
+	_, ok := m.sessions[sessionID]
 	m.mu.RUnlock()
 
 	if !ok {
@@ -288,7 +663,107 @@ func (m *Manager) Cleanup() {
 	for id, session := range m.sessions {
 		if !session.IsRunning && session.CreatedAt.Before(cutoff) {
 			os.Remove(session.LogFile)
+			os.Remove(session.HistoryFile)
 			delete(m.sessions, id)
 		}
 	}
 }
+
+// envNamePattern matches names a shell can export.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// tmuxSupportsEnvFlag reports whether tmux is new enough (3.2) for new-session -e.
+func tmuxSupportsEnvFlag() bool {
+	out, err := exec.Command("tmux", "-V").Output()
+	if err != nil {
+		return false
+	}
+	// e.g. "tmux 3.2a", "tmux next-3.4"
+	version := strings.TrimSpace(strings.TrimPrefix(string(out), "tmux "))
+	version = strings.TrimPrefix(version, "next-")
+	parts := strings.SplitN(version, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, _ := strconv.Atoi(strings.TrimRight(parts[1], "abcdefghijklmnopqrstuvwxyz"))
+	return major > 3 || (major == 3 && minor >= 2)
+}
+
+// Environment returns a session's environment as tmux sees it, with the
+// session's own variables on top.
+func (m *Manager) Environment(sessionID string) (map[string]string, error) {
+	m.mu.RLock()
+	session, ok := m.sessions[sessionID]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	env := make(map[string]string)
+	if output, err := exec.Command("tmux", "show-environment", "-t", sessionID).Output(); err == nil {
+		for _, line := range strings.Split(string(output), "\n") {
+			// "-NAME" marks a variable removed from the session
+			if parts := strings.SplitN(line, "=", 2); len(parts) == 2 && !strings.HasPrefix(line, "-") {
+				env[parts[0]] = parts[1]
+			}
+		}
+	}
+
+	m.mu.RLock()
+	for k, v := range session.Env {
+		env[k] = v
+	}
+	m.mu.RUnlock()
+	return env, nil
+}
+
+// SetEnvironment sets the variables in set and removes those in unset.
+// tmux applies them to windows created afterwards; the running shell is
+// not changed.
+func (m *Manager) SetEnvironment(sessionID string, set map[string]string, unset []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if session.Env == nil {
+		session.Env = make(map[string]string)
+	}
+
+	for _, k := range sortedKeys(set) {
+		if !envNamePattern.MatchString(k) {
+			return fmt.Errorf("invalid environment variable name: %q", k)
+		}
+		if err := exec.Command("tmux", "set-environment", "-t", sessionID, k, set[k]).Run(); err != nil {
+			return fmt.Errorf("failed to set %s: %w", k, err)
+		}
+		session.Env[k] = set[k]
+	}
+	for _, k := range unset {
+		if err := exec.Command("tmux", "set-environment", "-t", sessionID, "-r", k).Run(); err != nil {
+			return fmt.Errorf("failed to unset %s: %w", k, err)
+		}
+		delete(session.Env, k)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shellQuote wraps s in single quotes for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -15,6 +15,12 @@ Commands:
 - screenshot: Take screenshot
 - evaluate: Run JavaScript
 - wait: Wait for selector
+- get_console: Get console messages collected since the last call
+- get_storage: Read localStorage/sessionStorage for the current origin
+- set_storage: Write localStorage/sessionStorage for the current origin
+- save_state: Capture cookies + localStorage as a storage_state blob
+- load_state: Open a fresh context pre-loaded with a storage_state blob
+- download: Trigger a download (click selector or goto url) and save it
 - close: Close browser
 """
 
@@ -22,6 +28,9 @@ import sys
 import json
 import asyncio
 import base64
+import time
+import os
+import tempfile
 from playwright.async_api import async_playwright, Browser, Page, BrowserContext
 
 # Global state
@@ -29,11 +38,37 @@ browser: Browser = None
 context: BrowserContext = None
 page: Page = None
 playwright = None
+launch_mode = None  # "connected" when attached to the user's Chrome over CDP
+
+# Console messages collected since the last get_console
+console_messages = []
+MAX_CONSOLE_MESSAGES = 1000
+
+
+def record_console(level: str, text: str, location: dict = None):
+    """Buffer a console message, dropping the oldest when full."""
+    location = location or {}
+    console_messages.append({
+        "level": level,
+        "text": text,
+        "url": location.get("url", ""),
+        "line": location.get("lineNumber", 0),
+        "column": location.get("columnNumber", 0),
+        "timestamp": time.time(),
+    })
+    if len(console_messages) > MAX_CONSOLE_MESSAGES:
+        del console_messages[:len(console_messages) - MAX_CONSOLE_MESSAGES]
+
+
+def attach_console(p: Page):
+    """Hook console output and uncaught page errors."""
+    p.on("console", lambda msg: record_console(msg.type, msg.text, msg.location))
+    p.on("pageerror", lambda err: record_console("error", str(err)))
 
 
 async def handle_command(cmd: dict) -> dict:
     """Handle a single command."""
-    global browser, context, page, playwright
+    global browser, context, page, playwright, launch_mode
     
     action = cmd.get("action")
     
@@ -64,12 +99,16 @@ async def handle_command(cmd: dict) -> dict:
                     else:
                         context = await browser.new_context()
                         page = await context.new_page()
+                    attach_console(page)
+                    launch_mode = "connected"
                     return {"success": True, "message": f"Connected to Chrome on port {chrome_port}", "mode": "connected"}
                 except Exception as e:
                     # Fall back to launching Playwright's own Chromium (separate from user's Chrome)
                     browser = await playwright.chromium.launch(headless=False)
                     context = await browser.new_context(viewport={"width": 1280, "height": 800})
                     page = await context.new_page()
+                    attach_console(page)
+                    launch_mode = "playwright"
                     return {"success": True, "message": "Launched Playwright Chromium (your Chrome is unaffected)", "mode": "playwright"}
             else:
                 # Use Playwright's own browser (fresh, no logins)
@@ -79,6 +118,8 @@ async def handle_command(cmd: dict) -> dict:
                     user_agent="Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36"
                 )
                 page = await context.new_page()
+                attach_console(page)
+                launch_mode = "playwright"
                 return {"success": True, "message": "Fresh browser launched", "mode": "playwright"}
         
         elif action == "goto":
@@ -182,6 +223,95 @@ async def handle_command(cmd: dict) -> dict:
                     texts.append(text.strip())
             return {"success": True, "elements": texts, "count": len(elements)}
         
+        elif action == "get_console":
+            if not page:
+                return {"success": False, "error": "Browser not launched"}
+            messages = console_messages[:]
+            console_messages.clear()
+            return {"success": True, "console": messages, "count": len(messages)}
+        
+        elif action == "get_storage":
+            if not page:
+                return {"success": False, "error": "Browser not launched"}
+            storage = await page.evaluate("""() => {
+                const dump = (s) => {
+                    const out = {};
+                    for (let i = 0; i < s.length; i++) {
+                        const key = s.key(i);
+                        out[key] = s.getItem(key);
+                    }
+                    return out;
+                };
+                return {
+                    origin: window.location.origin,
+                    local_storage: dump(window.localStorage),
+                    session_storage: dump(window.sessionStorage),
+                };
+            }""")
+            return {"success": True, "storage": storage}
+        
+        elif action == "set_storage":
+            if not page:
+                return {"success": False, "error": "Browser not launched"}
+            storage = cmd.get("storage") or {}
+            origin = await page.evaluate("""([local, session, clear]) => {
+                if (clear) {
+                    window.localStorage.clear();
+                    window.sessionStorage.clear();
+                }
+                for (const [k, v] of Object.entries(local || {})) window.localStorage.setItem(k, v);
+                for (const [k, v] of Object.entries(session || {})) window.sessionStorage.setItem(k, v);
+                return window.location.origin;
+            }""", [storage.get("local_storage"), storage.get("session_storage"), cmd.get("clear", False)])
+            return {"success": True, "message": f"Storage updated for {origin}"}
+        
+        elif action == "save_state":
+            if not context:
+                return {"success": False, "error": "Browser not launched"}
+            state = await context.storage_state()
+            return {"success": True, "state": state}
+        
+        elif action == "load_state":
+            state = cmd.get("state")
+            if not state:
+                return {"success": False, "error": "state required"}
+            if browser is None:
+                playwright = await async_playwright().start()
+                browser = await playwright.chromium.launch(headless=cmd.get("headless", False))
+                launch_mode = "playwright"
+            elif context is not None and launch_mode != "connected":
+                # Never close the user's own Chrome context
+                await context.close()
+            context = await browser.new_context(viewport={"width": 1280, "height": 800}, storage_state=state)
+            page = await context.new_page()
+            attach_console(page)
+            return {"success": True, "message": f"Context loaded with {len(state.get('cookies', []))} cookies"}
+        
+        elif action == "download":
+            selector = cmd.get("selector")
+            url = cmd.get("url")
+            timeout = cmd.get("timeout", 60000)
+            if not page:
+                return {"success": False, "error": "Browser not launched"}
+            if not selector and not url:
+                return {"success": False, "error": "selector or url required"}
+            async with page.expect_download(timeout=timeout) as download_info:
+                if selector:
+                    await page.click(selector, timeout=10000)
+                else:
+                    try:
+                        await page.goto(url)
+                    except Exception:
+                        pass  # Navigating to a file raises "Download is starting"
+            download = await download_info.value
+            failure = await download.failure()
+            if failure:
+                return {"success": False, "error": f"Download failed: {failure}"}
+            path = cmd.get("path") or os.path.join(
+                tempfile.mkdtemp(prefix="ultron-download-"), download.suggested_filename)
+            await download.save_as(path)
+            return {"success": True, "path": path, "filename": download.suggested_filename, "url": download.url}
+        
         elif action == "close":
             if browser:
                 await browser.close()
@@ -191,6 +321,7 @@ async def handle_command(cmd: dict) -> dict:
             context = None
             page = None
             playwright = None
+            launch_mode = None
             return {"success": True, "message": "Browser closed"}
         
         elif action == "ping":
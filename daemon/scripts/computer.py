@@ -22,6 +22,7 @@ import base64
 import subprocess
 import shutil
 import re
+import io
 
 # The dimensions we tell Claude about (must match brain.py's display_width_px/display_height_px)
 # Anthropic's quickstart recommends 1024x768
@@ -194,6 +195,44 @@ def take_screenshot():
         return None, f"Failed to read screenshot: {e}"
 
 
+def compare_screenshots(before_b64, after_b64, tolerance):
+    """Compare two base64 screenshots pixel by pixel.
+
+    A pixel counts as changed when any channel differs by more than tolerance
+    (0-255), which absorbs compression noise and cursor blink antialiasing.
+    The bounding box is in the coordinates of the second (current) image, i.e.
+    API coordinates for screenshots taken here. Needs Pillow.
+    """
+    from PIL import Image, ImageChops
+
+    before = Image.open(io.BytesIO(base64.b64decode(before_b64))).convert("RGB")
+    after = Image.open(io.BytesIO(base64.b64decode(after_b64))).convert("RGB")
+    if before.size != after.size:
+        # e.g. a baseline that was shrunk on its way to Prime
+        before = before.resize(after.size)
+
+    r, g, b = ImageChops.difference(before, after).split()
+    worst = ImageChops.lighter(ImageChops.lighter(r, g), b)
+    mask = worst.point(lambda v: 255 if v > tolerance else 0)
+
+    total = after.width * after.height
+    changed = mask.histogram()[255]
+    box = mask.getbbox()
+    return {
+        "similarity": round(1 - changed / total, 6),
+        "changed": changed > 0,
+        "changed_pixels": changed,
+        "total_pixels": total,
+        "tolerance": tolerance,
+        "bbox": {
+            "x": box[0],
+            "y": box[1],
+            "width": box[2] - box[0],
+            "height": box[3] - box[1],
+        } if box else None,
+    }
+
+
 def cliclick_move_and_click(screen_x, screen_y, click_type="c"):
     """Move mouse and click using cliclick."""
     try:
@@ -539,6 +578,32 @@ async def handle_command(cmd: dict) -> dict:
             img_data, _ = take_screenshot()
             return {"success": True, "base64_image": img_data}
 
+        # === Screenshot diff: did the screen change, and where? ===
+        # Compares against baseline (a base64 screenshot) if given, otherwise
+        # against a screenshot taken interval seconds before this one
+        elif action == "screenshot_diff":
+            baseline = cmd.get("baseline")
+            tolerance = int(cmd.get("tolerance", 16))
+            if not baseline:
+                baseline, err = take_screenshot()
+                if err:
+                    return {"success": False, "error": err}
+                await asyncio.sleep(float(cmd.get("interval", 1.0)))
+            img_data, err = take_screenshot()
+            if err:
+                return {"success": False, "error": err}
+            try:
+                diff = compare_screenshots(baseline, img_data, tolerance)
+            except ImportError:
+                return {"success": False, "error": "screenshot_diff needs Pillow (run setup_computer.sh)"}
+            return {
+                "success": True,
+                "diff": diff,
+                "base64_image": img_data,
+                "display_width": API_WIDTH,
+                "display_height": API_HEIGHT,
+            }
+
         # === Cursor position (no screenshot) ===
         elif action == "cursor_position":
             if has_command("cliclick"):
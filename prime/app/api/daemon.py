@@ -6,7 +6,7 @@ These REST endpoints are for monitoring and management only.
 """
 
 import logging
-from fastapi import APIRouter, HTTPException, Request
+from fastapi import APIRouter, HTTPException, Request, WebSocket
 from pydantic import BaseModel
 from typing import List, Optional
 from datetime import datetime
@@ -164,6 +164,48 @@ async def execute_command(daemon_id: str, cmd: CommandRequest, request: Request)
         raise HTTPException(status_code=500, detail=str(e))
 
 
+class ForwardRequest(BaseModel):
+    """Request to forward a port on Prime to a target the daemon can reach."""
+    target: str  # host:port, as the daemon sees it
+    port: int = 0  # Local port on Prime; 0 picks a free one
+    bind: str = "127.0.0.1"
+
+
+@router.post("/{daemon_id}/forward")
+async def start_port_forward(daemon_id: str, fwd: ForwardRequest, request: Request):
+    """Forward a local port on Prime through a daemon (needs its "network" capability)."""
+    registry = getattr(request.app.state, 'daemon_registry', None)
+    if not registry:
+        raise HTTPException(status_code=500, detail="Registry not initialized")
+    
+    if not registry.is_connected(daemon_id):
+        raise HTTPException(status_code=404, detail=f"Daemon {daemon_id} not connected")
+    
+    try:
+        from app.grpc_server import forward_port
+        forward = await forward_port(daemon_id, fwd.target, host=fwd.bind, port=fwd.port)
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=str(e))
+    
+    return {
+        "daemon_id": forward.daemon_id,
+        "target": forward.target,
+        "host": forward.host,
+        "port": forward.port,
+    }
+
+
+@router.delete("/{daemon_id}/forward/{port}")
+async def stop_port_forward(daemon_id: str, port: int):
+    """Stop a port forward started with POST /{daemon_id}/forward."""
+    from app.grpc_server import port_forwards, close_port_forward
+    forward = port_forwards.get(port)
+    if not forward or forward.daemon_id != daemon_id:
+        raise HTTPException(status_code=404, detail=f"No port forward on {port} for {daemon_id}")
+    close_port_forward(port)
+    return {"daemon_id": daemon_id, "port": port, "stopped": True}
+
+
 @router.post("/{daemon_id}/ping")
 async def ping_daemon(daemon_id: str, request: Request):
     """Ping a daemon to check connectivity."""
@@ -190,6 +232,16 @@ async def ping_daemon(daemon_id: str, request: Request):
     }
 
 
+@router.websocket("/ws")
+async def daemon_websocket(websocket: WebSocket):
+    """Daemon connection over WebSocket, for daemons that can only reach Prime over HTTP(S)."""
+    if not settings.daemon_websocket:
+        await websocket.close(code=1008, reason="WebSocket daemon connections are disabled (DAEMON_WEBSOCKET)")
+        return
+    from app.grpc_server import handle_daemon_websocket
+    await handle_daemon_websocket(websocket)
+
+
 @router.get("/connection-info")
 async def connection_info(request: Request):
     """Get connection information for daemons."""
@@ -198,5 +250,6 @@ async def connection_info(request: Request):
         "port": settings.daemon_port,
         "protocol": "tcp+json",
         "registration_key_required": bool(settings.daemon_registration_key),
+        "websocket_path": "/api/daemon/ws" if settings.daemon_websocket else None,
         "message": f"Daemons should connect to port {settings.daemon_port} using bidirectional TCP",
     }
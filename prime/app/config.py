@@ -67,8 +67,15 @@ class Settings(BaseSettings):
     daemon_registration_key: str = ""
     daemon_port: int = 50051  # Port for daemon bidirectional connections
     grpc_port: int = 50051  # Alias for daemon_port (legacy)
+    daemon_idle_timeout: int = 90  # Seconds without any message before a daemon connection is dropped (daemons heartbeat every 30s)
+    daemon_keepalive_idle: int = 30  # Seconds idle before TCP keepalive probes start
+    daemon_keepalive_interval: int = 10  # Seconds between keepalive probes
+    daemon_keepalive_count: int = 3  # Failed probes before the OS drops the connection
+    daemon_message_mac: bool = False  # HMAC every message to and from daemons (daemons must enable it too)
+    daemon_websocket: bool = False  # Also accept daemon connections over WebSocket at /api/daemon/ws
     
     # TLS
+    daemon_tls: bool = False  # Serve daemon connections over TLS using the cert/key below
     tls_cert_path: str = "certs/server.crt"
     tls_key_path: str = "certs/server.key"
 
@@ -715,7 +715,7 @@ async def think(
                                 "type": "image",
                                 "source": {
                                     "type": "base64",
-                                    "media_type": "image/png",
+                                    "media_type": tool_result.get("media_type", "image/png"),
                                     "data": tool_result["base64_image"],
                                 }
                             })
@@ -6,7 +6,12 @@ This enables daemons behind NAT to work without port forwarding.
 """
 
 import asyncio
+import base64
+import hashlib
+import hmac
 import logging
+import socket
+import ssl
 import uuid
 from datetime import datetime
 from typing import Optional, Dict, Any, Callable, Awaitable
@@ -28,6 +33,7 @@ class CommandType(str, Enum):
     READ_FILE = "read_file"
     WRITE_FILE = "write_file"
     DELETE_FILE = "delete_file"
+    MOVE_FILE = "move_file"
     LIST_FILES = "list_files"
     LIST_PROCESSES = "list_processes"
     KILL_PROCESS = "kill_process"
@@ -40,6 +46,7 @@ class CommandType(str, Enum):
     SYSTEM_INFO = "system_info"
     SELF_MODIFY = "self_modify"
     PING = "ping"
+    TUNNEL_OPEN = "tunnel_open"
 
 
 @dataclass
@@ -50,6 +57,7 @@ class PendingCommand:
     parameters: Dict[str, Any]
     created_at: datetime
     future: asyncio.Future
+    on_partial: Optional[Callable[[Dict[str, Any]], None]] = None  # Called with each partial_result
 
 
 @dataclass
@@ -64,6 +72,10 @@ class DaemonConnection:
     connected_at: datetime
     last_seen: datetime
     status: str
+    partial_results: bool = False  # Daemon can stream partial_result frames
+    multiplex: bool = False  # Daemon splits large messages into stream_frames
+    max_concurrent: int = 0  # Commands the daemon runs at once (0 = unlimited)
+    read_only: bool = False  # Daemon refuses anything that could change its host
     
     # The queue for sending commands to this daemon
     command_queue: asyncio.Queue = field(default_factory=asyncio.Queue)
@@ -71,6 +83,9 @@ class DaemonConnection:
     # Pending commands waiting for response
     pending_commands: Dict[str, PendingCommand] = field(default_factory=dict)
     
+    # Open port-forward tunnels, by tunnel_id
+    tunnels: Dict[str, "DaemonTunnel"] = field(default_factory=dict)
+    
     # Heartbeat info
     cpu_percent: float = 0.0
     memory_percent: float = 0.0
@@ -78,6 +93,58 @@ class DaemonConnection:
     active_tasks: int = 0
 
 
+class DaemonTunnel:
+    """
+    A TCP connection the daemon has opened to a target on Prime's behalf.
+    Frames are described in daemon/internal/primeclient/tunnel.go.
+    """
+    
+    def __init__(self, conn: DaemonConnection, tunnel_id: str, target: str):
+        self.conn = conn
+        self.tunnel_id = tunnel_id
+        self.target = target
+        self.closed = False
+        self.error: Optional[str] = None  # Why the daemon closed it, if it said
+        # Data from the daemon; b"" marks the end
+        self._incoming: asyncio.Queue = asyncio.Queue()
+    
+    async def read(self) -> bytes:
+        """Next chunk from the target, or b"" once the tunnel is closed."""
+        data = await self._incoming.get()
+        if not data:
+            self._incoming.put_nowait(b"")  # Keep reporting the end to later reads
+        return data
+    
+    async def write(self, data: bytes):
+        """Send data to the target."""
+        if self.closed:
+            raise ConnectionError(f"Tunnel to {self.target} is closed")
+        await self.conn.command_queue.put({
+            "type": "tunnel_data",
+            "tunnel_id": self.tunnel_id,
+            "data": base64.b64encode(data).decode('ascii'),
+        })
+    
+    async def close(self):
+        """Close the tunnel and tell the daemon to drop its connection."""
+        if self._finish():
+            await self.conn.command_queue.put({"type": "tunnel_close", "tunnel_id": self.tunnel_id})
+    
+    def _feed(self, data: bytes):
+        if data and not self.closed:
+            self._incoming.put_nowait(data)
+    
+    def _finish(self, error: Optional[str] = None) -> bool:
+        """Mark the tunnel closed and wake readers; False if it already was."""
+        if self.closed:
+            return False
+        self.closed = True
+        self.error = error
+        self.conn.tunnels.pop(self.tunnel_id, None)
+        self._incoming.put_nowait(b"")
+        return True
+
+
 class DaemonRegistry:
     """
     Registry of all connected daemons.
@@ -97,6 +164,10 @@ class DaemonRegistry:
         capabilities: list[str],
         is_soul_daemon: bool = False,
         ultron_root: Optional[str] = None,
+        partial_results: bool = False,
+        multiplex: bool = False,
+        max_concurrent: int = 0,
+        read_only: bool = False,
     ) -> Optional[DaemonConnection]:
         """Register a new daemon connection."""
         
@@ -119,6 +190,10 @@ class DaemonRegistry:
                 connected_at=datetime.utcnow(),
                 last_seen=datetime.utcnow(),
                 status="connected",
+                partial_results=partial_results,
+                multiplex=multiplex,
+                max_concurrent=max_concurrent,
+                read_only=read_only,
             )
             
             self.connections[daemon_id] = conn
@@ -150,6 +225,13 @@ class DaemonRegistry:
                 for cmd in conn.pending_commands.values():
                     if not cmd.future.done():
                         cmd.future.set_exception(Exception("Daemon disconnected"))
+                
+                # The daemon drops its tunnels with the connection
+                for tunnel in list(conn.tunnels.values()):
+                    tunnel._finish("Daemon disconnected")
+                for port, forward in list(port_forwards.items()):
+                    if forward.daemon_id == daemon_id:
+                        close_port_forward(port)
     
     def get(self, daemon_id: str) -> Optional[DaemonConnection]:
         """Get daemon connection by ID."""
@@ -184,15 +266,21 @@ class DaemonRegistry:
         command_type: CommandType,
         parameters: Dict[str, Any],
         timeout: float = 60.0,
+        on_partial: Optional[Callable[[Dict[str, Any]], None]] = None,
     ) -> Dict[str, Any]:
         """
         Send a command to a daemon and wait for the result.
         
+        on_partial, if given, is called with each partial_result the daemon
+        streams before the final result (e.g. shell output as it's produced).
+        
         Returns the command result or raises an exception on timeout/error.
         """
         conn = self.connections.get(daemon_id)
         if not conn:
             raise Exception(f"Daemon {daemon_id} not connected")
+        if conn.status == "draining":
+            raise Exception(f"Daemon {conn.name} is shutting down")
         
         # Create pending command
         command_id = str(uuid.uuid4())
@@ -204,15 +292,18 @@ class DaemonRegistry:
             parameters=parameters,
             created_at=datetime.utcnow(),
             future=future,
+            on_partial=on_partial,
         )
         
         conn.pending_commands[command_id] = pending
         
-        # Build command message
+        # Build command message. Partial results are only useful when someone
+        # is listening, so ask for them only then.
         command = {
             "command_id": command_id,
             "type": command_type.value,
             **parameters,
+            "stream": on_partial is not None,
         }
         
         # Queue the command
@@ -230,6 +321,90 @@ class DaemonRegistry:
             # Clean up pending command
             conn.pending_commands.pop(command_id, None)
     
+    async def open_tunnel(
+        self,
+        daemon_id: str,
+        target: str,
+        timeout: float = 15.0,
+    ) -> DaemonTunnel:
+        """
+        Have a daemon open a TCP connection to target (host:port, as the
+        daemon sees it) and return a tunnel to it. The daemon needs the
+        "network" capability.
+        """
+        conn = self.connections.get(daemon_id)
+        if not conn:
+            raise Exception(f"Daemon {daemon_id} not connected")
+        if conn.status == "draining":
+            raise Exception(f"Daemon {conn.name} is shutting down")
+        
+        command_id = str(uuid.uuid4())
+        future = asyncio.get_event_loop().create_future()
+        conn.pending_commands[command_id] = PendingCommand(
+            command_id=command_id,
+            command_type=CommandType.TUNNEL_OPEN,
+            parameters={"target": target},
+            created_at=datetime.utcnow(),
+            future=future,
+        )
+        
+        # Registered before the open goes out: the daemon starts reading from
+        # the target before it sends its result, so data can arrive first
+        tunnel = DaemonTunnel(conn, command_id, target)
+        conn.tunnels[command_id] = tunnel
+        
+        await conn.command_queue.put({
+            "type": CommandType.TUNNEL_OPEN.value,
+            "command_id": command_id,
+            "tunnel_id": command_id,
+            "target": target,
+        })
+        
+        try:
+            result = await asyncio.wait_for(future, timeout=timeout)
+        except asyncio.TimeoutError:
+            await tunnel.close()
+            raise Exception(f"Tunnel to {target} not opened after {timeout}s")
+        except Exception:
+            tunnel._finish("Daemon disconnected")
+            raise
+        finally:
+            conn.pending_commands.pop(command_id, None)
+        
+        if not result.get("success"):
+            error = result.get("error", "unknown error")
+            tunnel._finish(error)
+            raise Exception(f"Could not open tunnel to {target}: {error}")
+        
+        logger.info(f"Tunnel {command_id} opened to {target} via {conn.name}")
+        return tunnel
+    
+    def handle_tunnel_data(self, daemon_id: str, message: Dict[str, Any]):
+        """Handle data the daemon read from a tunnel's target."""
+        conn = self.connections.get(daemon_id)
+        if not conn:
+            return
+        
+        tunnel = conn.tunnels.get(message.get("tunnel_id", ""))
+        if not tunnel:
+            return
+        
+        try:
+            tunnel._feed(base64.b64decode(message.get("data", "")))
+        except ValueError as e:
+            logger.warning(f"Bad tunnel data from {daemon_id}: {e}")
+    
+    def handle_tunnel_close(self, daemon_id: str, message: Dict[str, Any]):
+        """Handle the daemon closing a tunnel, e.g. because the target hung up."""
+        conn = self.connections.get(daemon_id)
+        if not conn:
+            return
+        
+        tunnel = conn.tunnels.get(message.get("tunnel_id", ""))
+        if tunnel:
+            tunnel._finish(message.get("error"))
+            logger.info(f"Tunnel {tunnel.tunnel_id} to {tunnel.target} closed by {conn.name}")
+    
     def handle_result(self, daemon_id: str, result: Dict[str, Any]):
         """Handle a command result from a daemon."""
         conn = self.connections.get(daemon_id)
@@ -251,6 +426,21 @@ class DaemonRegistry:
             pending.future.set_result(result)
             logger.debug(f"Command {command_id} completed for {daemon_id}")
     
+    def handle_partial_result(self, daemon_id: str, partial: Dict[str, Any]):
+        """Handle incremental output for a command that is still running."""
+        conn = self.connections.get(daemon_id)
+        if not conn:
+            return
+        
+        pending = conn.pending_commands.get(partial.get("command_id", ""))
+        if not pending or not pending.on_partial or pending.future.done():
+            return
+        
+        try:
+            pending.on_partial(partial)
+        except Exception as e:
+            logger.error(f"Partial result callback failed for {pending.command_id}: {e}")
+    
     def handle_heartbeat(self, daemon_id: str, heartbeat: Dict[str, Any]):
         """Handle a heartbeat from a daemon."""
         conn = self.connections.get(daemon_id)
@@ -263,6 +453,17 @@ class DaemonRegistry:
         conn.disk_percent = heartbeat.get("disk_percent", 0.0)
         conn.active_tasks = heartbeat.get("active_tasks", 0)
     
+    def handle_status(self, daemon_id: str, message: Dict[str, Any]):
+        """Handle a lifecycle status change, e.g. a daemon draining before shutdown."""
+        conn = self.connections.get(daemon_id)
+        if not conn:
+            return
+        conn.status = message.get("status", conn.status)
+        logger.info(
+            f"Daemon {conn.name} is {conn.status} "
+            f"({message.get('active_tasks', 0)} command(s) still running)"
+        )
+    
     def handle_alert(self, daemon_id: str, alert: Dict[str, Any]):
         """Handle an alert from a daemon."""
         conn = self.connections.get(daemon_id)
@@ -321,6 +522,20 @@ class DaemonRegistry:
 daemon_registry = DaemonRegistry()
 
 
+@dataclass
+class PortForward:
+    """A listener on Prime whose connections are tunneled to target through a daemon."""
+    daemon_id: str
+    target: str
+    host: str
+    port: int
+    server: asyncio.AbstractServer
+
+
+# Active port forwards, by local port
+port_forwards: Dict[int, PortForward] = {}
+
+
 class PrimeServicer:
     """
     gRPC servicer for PrimeService.
@@ -463,19 +678,37 @@ async def handle_daemon_connection(
     
     daemon_id = None
     daemon_conn = None
+    streams: Dict[int, _Stream] = {}  # Large messages being reassembled, by stream_id
+    mac = _FrameMAC() if settings.daemon_message_mac else None
     peer = writer.get_extra_info('peername')
     logger.info(f"New connection from {peer}")
+    _enable_keepalive(writer.get_extra_info('socket'))
     
     try:
         while True:
-            # Read message length (4 bytes, big-endian)
-            length_bytes = await reader.readexactly(4)
+            # Read message length (4 bytes, big-endian). Daemons heartbeat
+            # regularly, so a long silence means a zombie connection.
+            length_bytes = await asyncio.wait_for(
+                reader.readexactly(4),
+                timeout=settings.daemon_idle_timeout or None,
+            )
             length = int.from_bytes(length_bytes, 'big')
             
             # Read message
             data = await reader.readexactly(length)
+            if mac:
+                data = mac.verify(data)
+                if data is None:
+                    logger.warning(f"Message from {peer} failed authentication, dropping connection")
+                    break
             message = json.loads(data.decode('utf-8'))
             
+            # A chunk of a large message; handle the message once it's whole
+            if message.get("type") == "stream_frame" and daemon_id:
+                message = _reassemble_frame(streams, message)
+                if message is None:
+                    continue
+            
             msg_type = message.get("type")
             
             # Handle registration
@@ -487,6 +720,10 @@ async def handle_daemon_connection(
                     capabilities=message.get("capabilities", []),
                     is_soul_daemon=message.get("is_soul_daemon", False),
                     ultron_root=message.get("ultron_root"),
+                    partial_results=message.get("partial_results", False),
+                    multiplex=message.get("multiplex", False),
+                    max_concurrent=message.get("max_concurrent", 0),
+                    read_only=message.get("read_only", False),
                 )
                 
                 if daemon_conn:
@@ -496,10 +733,12 @@ async def handle_daemon_connection(
                         "success": True,
                         "daemon_id": daemon_id,
                         "message": f"Welcome, {daemon_conn.name}!",
+                        "partial_results": daemon_conn.partial_results,
+                        "multiplex": daemon_conn.multiplex,
                     }
                     
                     # Start command sender
-                    asyncio.create_task(_command_sender(daemon_conn, writer))
+                    asyncio.create_task(_command_sender(daemon_conn, writer, mac))
                 else:
                     response = {
                         "type": "registration_ack",
@@ -507,7 +746,7 @@ async def handle_daemon_connection(
                         "message": "Invalid registration key",
                     }
                 
-                await _send_message(writer, response)
+                await _send_message(writer, response, mac)
                 
                 if not daemon_conn:
                     break
@@ -516,12 +755,33 @@ async def handle_daemon_connection(
             elif msg_type == "heartbeat":
                 if daemon_id:
                     daemon_registry.handle_heartbeat(daemon_id, message)
+                    # Ack so the daemon can detect a dead connection quickly
+                    await _send_message(writer, {"type": "heartbeat_ack"}, mac)
             
             # Handle result
             elif msg_type == "result":
                 if daemon_id:
                     daemon_registry.handle_result(daemon_id, message)
             
+            # Handle streamed output for a running command (arrives in seq order)
+            elif msg_type == "partial_result":
+                if daemon_id:
+                    daemon_registry.handle_partial_result(daemon_id, message)
+            
+            # Handle port-forward tunnel traffic (see DaemonTunnel)
+            elif msg_type == "tunnel_data":
+                if daemon_id:
+                    daemon_registry.handle_tunnel_data(daemon_id, message)
+            
+            elif msg_type == "tunnel_close":
+                if daemon_id:
+                    daemon_registry.handle_tunnel_close(daemon_id, message)
+            
+            # Handle lifecycle status (draining before shutdown)
+            elif msg_type == "status":
+                if daemon_id:
+                    daemon_registry.handle_status(daemon_id, message)
+            
             # Handle alert
             elif msg_type == "alert":
                 if daemon_id:
@@ -529,6 +789,8 @@ async def handle_daemon_connection(
     
     except asyncio.IncompleteReadError:
         logger.info(f"Connection closed by {peer}")
+    except asyncio.TimeoutError:
+        logger.warning(f"No messages from {peer} for {settings.daemon_idle_timeout}s, dropping connection")
     except Exception as e:
         logger.error(f"Connection error from {peer}: {e}")
     finally:
@@ -538,31 +800,210 @@ async def handle_daemon_connection(
         await writer.wait_closed()
 
 
-async def _send_message(writer: asyncio.StreamWriter, message: dict):
-    """Send a JSON message with length prefix."""
+# Largest message reassembled from stream_frames (the daemon's default PRIME_MAX_SEND_BYTES)
+_MAX_STREAM_BYTES = 64 * 1024 * 1024
+
+
+@dataclass
+class _Stream:
+    """A large message arriving as stream_frames."""
+    next_seq: int = 0
+    data: bytearray = field(default_factory=bytearray)
+
+
+def _reassemble_frame(streams: Dict[int, _Stream], frame: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+    """
+    Add a stream_frame's chunk to its stream (see daemon/internal/primeclient/mux.go)
+    and return the whole message once the final frame is in, else None.
+    Frames of one stream arrive in seq order, interleaved with other messages.
+    """
+    import json
+    stream_id = frame.get("stream_id")
+    stream = streams.setdefault(stream_id, _Stream())
+    if frame.get("seq") != stream.next_seq:
+        raise ValueError(f"stream {stream_id}: frame {frame.get('seq')} out of order, expected {stream.next_seq}")
+    
+    stream.data += base64.b64decode(frame.get("data", ""))
+    stream.next_seq += 1
+    if len(stream.data) > _MAX_STREAM_BYTES:
+        raise ValueError(f"stream {stream_id}: message larger than {_MAX_STREAM_BYTES} bytes")
+    
+    if not frame.get("final"):
+        return None
+    del streams[stream_id]
+    return json.loads(stream.data.decode('utf-8'))
+
+
+def _enable_keepalive(sock):
+    """Turn on TCP keepalive so connections silently dropped by NAT or load balancers are detected."""
+    if sock is None:
+        return
+    try:
+        sock.setsockopt(socket.SOL_SOCKET, socket.SO_KEEPALIVE, 1)
+        # Per-socket tuning isn't available on every platform
+        if hasattr(socket, "TCP_KEEPIDLE"):
+            sock.setsockopt(socket.IPPROTO_TCP, socket.TCP_KEEPIDLE, settings.daemon_keepalive_idle)
+        if hasattr(socket, "TCP_KEEPINTVL"):
+            sock.setsockopt(socket.IPPROTO_TCP, socket.TCP_KEEPINTVL, settings.daemon_keepalive_interval)
+        if hasattr(socket, "TCP_KEEPCNT"):
+            sock.setsockopt(socket.IPPROTO_TCP, socket.TCP_KEEPCNT, settings.daemon_keepalive_count)
+    except OSError as e:
+        logger.warning(f"Could not enable TCP keepalive: {e}")
+
+
+_MAC_SIZE = 32
+_SEQ_SIZE = 8
+_MAC_KEY_LABEL = b"ultron-message-mac-v2"
+_MAC_DAEMON_TO_PRIME = b"daemon->prime"
+_MAC_PRIME_TO_DAEMON = b"prime->daemon"
+
+
+def _mac_key() -> bytes:
+    """Derive the message MAC key from the registration key, as daemons do."""
+    return hmac.new(settings.daemon_registration_key.encode('utf-8'), _MAC_KEY_LABEL, hashlib.sha256).digest()
+
+
+class _FrameMAC:
+    """
+    MAC state for one connection (see daemon/internal/primeclient/mac.go).
+    Each frame carries a sequence number, and its MAC covers the direction,
+    the sequence number and the message, so frames can't be replayed or
+    reflected back to the daemon.
+    """
+
+    def __init__(self):
+        self._key = _mac_key()
+        self._send_seq = 0
+        self._recv_seq = 0
+
+    def _mac(self, direction: bytes, seq: int, data: bytes) -> bytes:
+        return hmac.new(self._key, direction + seq.to_bytes(_SEQ_SIZE, 'big') + data, hashlib.sha256).digest()
+
+    def sign(self, data: bytes) -> bytes:
+        """Append the next sequence number and the MAC to an outgoing message."""
+        self._send_seq += 1
+        return data + self._send_seq.to_bytes(_SEQ_SIZE, 'big') + self._mac(_MAC_PRIME_TO_DAEMON, self._send_seq, data)
+
+    def verify(self, payload: bytes) -> Optional[bytes]:
+        """Return the message in an incoming frame, or None if its MAC or sequence number is wrong."""
+        if len(payload) < _SEQ_SIZE + _MAC_SIZE:
+            return None
+        data = payload[:-_SEQ_SIZE - _MAC_SIZE]
+        seq = int.from_bytes(payload[len(data):len(data) + _SEQ_SIZE], 'big')
+        mac = payload[-_MAC_SIZE:]
+        if not hmac.compare_digest(mac, self._mac(_MAC_DAEMON_TO_PRIME, seq, data)):
+            return None
+        if seq != self._recv_seq + 1:
+            return None  # Stale, repeated or skipped frame
+        self._recv_seq = seq
+        return data
+
+
+async def _send_message(writer: asyncio.StreamWriter, message: dict, mac: Optional[_FrameMAC] = None):
+    """Send a JSON message with length prefix (and MAC, if enabled)."""
     import json
     data = json.dumps(message).encode('utf-8')
+    if mac:
+        data = mac.sign(data)
     length = len(data).to_bytes(4, 'big')
     writer.write(length + data)
     await writer.drain()
 
 
-async def _command_sender(conn: DaemonConnection, writer: asyncio.StreamWriter):
+async def _command_sender(conn: DaemonConnection, writer: asyncio.StreamWriter, mac: Optional[_FrameMAC] = None):
     """Send queued commands to the daemon."""
     try:
         while True:
             command = await conn.command_queue.get()
-            await _send_message(writer, command)
+            await _send_message(writer, command, mac)
     except Exception as e:
         logger.error(f"Command sender error for {conn.daemon_id}: {e}")
 
 
+class _WebSocketWriter:
+    """StreamWriter stand-in that sends each drained frame as one binary WebSocket message."""
+
+    def __init__(self, websocket):
+        self._websocket = websocket
+        self._buffer = bytearray()
+        self._lock = asyncio.Lock()
+
+    def write(self, data: bytes):
+        self._buffer += data
+
+    async def drain(self):
+        # Frames are written whole before draining, so the buffer never holds a partial one
+        async with self._lock:
+            data, self._buffer = bytes(self._buffer), bytearray()
+            if data:
+                await self._websocket.send_bytes(data)
+
+    def get_extra_info(self, name: str, default=None):
+        if name == 'peername' and self._websocket.client:
+            return (self._websocket.client.host, self._websocket.client.port)
+        return default
+
+    def close(self):
+        pass
+
+    async def wait_closed(self):
+        try:
+            await self._websocket.close()
+        except RuntimeError:
+            pass  # Already closed
+
+
+async def handle_daemon_websocket(websocket):
+    """
+    Handle a daemon connecting over WebSocket (PRIME_TRANSPORT=websocket on the
+    daemon). Binary messages carry the same length-prefixed frames as the TCP
+    connection, so they are fed to handle_daemon_connection unchanged.
+    """
+    from starlette.websockets import WebSocketDisconnect
+
+    await websocket.accept()
+    reader = asyncio.StreamReader()
+    writer = _WebSocketWriter(websocket)
+
+    async def pump():
+        try:
+            while True:
+                message = await websocket.receive()
+                if message["type"] == "websocket.disconnect":
+                    break
+                if message.get("bytes"):
+                    reader.feed_data(message["bytes"])
+        except (WebSocketDisconnect, RuntimeError):
+            pass
+        finally:
+            reader.feed_eof()
+
+    pump_task = asyncio.create_task(pump())
+    try:
+        await handle_daemon_connection(reader, writer)
+    finally:
+        pump_task.cancel()
+
+
 async def start_daemon_server(host: str = "0.0.0.0", port: int = 50051):
-    """Start the TCP server for daemon connections."""
+    """Start the TCP server for daemon connections.
+
+    With DAEMON_TLS set, connections use TLS with the certificate at
+    TLS_CERT_PATH; daemons must then set PRIME_TLS to connect.
+    """
+    ssl_context = None
+    if settings.daemon_tls:
+        ssl_context = ssl.create_default_context(ssl.Purpose.CLIENT_AUTH)
+        ssl_context.minimum_version = ssl.TLSVersion.TLSv1_2
+        ssl_context.load_cert_chain(settings.tls_cert_path, settings.tls_key_path)
+    else:
+        logger.warning("TLS is disabled for daemon connections; traffic is plaintext (set DAEMON_TLS=true outside development)")
+
     server = await asyncio.start_server(
         handle_daemon_connection,
         host,
         port,
+        ssl=ssl_context,
     )
     
     addr = server.sockets[0].getsockname()
@@ -607,9 +1048,26 @@ async def execute_shell(
     working_directory: str = "",
     timeout: float = 60.0,
     use_sudo: bool = False,
+    on_output: Optional[Callable[[str, str], None]] = None,
+    env: Optional[Dict[str, str]] = None,
 ) -> Dict[str, Any]:
-    """Execute a shell command on a daemon."""
+    """Execute a shell command on a daemon.
+    
+    env adds variables to the daemon's own environment, replacing any with
+    the same name.
+    
+    on_output, if given, is called as on_output(line, stream) for each line
+    of output as the command runs, where stream is "stdout" or "stderr".
+    The returned result still holds the full output.
+    """
     daemon_id = resolve_daemon(daemon_id_or_name)
+    
+    on_partial = None
+    if on_output:
+        def on_partial(partial: Dict[str, Any]):
+            for item in partial.get("output", []):
+                on_output(item.get("line", ""), item.get("stream", "stdout"))
+    
     return await daemon_registry.send_command(
         daemon_id,
         CommandType.SHELL,
@@ -617,11 +1075,95 @@ async def execute_shell(
             "command": command,
             "working_directory": working_directory,
             "use_sudo": use_sudo,
+            "timeout": timeout,
+            "env": env or {},
         },
-        timeout=timeout,
+        # Leave the daemon time to report its own timeout
+        timeout=timeout + 5,
+        on_partial=on_partial,
     )
 
 
+async def forward_port(
+    daemon_id_or_name: str,
+    target: str,
+    host: str = "127.0.0.1",
+    port: int = 0,
+) -> PortForward:
+    """Listen on host:port and tunnel each connection to target through a daemon.
+    
+    target is host:port as the daemon sees it, e.g. a database only reachable
+    from the daemon's network. port 0 picks a free port; the returned
+    PortForward has the one in use.
+    """
+    daemon_id = resolve_daemon(daemon_id_or_name)
+    if not daemon_registry.is_connected(daemon_id):
+        raise Exception(f"Daemon {daemon_id} not connected")
+    
+    async def handle(reader: asyncio.StreamReader, writer: asyncio.StreamWriter):
+        try:
+            tunnel = await daemon_registry.open_tunnel(daemon_id, target)
+        except Exception as e:
+            logger.warning(f"Port forward to {target} via {daemon_id} failed: {e}")
+            writer.close()
+            return
+        await _pump_tunnel(tunnel, reader, writer)
+    
+    server = await asyncio.start_server(handle, host, port)
+    forward = PortForward(
+        daemon_id=daemon_id,
+        target=target,
+        host=host,
+        port=server.sockets[0].getsockname()[1],
+        server=server,
+    )
+    port_forwards[forward.port] = forward
+    logger.info(f"Forwarding {host}:{forward.port} to {target} via {daemon_id}")
+    return forward
+
+
+def close_port_forward(port: int) -> bool:
+    """Stop accepting connections for a port forward; open tunnels run until they close."""
+    forward = port_forwards.pop(port, None)
+    if not forward:
+        return False
+    forward.server.close()
+    logger.info(f"Stopped forwarding {forward.host}:{port} to {forward.target}")
+    return True
+
+
+async def _pump_tunnel(
+    tunnel: DaemonTunnel,
+    reader: asyncio.StreamReader,
+    writer: asyncio.StreamWriter,
+):
+    """Copy between a local connection and a tunnel until either side closes."""
+    async def upstream():
+        while True:
+            data = await reader.read(32 * 1024)
+            if not data:
+                break
+            await tunnel.write(data)
+    
+    async def downstream():
+        while True:
+            data = await tunnel.read()
+            if not data:
+                break
+            writer.write(data)
+            await writer.drain()
+    
+    tasks = [asyncio.create_task(upstream()), asyncio.create_task(downstream())]
+    try:
+        await asyncio.wait(tasks, return_when=asyncio.FIRST_COMPLETED)
+    finally:
+        for task in tasks:
+            task.cancel()
+        await asyncio.gather(*tasks, return_exceptions=True)
+        await tunnel.close()
+        writer.close()
+
+
 async def read_file(daemon_id_or_name: str, path: str) -> Dict[str, Any]:
     """Read a file from a daemon."""
     daemon_id = resolve_daemon(daemon_id_or_name)
@@ -638,20 +1180,45 @@ async def write_file(
     content: bytes,
     create_dirs: bool = True,
 ) -> Dict[str, Any]:
-    """Write a file on a daemon."""
+    """Write a file on a daemon.
+    
+    The daemon verifies the SHA-256 of what it wrote and fails the write if
+    it doesn't match what was sent.
+    """
     daemon_id = resolve_daemon(daemon_id_or_name)
     import base64
+    import hashlib
     return await daemon_registry.send_command(
         daemon_id,
         CommandType.WRITE_FILE,
         {
             "path": path,
             "content": base64.b64encode(content).decode('ascii'),
+            "encoding": "base64",
+            "expected_checksum": hashlib.sha256(content).hexdigest(),
             "create_dirs": create_dirs,
         },
     )
 
 
+async def move_file(
+    daemon_id_or_name: str,
+    source: str,
+    destination: str,
+    overwrite: bool = False,
+) -> Dict[str, Any]:
+    """Move or rename a file or directory on a daemon.
+    
+    Fails if destination exists, unless overwrite is set.
+    """
+    daemon_id = resolve_daemon(daemon_id_or_name)
+    return await daemon_registry.send_command(
+        daemon_id,
+        CommandType.MOVE_FILE,
+        {"source": source, "destination": destination, "overwrite": overwrite},
+    )
+
+
 async def list_files(
     daemon_id_or_name: str,
     path: str,